@@ -6,7 +6,9 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/manifest-network/yaci/internal/client"
 	"github.com/manifest-network/yaci/internal/config"
@@ -20,10 +22,10 @@ var (
 )
 
 var ExtractCmd = &cobra.Command{
-	Use:   "extract [address]",
+	Use:   "extract [address[,address...]]",
 	Args:  cobra.ExactArgs(1),
 	Short: "Extract chain data to various output formats",
-	Long:  `Extract blockchain data and output it in the specified format.`,
+	Long:  `Extract blockchain data and output it in the specified format. Several comma-separated gRPC addresses of nodes serving the same chain can be given, in which case the calls are spread across the healthy nodes.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		if parent := cmd.Parent(); parent != nil && parent.PreRunE != nil {
 			if err := parent.PreRunE(parent, args); err != nil {
@@ -37,13 +39,39 @@ var ExtractCmd = &cobra.Command{
 		}
 
 		slog.Debug("Command-line arguments", "extractConfig", extractConfig)
-		slog.Debug("gRPC endpoint", "address", args[0])
+		addresses := parseAddresses(args[0])
+		slog.Debug("gRPC endpoints", "addresses", addresses)
 
 		ctx, cancel := context.WithCancel(context.Background())
 		handleInterrupt(cancel)
 
-		var err error
-		gRPCClient, err = client.NewGRPCClient(ctx, args[0], extractConfig.Insecure, extractConfig.MaxRecvMsgSize)
+		retryPolicy, err := extractConfig.RetryPolicy()
+		if err != nil {
+			return fmt.Errorf("invalid retry policy: %w", err)
+		}
+
+		auth, err := extractConfig.AuthConfig()
+		if err != nil {
+			return fmt.Errorf("invalid headers: %w", err)
+		}
+
+		gRPCClient, err = client.NewGRPCClient(ctx, client.Config{
+			Addresses:          addresses,
+			Insecure:           extractConfig.Insecure,
+			MaxCallRecvMsgSize: extractConfig.MaxRecvMsgSize,
+			Pool: client.PoolConfig{
+				HealthCheckInterval: extractConfig.HealthCheckInterval,
+				MaxLag:              extractConfig.MaxEndpointLag,
+				MaxErrorRate:        extractConfig.MaxEndpointErrorRate,
+				RateLimit:           extractConfig.RateLimit,
+			},
+			RetryPolicy:          retryPolicy,
+			Auth:                 auth,
+			TLS:                  extractConfig.TLSConfig(),
+			DescriptorCacheDir:   extractConfig.DescriptorCacheDir,
+			DescriptorSets:       extractConfig.DescriptorSets,
+			UpgradeCheckInterval: extractConfig.UpgradeCheckInterval,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to initialize gRPC: %w", err)
 		}
@@ -64,12 +92,53 @@ func init() {
 	ExtractCmd.PersistentFlags().IntP("max-recv-msg-size", "m", 4194304, "Maximum gRPC message size in bytes (advanced)")
 	ExtractCmd.PersistentFlags().Bool("enable-prometheus", false, "Enable Prometheus metrics server")
 	ExtractCmd.PersistentFlags().String("prometheus-addr", "0.0.0.0:2112", "Address and port of the Prometheus metrics server")
+	ExtractCmd.PersistentFlags().String("tx-fetch-strategy", config.TxFetchStrategyHash, fmt.Sprintf("Transaction fetch strategy (%s|%s). The %s strategy requires transaction indexing on the node", config.TxFetchStrategyHash, config.TxFetchStrategyHeight, config.TxFetchStrategyHeight))
+	ExtractCmd.PersistentFlags().String("rpc-address", "", "CometBFT RPC address used to extract block results (e.g., FinalizeBlock events). Disabled if empty")
+	ExtractCmd.PersistentFlags().String("on-reorg", config.OnReorgHalt, fmt.Sprintf("Action when the chain served by the node diverges from the extracted blocks (%s|%s)", config.OnReorgHalt, config.OnReorgRollback))
+	ExtractCmd.PersistentFlags().String("on-chain-reset", config.OnChainResetHalt, fmt.Sprintf("Action when the node serves a different chain than the one the output was built from (%s|%s|%s). Only supported by the PostgreSQL output", config.OnChainResetHalt, config.OnChainResetWipe, config.OnChainResetNewSchema))
+	ExtractCmd.PersistentFlags().Duration("health-check-interval", 10*time.Second, "Interval between two health checks of the gRPC endpoints")
+	ExtractCmd.PersistentFlags().Uint64("max-endpoint-lag", 5, "Number of blocks a gRPC endpoint can be behind the most advanced endpoint before being unhealthy")
+	ExtractCmd.PersistentFlags().Float64("max-endpoint-error-rate", 0.5, "Ratio of failed calls between two health checks above which a gRPC endpoint is unhealthy")
+	ExtractCmd.PersistentFlags().Duration("retry-initial-delay", time.Second, "Delay before the first retry of a failed gRPC call")
+	ExtractCmd.PersistentFlags().Float64("retry-multiplier", 2, "Factor applied to the retry delay after every retry")
+	ExtractCmd.PersistentFlags().Duration("retry-max-delay", 30*time.Second, "Maximum delay between two retries, before jitter")
+	ExtractCmd.PersistentFlags().Float64("retry-jitter", 0.2, "Ratio of the retry delay randomly added or removed")
+	ExtractCmd.PersistentFlags().Float64("rate-limit", 0, "Maximum number of gRPC calls per second to each endpoint. Unlimited if 0")
+	ExtractCmd.PersistentFlags().Bool("adaptive-concurrency", false, "Lower the block retrieval concurrency when the nodes throttle the calls, and raise it back up to max-concurrency when the latency is healthy")
+	ExtractCmd.PersistentFlags().Duration("target-latency", 5*time.Second, "Block retrieval time below which the adaptive concurrency is raised")
+	ExtractCmd.PersistentFlags().StringSlice("header", nil, "Metadata header attached to every gRPC call as key=value, e.g., x-api-key=<key>. Can be repeated")
+	ExtractCmd.PersistentFlags().String("bearer-token", "", "Bearer token sent in the authorization header of every gRPC call. Can also be set with the YACI_BEARER_TOKEN environment variable")
+	ExtractCmd.PersistentFlags().String("bearer-token-file", "", "File containing the bearer token, read again when it changes")
+	ExtractCmd.PersistentFlags().String("tls-ca-cert", "", "PEM bundle of the certificate authorities verifying the gRPC servers, replacing the system roots")
+	ExtractCmd.PersistentFlags().String("tls-client-cert", "", "PEM client certificate for mutual TLS")
+	ExtractCmd.PersistentFlags().String("tls-client-key", "", "PEM client key for mutual TLS")
+	ExtractCmd.PersistentFlags().String("tls-server-name", "", "Name verified in the gRPC server certificates, instead of the host of the address")
+	ExtractCmd.PersistentFlags().String("tls-min-version", "1.2", "Minimum TLS version (1.2|1.3)")
+	ExtractCmd.PersistentFlags().StringSlice("descriptor-set", nil, "FileDescriptorSet or Buf image file describing the services of the chain, supplementing or replacing gRPC reflection. Can be repeated")
+	ExtractCmd.PersistentFlags().String("descriptor-cache-dir", "", "Directory where the protocol buffer descriptors fetched from the nodes are cached, making restarts faster. Disabled if empty")
+	ExtractCmd.PersistentFlags().Duration("upgrade-check-interval", time.Minute, "Interval between two checks of the application version of the nodes, reloading the protocol buffer descriptors on chain upgrades. Disabled if 0")
 
 	if err := viper.BindPFlags(ExtractCmd.PersistentFlags()); err != nil {
 		slog.Error("Failed to bind ExtractCmd flags", "error", err)
 	}
 
 	ExtractCmd.AddCommand(PostgresCmd)
+	ExtractCmd.AddCommand(JSONLCmd)
+	ExtractCmd.AddCommand(ParquetCmd)
+	ExtractCmd.AddCommand(SQLiteCmd)
+	ExtractCmd.AddCommand(KafkaCmd)
+	ExtractCmd.AddCommand(MultiCmd)
+}
+
+// parseAddresses splits a comma-separated list of gRPC addresses.
+func parseAddresses(arg string) []string {
+	var addresses []string
+	for _, address := range strings.Split(arg, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
 }
 
 // handleInterrupt handles interrupt signals for graceful shutdown.
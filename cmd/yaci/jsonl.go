@@ -0,0 +1,73 @@
+package yaci
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/extractor"
+	"github.com/manifest-network/yaci/internal/output/jsonl"
+)
+
+var JSONLRunE = func(cmd *cobra.Command, args []string) error {
+	outputHandler, err := newJSONLOutputHandler()
+	if err != nil {
+		return err
+	}
+	defer outputHandler.Close()
+
+	if extractConfig.EnablePrometheus {
+		slog.Warn("Prometheus metrics are only available with the PostgreSQL output, ignoring --enable-prometheus")
+	}
+
+	return extractor.Extract(gRPCClient, outputHandler, extractConfig)
+}
+
+// newJSONLOutputHandler creates the JSON Lines output handler from the command-line configuration.
+func newJSONLOutputHandler() (*jsonl.JSONLOutputHandler, error) {
+	jsonlConfig := config.LoadJSONLConfigFromCLI()
+	if err := jsonlConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid JSON Lines configuration: %w", err)
+	}
+
+	slog.Debug("Command-line arguments", "jsonlConfig", jsonlConfig)
+
+	outputHandler, err := jsonl.NewJSONLOutputHandler(jsonlConfig.Dir, jsonlConfig.Compression, jsonlConfig.MaxFileSizeBytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JSON Lines output handler: %w", err)
+	}
+
+	return outputHandler, nil
+}
+
+var JSONLCmd = &cobra.Command{
+	Use:   "jsonl [flags]",
+	Short: "Extract chain data to JSON Lines files",
+	RunE:  JSONLRunE,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if parent := cmd.Parent(); parent != nil && parent.PreRunE != nil {
+			if err := parent.PreRunE(parent, args); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addJSONLFlags(JSONLCmd.Flags())
+	if err := viper.BindPFlags(JSONLCmd.Flags()); err != nil {
+		slog.Error("Failed to bind jsonlCmd flags", "error", err)
+	}
+}
+
+func addJSONLFlags(flags *pflag.FlagSet) {
+	flags.StringP("jsonl-dir", "o", "", "Output directory of the JSON Lines files")
+	flags.String("jsonl-compression", jsonl.CompressionNone, fmt.Sprintf("Compression of the JSON Lines files (%s|%s|%s)", jsonl.CompressionNone, jsonl.CompressionGzip, jsonl.CompressionZstd))
+	flags.Uint("jsonl-max-file-size", 256, "Maximum uncompressed size of a JSON Lines file before rotation, in MiB")
+}
@@ -0,0 +1,88 @@
+package yaci
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/extractor"
+	"github.com/manifest-network/yaci/internal/output/kafka"
+)
+
+var KafkaRunE = func(cmd *cobra.Command, args []string) error {
+	outputHandler, err := newKafkaOutputHandler()
+	if err != nil {
+		return err
+	}
+	defer outputHandler.Close()
+
+	if extractConfig.EnablePrometheus {
+		slog.Warn("Prometheus metrics are only available with the PostgreSQL output, ignoring --enable-prometheus")
+	}
+
+	return extractor.Extract(gRPCClient, outputHandler, extractConfig)
+}
+
+// newKafkaOutputHandler creates the Kafka output handler from the command-line configuration.
+func newKafkaOutputHandler() (*kafka.KafkaOutputHandler, error) {
+	kafkaConfig := config.LoadKafkaConfigFromCLI()
+	if err := kafkaConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Kafka configuration: %w", err)
+	}
+
+	slog.Debug("Command-line arguments", "kafkaConfig", kafkaConfig)
+
+	outputHandler, err := kafka.NewKafkaOutputHandler(kafkaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka output handler: %w", err)
+	}
+
+	return outputHandler, nil
+}
+
+var KafkaCmd = &cobra.Command{
+	Use:   "kafka [flags]",
+	Short: "Stream chain data to Kafka or Redpanda topics",
+	RunE:  KafkaRunE,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if parent := cmd.Parent(); parent != nil && parent.PreRunE != nil {
+			if err := parent.PreRunE(parent, args); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addKafkaFlags(KafkaCmd.Flags())
+	if err := viper.BindPFlags(KafkaCmd.Flags()); err != nil {
+		slog.Error("Failed to bind kafkaCmd flags", "error", err)
+	}
+}
+
+func addKafkaFlags(flags *pflag.FlagSet) {
+	flags.StringSlice("kafka-brokers", nil, "Comma-separated list of Kafka bootstrap brokers (host:port)")
+	flags.String("kafka-blocks-topic", "yaci.blocks", "Topic receiving the blocks, keyed by height")
+	flags.String("kafka-transactions-topic", "yaci.transactions", "Topic receiving the transactions, keyed by hash")
+	flags.String("kafka-block-results-topic", "yaci.block_results", "Topic receiving the block results, keyed by height")
+	flags.String("kafka-checkpoint-topic", "yaci.checkpoints", "Compacted topic storing the extraction progress")
+	flags.String("kafka-checkpoint-key", "yaci", "Key of the checkpoint record, unique per extraction")
+	flags.Duration("kafka-checkpoint-interval", time.Second, "Minimum time between two checkpoint writes")
+	flags.Bool("kafka-create-topics", true, "Create the topics if they do not exist")
+	flags.Duration("kafka-timeout", 10*time.Second, "Timeout of the Kafka requests")
+	flags.Bool("kafka-tls", false, "Connect to the brokers over TLS")
+	flags.String("kafka-tls-ca-cert", "", "PEM bundle of the certificate authorities verifying the brokers, replacing the system roots")
+	flags.String("kafka-tls-client-cert", "", "PEM client certificate for mutual TLS with the brokers")
+	flags.String("kafka-tls-client-key", "", "PEM client key for mutual TLS with the brokers")
+	flags.String("kafka-tls-server-name", "", "Server name verified in the broker certificates, defaults to the broker host")
+	flags.String("kafka-sasl-mechanism", "", "SASL mechanism authenticating to the brokers (PLAIN|SCRAM-SHA-256|SCRAM-SHA-512)")
+	flags.String("kafka-sasl-username", "", "SASL username")
+	flags.String("kafka-sasl-password", "", "SASL password. Can also be set with the YACI_KAFKA_SASL_PASSWORD environment variable")
+}
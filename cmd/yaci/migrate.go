@@ -0,0 +1,172 @@
+package yaci
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/output/postgresql"
+)
+
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage the PostgreSQL schema migrations",
+	Long: `Manage the migrations of the PostgreSQL schema embedded in yaci.
+
+The postgres subcommand applies the pending migrations on startup. These commands allow to inspect,
+roll back, or recover the migrations of a database.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if parent := cmd.Parent(); parent != nil && parent.PreRunE != nil {
+			if err := parent.PreRunE(parent, args); err != nil {
+				return err
+			}
+		}
+
+		// The postgres-conn flag shares its name with the flag of the postgres subcommand,
+		// so it is only bound when this command runs.
+		if err := viper.BindPFlags(cmd.PersistentFlags()); err != nil {
+			return fmt.Errorf("failed to bind migrateCmd flags: %w", err)
+		}
+
+		return nil
+	},
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:     "up",
+	Short:   "Apply all the pending migrations",
+	Args:    cobra.NoArgs,
+	PreRunE: migratePreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(func(migrator *postgresql.Migrator) error {
+			if err := migrator.Up(); err != nil {
+				return err
+			}
+			return printMigrationStatus(cmd, migrator)
+		})
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:     "down [N]",
+	Short:   "Roll back the last N migrations (default: 1)",
+	Args:    cobra.MaximumNArgs(1),
+	PreRunE: migratePreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps := 1
+		if len(args) == 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of migrations %s, expected a positive integer", args[0])
+			}
+		}
+
+		return withMigrator(func(migrator *postgresql.Migrator) error {
+			if err := migrator.Down(steps); err != nil {
+				return err
+			}
+			return printMigrationStatus(cmd, migrator)
+		})
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:     "status",
+	Short:   "Print the migration version of the database and the pending migrations",
+	Args:    cobra.NoArgs,
+	PreRunE: migratePreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withMigrator(func(migrator *postgresql.Migrator) error {
+			return printMigrationStatus(cmd, migrator)
+		})
+	},
+}
+
+var migrateForceCmd = &cobra.Command{
+	Use:   "force VERSION",
+	Short: "Set the migration version without running any migration, e.g., after fixing a failed migration",
+	Long: `Set the migration version without running any migration and clear the dirty state.
+
+Use it after fixing the database manually when a migration failed. Use -- -1 to mark the database as having no migration applied.`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: migratePreRunE,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < -1 {
+			return fmt.Errorf("invalid migration version %s, expected a version or -1", args[0])
+		}
+
+		return withMigrator(func(migrator *postgresql.Migrator) error {
+			if err := migrator.Force(version); err != nil {
+				return err
+			}
+			return printMigrationStatus(cmd, migrator)
+		})
+	},
+}
+
+func migratePreRunE(cmd *cobra.Command, args []string) error {
+	if parent := cmd.Parent(); parent != nil && parent.PreRunE != nil {
+		if err := parent.PreRunE(parent, args); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withMigrator runs the function with a migrator connected to the configured database.
+func withMigrator(fn func(migrator *postgresql.Migrator) error) error {
+	postgresConfig := config.LoadPostgresConfigFromCLI()
+	if err := postgresConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid PostgreSQL configuration: %w", err)
+	}
+
+	if _, err := pgxpool.ParseConfig(postgresConfig.ConnString); err != nil {
+		return fmt.Errorf("failed to parse PostgreSQL connection string: %w", err)
+	}
+
+	migrator, err := postgresql.NewMigrator(postgresConfig.ConnString)
+	if err != nil {
+		return fmt.Errorf("failed to create PostgreSQL migrator: %w", err)
+	}
+	defer migrator.Close()
+
+	return fn(migrator)
+}
+
+func printMigrationStatus(cmd *cobra.Command, migrator *postgresql.Migrator) error {
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if status.Version == 0 {
+		fmt.Fprintln(out, "Version: none")
+	} else {
+		fmt.Fprintln(out, "Version:", status.Version)
+	}
+	fmt.Fprintln(out, "Dirty:", status.Dirty)
+	fmt.Fprintln(out, "Pending:", status.Pending())
+
+	if status.Dirty {
+		slog.Warn("The last migration failed, fix the database then run `yaci migrate force VERSION`", "version", status.Version)
+	}
+
+	return nil
+}
+
+func init() {
+	MigrateCmd.PersistentFlags().StringP("postgres-conn", "p", "", "PostgreSQL connection string")
+
+	MigrateCmd.AddCommand(migrateUpCmd)
+	MigrateCmd.AddCommand(migrateDownCmd)
+	MigrateCmd.AddCommand(migrateStatusCmd)
+	MigrateCmd.AddCommand(migrateForceCmd)
+}
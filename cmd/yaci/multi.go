@@ -0,0 +1,133 @@
+package yaci
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/extractor"
+	"github.com/manifest-network/yaci/internal/output"
+	"github.com/manifest-network/yaci/internal/output/multi"
+	"github.com/manifest-network/yaci/internal/output/postgresql"
+)
+
+var MultiRunE = func(cmd *cobra.Command, args []string) error {
+	multiConfig := config.LoadMultiConfigFromCLI()
+	if err := multiConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid multi output configuration: %w", err)
+	}
+
+	slog.Debug("Command-line arguments", "multiConfig", multiConfig)
+
+	var (
+		outputs         []multi.Output
+		postgresHandler *postgresql.PostgresOutputHandler
+	)
+	for _, name := range multiConfig.Outputs {
+		handler, err := newOutputHandler(name)
+		if err != nil {
+			closeOutputs(outputs)
+			return err
+		}
+		if pg, ok := handler.(*postgresql.PostgresOutputHandler); ok {
+			postgresHandler = pg
+		}
+		outputs = append(outputs, multi.Output{Name: name, Handler: handler})
+	}
+
+	outputHandler, err := multi.NewMultiOutputHandler(outputs, multiConfig.OutputMode)
+	if err != nil {
+		closeOutputs(outputs)
+		return fmt.Errorf("failed to create multi output handler: %w", err)
+	}
+	defer outputHandler.Close()
+
+	if extractConfig.EnablePrometheus {
+		if postgresHandler == nil {
+			slog.Warn("Prometheus metrics are only available with the PostgreSQL output, ignoring --enable-prometheus")
+		} else if err := startMetricsServer(postgresHandler); err != nil {
+			return err
+		}
+	}
+
+	return extractor.Extract(gRPCClient, outputHandler, extractConfig)
+}
+
+// newOutputHandler creates the output handler of the given output, from the command-line configuration.
+func newOutputHandler(name string) (output.OutputHandler, error) {
+	switch name {
+	case config.OutputPostgres:
+		return asOutputHandler(newPostgresOutputHandler())
+	case config.OutputJSONL:
+		return asOutputHandler(newJSONLOutputHandler())
+	case config.OutputParquet:
+		return asOutputHandler(newParquetOutputHandler())
+	case config.OutputSQLite:
+		return asOutputHandler(newSQLiteOutputHandler())
+	case config.OutputKafka:
+		return asOutputHandler(newKafkaOutputHandler())
+	default:
+		return nil, fmt.Errorf("unsupported output %s", name)
+	}
+}
+
+// asOutputHandler avoids returning a nil handler wrapped in a non-nil interface.
+func asOutputHandler[T output.OutputHandler](handler T, err error) (output.OutputHandler, error) {
+	if err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+func closeOutputs(outputs []multi.Output) {
+	for _, out := range outputs {
+		if err := out.Handler.Close(); err != nil {
+			slog.Warn("Failed to close output", "output", out.Name, "error", err)
+		}
+	}
+}
+
+var MultiCmd = &cobra.Command{
+	Use:   "multi [flags]",
+	Short: "Extract chain data to several outputs at once",
+	Long: `Extract blockchain data and write every block to several outputs, e.g., PostgreSQL and Parquet files.
+
+Each output is configured with the flags of its subcommand, without their shorthand.
+The extraction resumes from the laggiest output.`,
+	RunE: MultiRunE,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if parent := cmd.Parent(); parent != nil && parent.PreRunE != nil {
+			if err := parent.PreRunE(parent, args); err != nil {
+				return err
+			}
+		}
+
+		// The output flags share their names with the flags of the other subcommands,
+		// so they are only bound when this subcommand runs.
+		if err := viper.BindPFlags(cmd.Flags()); err != nil {
+			return fmt.Errorf("failed to bind multiCmd flags: %w", err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	MultiCmd.Flags().StringSlice("output", nil, fmt.Sprintf("Output to write to, can be repeated (%s)", strings.Join(config.Outputs, "|")))
+	MultiCmd.Flags().String("output-mode", config.OutputModeAllOrNothing, fmt.Sprintf("Behavior when an output fails to write a block (%s|%s)", config.OutputModeAllOrNothing, config.OutputModeBestEffort))
+
+	for _, addFlags := range []func(*pflag.FlagSet){addPostgresFlags, addJSONLFlags, addParquetFlags, addSQLiteFlags, addKafkaFlags} {
+		outputFlags := pflag.NewFlagSet("", pflag.ContinueOnError)
+		addFlags(outputFlags)
+		// The shorthands of the subcommands conflict with each other
+		outputFlags.VisitAll(func(flag *pflag.Flag) {
+			flag.Shorthand = ""
+			MultiCmd.Flags().AddFlag(flag)
+		})
+	}
+}
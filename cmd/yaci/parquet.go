@@ -0,0 +1,73 @@
+package yaci
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/extractor"
+	"github.com/manifest-network/yaci/internal/output/parquet"
+)
+
+var ParquetRunE = func(cmd *cobra.Command, args []string) error {
+	outputHandler, err := newParquetOutputHandler()
+	if err != nil {
+		return err
+	}
+	defer outputHandler.Close()
+
+	if extractConfig.EnablePrometheus {
+		slog.Warn("Prometheus metrics are only available with the PostgreSQL output, ignoring --enable-prometheus")
+	}
+
+	return extractor.Extract(gRPCClient, outputHandler, extractConfig)
+}
+
+// newParquetOutputHandler creates the Parquet output handler from the command-line configuration.
+func newParquetOutputHandler() (*parquet.ParquetOutputHandler, error) {
+	parquetConfig := config.LoadParquetConfigFromCLI()
+	if err := parquetConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Parquet configuration: %w", err)
+	}
+
+	slog.Debug("Command-line arguments", "parquetConfig", parquetConfig)
+
+	outputHandler, err := parquet.NewParquetOutputHandler(parquetConfig.Dir, parquetConfig.Compression, parquetConfig.PartitionSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Parquet output handler: %w", err)
+	}
+
+	return outputHandler, nil
+}
+
+var ParquetCmd = &cobra.Command{
+	Use:   "parquet [flags]",
+	Short: "Extract chain data to Apache Parquet files",
+	RunE:  ParquetRunE,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if parent := cmd.Parent(); parent != nil && parent.PreRunE != nil {
+			if err := parent.PreRunE(parent, args); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addParquetFlags(ParquetCmd.Flags())
+	if err := viper.BindPFlags(ParquetCmd.Flags()); err != nil {
+		slog.Error("Failed to bind parquetCmd flags", "error", err)
+	}
+}
+
+func addParquetFlags(flags *pflag.FlagSet) {
+	flags.StringP("parquet-dir", "o", "", "Output directory of the Parquet files")
+	flags.String("parquet-compression", parquet.CompressionSnappy, fmt.Sprintf("Compression of the Parquet files (%s|%s|%s|%s)", parquet.CompressionNone, parquet.CompressionSnappy, parquet.CompressionGzip, parquet.CompressionZstd))
+	flags.Uint64("parquet-partition-size", 10000, "Number of block heights per Parquet partition")
+}
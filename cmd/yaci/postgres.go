@@ -3,6 +3,7 @@ package yaci
 import (
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
@@ -10,6 +11,7 @@ import (
 	"github.com/manifest-network/yaci/internal/output/postgresql"
 	"github.com/manifest-network/yaci/internal/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/manifest-network/yaci/internal/config"
@@ -17,43 +19,62 @@ import (
 )
 
 var PostgresRunE = func(cmd *cobra.Command, args []string) error {
+	outputHandler, err := newPostgresOutputHandler()
+	if err != nil {
+		return err
+	}
+	defer outputHandler.Close()
+
+	if extractConfig.EnablePrometheus {
+		if err := startMetricsServer(outputHandler); err != nil {
+			return err
+		}
+	}
+
+	return extractor.Extract(gRPCClient, outputHandler, extractConfig)
+}
+
+// newPostgresOutputHandler creates the PostgreSQL output handler from the command-line configuration.
+func newPostgresOutputHandler() (*postgresql.PostgresOutputHandler, error) {
 	postgresConfig := config.LoadPostgresConfigFromCLI()
 	if err := postgresConfig.Validate(); err != nil {
-		return fmt.Errorf("invalid PostgreSQL configuration: %w", err)
+		return nil, fmt.Errorf("invalid PostgreSQL configuration: %w", err)
 	}
 
 	slog.Debug("Command-line arguments", "postgresConfig", postgresConfig)
 
 	_, err := pgxpool.ParseConfig(postgresConfig.ConnString)
 	if err != nil {
-		return fmt.Errorf("failed to parse PostgreSQL connection string: %w", err)
+		return nil, fmt.Errorf("failed to parse PostgreSQL connection string: %w", err)
 	}
 
-	outputHandler, err := postgresql.NewPostgresOutputHandler(postgresConfig.ConnString)
+	outputHandler, err := postgresql.NewPostgresOutputHandler(postgresConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create PostgreSQL output handler: %w", err)
+		return nil, fmt.Errorf("failed to create PostgreSQL output handler: %w", err)
 	}
-	defer outputHandler.Close()
 
-	if extractConfig.EnablePrometheus {
-		slog.Info("Starting Prometheus metrics server...")
+	return outputHandler, nil
+}
 
-		// The total unique addresses metric requires to know the Bech32 prefix of the chain.
-		// Query the gRPC server for the Bech32 prefix.
-		bech32Prefix, err := utils.GetBech32PrefixWithRetry(gRPCClient, extractConfig.MaxRetries)
-		if err != nil {
-			return fmt.Errorf("failed to get Bech32 prefix: %w", err)
-		}
-		slog.Debug("Bech32 prefix retrieved", "bech32_prefix", bech32Prefix)
+// startMetricsServer starts the Prometheus metrics server, backed by the PostgreSQL database.
+func startMetricsServer(outputHandler *postgresql.PostgresOutputHandler) error {
+	slog.Info("Starting Prometheus metrics server...")
 
-		db := stdlib.OpenDBFromPool(outputHandler.GetPool())
-		_, err = metrics.CreateMetricsServer(db, bech32Prefix, extractConfig.PrometheusListenAddr)
-		if err != nil {
-			return fmt.Errorf("failed to start metrics server: %w", err)
-		}
+	// The total unique addresses metric requires to know the Bech32 prefix of the chain.
+	// Query the gRPC server for the Bech32 prefix.
+	bech32Prefix, err := utils.GetBech32PrefixWithRetry(gRPCClient, extractConfig.MaxRetries)
+	if err != nil {
+		return fmt.Errorf("failed to get Bech32 prefix: %w", err)
 	}
+	slog.Debug("Bech32 prefix retrieved", "bech32_prefix", bech32Prefix)
 
-	return extractor.Extract(gRPCClient, outputHandler, extractConfig)
+	db := stdlib.OpenDBFromPool(outputHandler.GetPool())
+	_, err = metrics.CreateMetricsServer(db, bech32Prefix, extractConfig.PrometheusListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to start metrics server: %w", err)
+	}
+
+	return nil
 }
 
 var PostgresCmd = &cobra.Command{
@@ -72,8 +93,15 @@ var PostgresCmd = &cobra.Command{
 }
 
 func init() {
-	PostgresCmd.Flags().StringP("postgres-conn", "p", "", "PosftgreSQL connection string")
+	addPostgresFlags(PostgresCmd.Flags())
 	if err := viper.BindPFlags(PostgresCmd.Flags()); err != nil {
 		slog.Error("Failed to bind postgresCmd flags", "error", err)
 	}
 }
+
+func addPostgresFlags(flags *pflag.FlagSet) {
+	flags.StringP("postgres-conn", "p", "", "PosftgreSQL connection string")
+	flags.Bool("skip-schema-check", false, "Skip the verification of the database schema on startup")
+	flags.Uint("postgres-batch-size", 1, "Number of blocks written per PostgreSQL transaction, using COPY when greater than 1")
+	flags.Duration("postgres-flush-interval", 500*time.Millisecond, "Maximum time pending blocks are buffered before being written, when batching")
+}
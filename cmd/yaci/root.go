@@ -70,6 +70,7 @@ func init() {
 	viper.AutomaticEnv()
 
 	RootCmd.AddCommand(ExtractCmd)
+	RootCmd.AddCommand(MigrateCmd)
 	RootCmd.AddCommand(versionCmd)
 }
 
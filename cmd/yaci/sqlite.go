@@ -0,0 +1,74 @@
+package yaci
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/extractor"
+	"github.com/manifest-network/yaci/internal/output/sqlite"
+)
+
+var SQLiteRunE = func(cmd *cobra.Command, args []string) error {
+	outputHandler, err := newSQLiteOutputHandler()
+	if err != nil {
+		return err
+	}
+	defer outputHandler.Close()
+
+	if extractConfig.EnablePrometheus {
+		slog.Warn("Prometheus metrics are only available with the PostgreSQL output, ignoring --enable-prometheus")
+	}
+
+	return extractor.Extract(gRPCClient, outputHandler, extractConfig)
+}
+
+// newSQLiteOutputHandler creates the SQLite output handler from the command-line configuration.
+func newSQLiteOutputHandler() (*sqlite.SQLiteOutputHandler, error) {
+	sqliteConfig := config.LoadSQLiteConfigFromCLI()
+	if err := sqliteConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid SQLite configuration: %w", err)
+	}
+
+	slog.Debug("Command-line arguments", "sqliteConfig", sqliteConfig)
+
+	outputHandler, err := sqlite.NewSQLiteOutputHandler(sqliteConfig.Path, int(sqliteConfig.BatchSize), sqliteConfig.FlushInterval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SQLite output handler: %w", err)
+	}
+
+	return outputHandler, nil
+}
+
+var SQLiteCmd = &cobra.Command{
+	Use:   "sqlite [flags]",
+	Short: "Extract chain data to a SQLite database",
+	RunE:  SQLiteRunE,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if parent := cmd.Parent(); parent != nil && parent.PreRunE != nil {
+			if err := parent.PreRunE(parent, args); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addSQLiteFlags(SQLiteCmd.Flags())
+	if err := viper.BindPFlags(SQLiteCmd.Flags()); err != nil {
+		slog.Error("Failed to bind sqliteCmd flags", "error", err)
+	}
+}
+
+func addSQLiteFlags(flags *pflag.FlagSet) {
+	flags.StringP("sqlite-path", "o", "", "Path of the SQLite database file")
+	flags.Uint("sqlite-batch-size", 100, "Number of blocks written per SQLite transaction")
+	flags.Duration("sqlite-flush-interval", time.Second, "Maximum time pending blocks are buffered before being written")
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// AuthConfig configures the metadata attached to every gRPC call, e.g., the API key required by commercial providers.
+type AuthConfig struct {
+	// Headers are static metadata headers, by lowercase key.
+	Headers map[string]string
+	// BearerToken is sent in the authorization header.
+	BearerToken string
+	// BearerTokenFile is a file containing the bearer token, read again when it changes, e.g., when the token is rotated.
+	BearerTokenFile string
+}
+
+// Enabled returns true if any metadata is configured.
+func (c AuthConfig) Enabled() bool {
+	return len(c.Headers) > 0 || c.BearerToken != "" || c.BearerTokenFile != ""
+}
+
+// authCredentials attaches the configured metadata to the gRPC calls.
+type authCredentials struct {
+	headers    map[string]string
+	token      string
+	tokenFile  string
+	requireTLS bool
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+var _ credentials.PerRPCCredentials = (*authCredentials)(nil)
+
+func newAuthCredentials(cfg AuthConfig, requireTLS bool) *authCredentials {
+	return &authCredentials{
+		headers:    cfg.Headers,
+		token:      cfg.BearerToken,
+		tokenFile:  cfg.BearerTokenFile,
+		requireTLS: requireTLS,
+	}
+}
+
+// GetRequestMetadata returns the headers, and the bearer token if configured.
+func (c *authCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	md := maps.Clone(c.headers)
+	if md == nil {
+		md = make(map[string]string)
+	}
+
+	token, err := c.bearerToken()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		md["authorization"] = "Bearer " + token
+	}
+	return md, nil
+}
+
+// RequireTransportSecurity returns false on insecure connections, so that local nodes can be reached without TLS.
+func (c *authCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// bearerToken returns the configured token, reading the token file again if it changed since the last read.
+// The last token read is kept when the file cannot be read, e.g., while it is being replaced.
+func (c *authCredentials) bearerToken() (string, error) {
+	if c.tokenFile == "" {
+		return c.token, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.tokenFile)
+	if err == nil && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return c.token, nil
+	}
+
+	var content []byte
+	if err == nil {
+		content, err = os.ReadFile(c.tokenFile)
+	}
+	if err != nil {
+		if c.token != "" {
+			slog.Warn("Failed to read the bearer token file, using the last token read", "file", c.tokenFile, "error", err)
+			return c.token, nil
+		}
+		return "", fmt.Errorf("failed to read bearer token file: %w", err)
+	}
+
+	if c.token != "" {
+		slog.Info("Bearer token file changed, using the new token", "file", c.tokenFile)
+	}
+	c.token = strings.TrimSpace(string(content))
+	c.modTime = info.ModTime()
+	c.size = info.Size()
+	return c.token, nil
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthCredentials(t *testing.T) {
+	creds := newAuthCredentials(AuthConfig{Headers: map[string]string{"x-api-key": "key"}, BearerToken: "token"}, true)
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"x-api-key": "key", "authorization": "Bearer token"}, md)
+	assert.True(t, creds.RequireTransportSecurity())
+
+	// The configured headers are not modified
+	assert.Equal(t, map[string]string{"x-api-key": "key"}, creds.headers)
+}
+
+func TestAuthCredentialsTokenFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(file, []byte("first\n"), 0o600))
+	creds := newAuthCredentials(AuthConfig{BearerTokenFile: file}, false)
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer first"}, md)
+
+	// The rotated token is read again
+	require.NoError(t, os.WriteFile(file, []byte("second\n"), 0o600))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Second)))
+	md, err = creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer second"}, md)
+
+	// The last token is used while the file is missing
+	require.NoError(t, os.Remove(file))
+	md, err = creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer second"}, md)
+
+	_, err = newAuthCredentials(AuthConfig{BearerTokenFile: file}, false).GetRequestMetadata(context.Background())
+	assert.ErrorContains(t, err, "failed to read bearer token file")
+}
@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"os"
 	"time"
 
 	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/retry"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
@@ -20,17 +20,91 @@ var keepaliveParams = keepalive.ClientParameters{
 }
 
 type GRPCClient struct {
-	Ctx      context.Context
-	Conn     *grpc.ClientConn
-	Resolver *reflection.CustomResolver
+	Ctx  context.Context
+	Conn grpc.ClientConnInterface
+	// Resolvers holds the resolvers of the successive schemas of the chain, reloaded on chain upgrades.
+	Resolvers   *reflection.ResolverHistory
+	RetryPolicy retry.Policy
+
+	// schemas persists the heights of the schemas of Resolvers, nil if the descriptor cache is disabled
+	schemas *reflection.SchemaHistoryFile
+}
+
+// Resolver returns the resolver of the schema active at the height of the calls made with the client context,
+// or the latest resolver if the calls do not query a height. It only resolves the types packed in the Any fields
+// of the responses, e.g., the messages of the transactions: the nodes serve every height with their current binary,
+// so the methods and their request and response messages are resolved with Resolvers.Latest.
+func (c *GRPCClient) Resolver() *reflection.CustomResolver {
+	return c.Resolvers.At(heightFromContext(c.Ctx))
+}
+
+// WithContext returns a copy of the client making its calls with the given context.
+func (c *GRPCClient) WithContext(ctx context.Context) *GRPCClient {
+	clone := *c
+	clone.Ctx = ctx
+	return &clone
+}
+
+// Config configures the connection to the gRPC servers.
+type Config struct {
+	// Addresses are the addresses of the gRPC servers, all serving the same chain.
+	Addresses          []string
+	Insecure           bool
+	MaxCallRecvMsgSize int
+	Pool               PoolConfig
+	RetryPolicy        retry.Policy
+	Auth               AuthConfig
+	// TLS is ignored when Insecure is set.
+	TLS TLSConfig
+	// DescriptorCacheDir is the directory of the descriptor cache files. The cache is disabled if empty.
+	DescriptorCacheDir string
+	// DescriptorSets are FileDescriptorSet or Buf image files, supplementing or replacing reflection.
+	DescriptorSets []string
+	// UpgradeCheckInterval is the interval between two checks of the application version of the nodes,
+	// reloading the descriptors when it changes. Disabled if 0.
+	UpgradeCheckInterval time.Duration
 }
 
-func NewGRPCClient(ctx context.Context, address string, insecure bool, maxCallRecvMsgSize int) (*GRPCClient, error) {
-	slog.Info("Initializing gRPC client pool...")
-	conn := dial(ctx, address, insecure, maxCallRecvMsgSize)
+func NewGRPCClient(ctx context.Context, cfg Config) (*GRPCClient, error) {
+	slog.Info("Initializing gRPC client pool...", "endpoints", cfg.Addresses)
+	if cfg.Auth.Enabled() && cfg.Insecure {
+		slog.Warn("Sending authentication metadata over an insecure connection")
+	}
+	opts, err := dialOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := NewEndpointPool(ctx, cfg.Addresses, cfg.Pool, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the gRPC endpoints: %w", err)
+	}
 
 	slog.Info("Fetching protocol buffer descriptors from gRPC server... This may take a while.")
-	descriptors, err := reflection.FetchAllDescriptors(ctx, conn, 3)
+	resolver, err := newResolver(ctx, pool, cfg)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	resolvers, schemas := newResolverHistory(ctx, pool, cfg, resolver)
+	gRPCClient := &GRPCClient{
+		Ctx:         ctx,
+		Conn:        pool,
+		Resolvers:   resolvers,
+		RetryPolicy: cfg.RetryPolicy,
+		schemas:     schemas,
+	}
+
+	if cfg.UpgradeCheckInterval > 0 {
+		go newUpgradeWatcher(gRPCClient, cfg).run(ctx)
+	}
+
+	return gRPCClient, nil
+}
+
+// newResolver fetches the descriptors of the nodes, and returns the resolver of their schema.
+func newResolver(ctx context.Context, conn grpc.ClientConnInterface, cfg Config) (*reflection.CustomResolver, error) {
+	descriptors, cache, err := fetchDescriptors(ctx, conn, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch descriptors: %w", err)
 	}
@@ -41,31 +115,25 @@ func NewGRPCClient(ctx context.Context, address string, insecure bool, maxCallRe
 		return nil, fmt.Errorf("failed to build descriptor set: %w", err)
 	}
 
-	resolver := reflection.NewCustomResolver(ctx, files, conn, 3)
-
-	return &GRPCClient{
-		Ctx:      ctx,
-		Conn:     conn,
-		Resolver: resolver,
-	}, nil
+	return reflection.NewCustomResolver(ctx, files, conn, cfg.RetryPolicy, 3, cache), nil
 }
 
-func dial(ctx context.Context, address string, insecure bool, maxCallRecvMsgSize int) *grpc.ClientConn {
+func dialOptions(cfg Config) ([]grpc.DialOption, error) {
 	var opts []grpc.DialOption
 	opts = append(opts, grpc.WithKeepaliveParams(keepaliveParams))
-	opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxCallRecvMsgSize)))
-	if insecure {
+	opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(cfg.MaxCallRecvMsgSize)))
+	if cfg.Insecure {
 		opts = append(opts, grpc.WithInsecure())
 	} else {
-		creds := credentials.NewClientTLSFromCert(nil, "")
-		opts = append(opts, grpc.WithTransportCredentials(creds))
+		tlsConfig, err := NewTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
 	}
-
-	conn, err := grpc.DialContext(ctx, address, opts...)
-	if err != nil {
-		slog.Error("Failed to connect", "error", err)
-		os.Exit(1)
+	if cfg.Auth.Enabled() {
+		opts = append(opts, grpc.WithPerRPCCredentials(newAuthCredentials(cfg.Auth, !cfg.Insecure)))
 	}
 
-	return conn
+	return opts, nil
 }
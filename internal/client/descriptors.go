@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+)
+
+// nodeInfoMethod returns the chain ID and application version of the node, keying the descriptor cache.
+const nodeInfoMethod = "/cosmos.base.tendermint.v1beta1.Service/GetNodeInfo"
+
+// Field numbers of GetNodeInfoResponse.default_node_info.network and GetNodeInfoResponse.application_version.version.
+const (
+	nodeInfoDefaultNodeInfoField    = 1
+	nodeInfoApplicationVersionField = 2
+	defaultNodeInfoNetworkField     = 4
+	versionInfoVersionField         = 3
+)
+
+// fetchDescriptors returns the descriptors of the nodes: the descriptors of the configured descriptor sets,
+// supplemented by the descriptors of the other services fetched using reflection.
+// When a cache directory is configured, the cached descriptors are loaded and only the missing ones are fetched.
+// Reflection may fail, e.g., when disabled on the nodes, as long as descriptors were loaded from the descriptor sets
+// or the cache. The returned cache is nil if disabled.
+func fetchDescriptors(ctx context.Context, conn grpc.ClientConnInterface, cfg Config) ([]*descriptorpb.FileDescriptorProto, *reflection.DescriptorCache, error) {
+	offline, err := reflection.LoadDescriptorSets(cfg.DescriptorSets)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(offline) > 0 {
+		slog.Info("Loaded protocol buffer descriptor sets", "files", cfg.DescriptorSets, "count", len(offline))
+	}
+
+	cache, cached := loadDescriptorCache(ctx, conn, cfg)
+
+	// The descriptor sets take precedence over the cached descriptors
+	offlineFiles := descriptorNames(offline)
+	known := append(offline, withoutDescriptors(cached, offlineFiles)...)
+
+	descriptors, err := reflection.FetchDescriptors(ctx, conn, known, cfg.RetryPolicy, 3)
+	if err != nil {
+		if len(known) == 0 {
+			return nil, nil, err
+		}
+		slog.Warn("Failed to fetch descriptors using reflection, using the descriptor sets and cached descriptors", "error", err)
+		descriptors = known
+	}
+
+	if cache != nil {
+		if err := cache.Add(withoutDescriptors(descriptors, offlineFiles)...); err != nil {
+			slog.Warn("Failed to write the descriptor cache", "file", cache.Path(), "error", err)
+		}
+	}
+	return descriptors, cache, nil
+}
+
+// descriptorNames returns the set of the names of the descriptors.
+func descriptorNames(fdProtos []*descriptorpb.FileDescriptorProto) map[string]bool {
+	names := make(map[string]bool, len(fdProtos))
+	for _, fdProto := range fdProtos {
+		names[fdProto.GetName()] = true
+	}
+	return names
+}
+
+// withoutDescriptors returns the descriptors whose name is not in the given set.
+func withoutDescriptors(fdProtos []*descriptorpb.FileDescriptorProto, names map[string]bool) []*descriptorpb.FileDescriptorProto {
+	var result []*descriptorpb.FileDescriptorProto
+	for _, fdProto := range fdProtos {
+		if !names[fdProto.GetName()] {
+			result = append(result, fdProto)
+		}
+	}
+	return result
+}
+
+// loadDescriptorCache opens the descriptor cache of the nodes, and returns the cached descriptors.
+// The cache is nil if disabled, or if the version of the nodes is unknown.
+func loadDescriptorCache(ctx context.Context, conn grpc.ClientConnInterface, cfg Config) (*reflection.DescriptorCache, []*descriptorpb.FileDescriptorProto) {
+	if cfg.DescriptorCacheDir == "" {
+		return nil, nil
+	}
+
+	chainID, appVersion, err := nodeInfo(ctx, conn)
+	if err != nil {
+		slog.Warn("Failed to get the node version, descriptor cache disabled", "error", err)
+		return nil, nil
+	}
+
+	cache := reflection.NewDescriptorCache(cfg.DescriptorCacheDir, cfg.Addresses, chainID, appVersion)
+	cached, err := cache.Load()
+	if err != nil {
+		slog.Warn("Failed to load the descriptor cache", "file", cache.Path(), "error", err)
+	} else if len(cached) > 0 {
+		slog.Info("Loaded cached protocol buffer descriptors", "file", cache.Path(), "count", len(cached))
+	}
+	return cache, cached
+}
+
+// nodeInfo queries the chain ID and application version of the node. Like latestHeight, the response is decoded
+// without its message type.
+func nodeInfo(ctx context.Context, conn grpc.ClientConnInterface) (chainID, appVersion string, err error) {
+	var reply emptypb.Empty
+	if err := conn.Invoke(ctx, nodeInfoMethod, &emptypb.Empty{}, &reply); err != nil {
+		return "", "", err
+	}
+
+	b := reply.ProtoReflect().GetUnknown()
+	defaultNodeInfo, err := bytesField(b, nodeInfoDefaultNodeInfoField)
+	if err != nil {
+		return "", "", err
+	}
+	network, err := bytesField(defaultNodeInfo, defaultNodeInfoNetworkField)
+	if err != nil {
+		return "", "", err
+	}
+	applicationVersion, err := bytesField(b, nodeInfoApplicationVersionField)
+	if err != nil {
+		return "", "", err
+	}
+	version, err := bytesField(applicationVersion, versionInfoVersionField)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(network) == 0 {
+		return "", "", fmt.Errorf("missing chain ID in node info response")
+	}
+	return string(network), string(version), nil
+}
+
+// bytesField returns the value of the last occurrence of a length-delimited field of an encoded message, or nil.
+func bytesField(b []byte, field protowire.Number) ([]byte, error) {
+	var value []byte
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, fmt.Errorf("failed to decode response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if num == field && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, fmt.Errorf("failed to decode response: %w", protowire.ParseError(n))
+			}
+			value = v
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, fmt.Errorf("failed to decode response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return value, nil
+}
+
+// varintField returns the value of the last occurrence of a varint field of an encoded message, or 0.
+func varintField(b []byte, field protowire.Number) (uint64, error) {
+	var value uint64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return 0, fmt.Errorf("failed to decode response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if num == field && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return 0, fmt.Errorf("failed to decode response: %w", protowire.ParseError(n))
+			}
+			value = v
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return 0, fmt.Errorf("failed to decode response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return value, nil
+}
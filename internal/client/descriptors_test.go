@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/manifest-network/yaci/internal/retry"
+)
+
+func TestNodeInfo(t *testing.T) {
+	// default_node_info { listen_addr, network }, application_version { name, version }
+	defaultNodeInfo := protowire.AppendString(protowire.AppendTag(nil, 3, protowire.BytesType), "tcp://0.0.0.0:26656")
+	defaultNodeInfo = protowire.AppendString(protowire.AppendTag(defaultNodeInfo, defaultNodeInfoNetworkField, protowire.BytesType), "manifest-1")
+	applicationVersion := protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "manifest")
+	applicationVersion = protowire.AppendString(protowire.AppendTag(applicationVersion, versionInfoVersionField, protowire.BytesType), "v1.0.0")
+	b := protowire.AppendBytes(protowire.AppendTag(nil, nodeInfoDefaultNodeInfoField, protowire.BytesType), defaultNodeInfo)
+	b = protowire.AppendBytes(protowire.AppendTag(b, nodeInfoApplicationVersionField, protowire.BytesType), applicationVersion)
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+			return err
+		}
+		reply := &emptypb.Empty{}
+		reply.ProtoReflect().SetUnknown(b)
+		return stream.SendMsg(reply)
+	}))
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///node", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	chainID, appVersion, err := nodeInfo(context.Background(), conn)
+	require.NoError(t, err)
+	assert.Equal(t, "manifest-1", chainID)
+	assert.Equal(t, "v1.0.0", appVersion)
+}
+
+func TestFetchDescriptorsWithoutReflection(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{Name: proto.String("chain.proto")}}}
+	content, err := proto.Marshal(set)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "chain.binpb")
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	// The node does not serve reflection
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///node", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	descriptors, cache, err := fetchDescriptors(context.Background(), conn, Config{DescriptorSets: []string{path}, RetryPolicy: retry.DefaultPolicy()})
+	require.NoError(t, err)
+	assert.Nil(t, cache)
+	require.Len(t, descriptors, 1)
+	assert.Equal(t, "chain.proto", descriptors[0].GetName())
+
+	_, _, err = fetchDescriptors(context.Background(), conn, Config{RetryPolicy: retry.DefaultPolicy()})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type heightKey struct{}
+
+// WithHeight returns a context carrying the block height queried by the gRPC calls made with it,
+// used to route the calls to the endpoints serving that height.
+func WithHeight(ctx context.Context, height uint64) context.Context {
+	return context.WithValue(ctx, heightKey{}, height)
+}
+
+// heightFromContext returns the block height carried by the context, or 0 if none.
+func heightFromContext(ctx context.Context) uint64 {
+	height, _ := ctx.Value(heightKey{}).(uint64)
+	return height
+}
+
+var lowestHeightRegexp = regexp.MustCompile(`lowest height is (\d+)`)
+
+// ParseLowestHeight extracts the lowest available height from pruned node errors, or returns 0.
+// CosmosSDK nodes return errors like "height 1 is not available, lowest height is 28566001".
+func ParseLowestHeight(errMsg string) uint64 {
+	matches := lowestHeightRegexp.FindStringSubmatch(strings.ToLower(errMsg))
+
+	if len(matches) >= 2 {
+		height, err := strconv.ParseUint(matches[1], 10, 64)
+		if err == nil {
+			return height
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,503 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// statusMethod returns the latest block height of the node, used to check the health of the endpoints.
+const statusMethod = "/cosmos.base.node.v1beta1.Service/Status"
+
+// statusHeightField is the field number of the height in cosmos.base.node.v1beta1.StatusResponse.
+const statusHeightField = 2
+
+// getLatestBlockMethod returns the latest block of the node, used instead of statusMethod by the nodes older than
+// Cosmos SDK 0.50, which do not implement it.
+const getLatestBlockMethod = "/cosmos.base.tendermint.v1beta1.Service/GetLatestBlock"
+
+// Field numbers of GetLatestBlockResponse.block, Block.header and Header.height.
+const (
+	latestBlockBlockField = 2
+	blockHeaderField      = 1
+	headerHeightField     = 3
+)
+
+// getBlockByHeightMethod is used to probe the earliest block height available on the node.
+const getBlockByHeightMethod = "/cosmos.base.tendermint.v1beta1.Service/GetBlockByHeight"
+
+// getBlockByHeightHeightField is the field number of the height in cosmos.base.tendermint.v1beta1.GetBlockByHeightRequest.
+const getBlockByHeightHeightField = 1
+
+// healthCheckTimeout bounds the duration of the health check of an endpoint.
+const healthCheckTimeout = 5 * time.Second
+
+// minCallsForErrorRate is the minimum number of calls between two health checks for the error rate of an endpoint
+// to be taken into account.
+const minCallsForErrorRate = 10
+
+// PoolConfig configures the health checks of the endpoints of a pool.
+type PoolConfig struct {
+	// HealthCheckInterval is the interval between two health checks of the endpoints.
+	HealthCheckInterval time.Duration
+	// MaxLag is the number of blocks an endpoint can be behind the most advanced endpoint before being unhealthy.
+	MaxLag uint64
+	// MaxErrorRate is the ratio of failed calls between two health checks above which an endpoint is unhealthy.
+	MaxErrorRate float64
+	// RateLimit is the maximum number of calls per second to every endpoint, unlimited if 0.
+	RateLimit float64
+}
+
+// endpoint is a connection to one of the gRPC servers of a pool.
+type endpoint struct {
+	address string
+	conn    *grpc.ClientConn
+	// limiter is nil when the calls are not rate limited
+	limiter *rate.Limiter
+
+	// calls and failures count the calls since the last health check
+	calls    atomic.Uint64
+	failures atomic.Uint64
+
+	// healthy, height and earliest are guarded by the mutex of the pool
+	healthy bool
+	height  uint64
+	// earliest is the earliest block height available on the endpoint, 0 if unknown
+	earliest uint64
+}
+
+// record counts the result of a call to the endpoint. Only the errors caused by the endpoint are failures.
+func (e *endpoint) record(err error) {
+	e.calls.Add(1)
+	if isFailoverError(err) {
+		e.failures.Add(1)
+	}
+}
+
+// invoke waits for the rate limiter of the endpoint, then performs a unary call.
+func (e *endpoint) invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	if e.limiter != nil {
+		if err := e.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return e.conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+// newStream waits for the rate limiter of the endpoint, then opens a stream.
+func (e *endpoint) newStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if e.limiter != nil {
+		if err := e.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return e.conn.NewStream(ctx, desc, method, opts...)
+}
+
+// EndpointPool spreads the gRPC calls across the healthy endpoints of several gRPC servers serving the same chain,
+// and fails over to the next endpoint when a call fails because of the endpoint.
+// The endpoints are health-checked periodically: an endpoint is unhealthy when it does not answer,
+// falls behind the most advanced endpoint, or fails too many calls.
+//
+// The pool also learns the earliest block height available on every endpoint, from the health checks and from
+// the errors of pruned nodes. The calls made with a context carrying a block height (see WithHeight) are routed
+// to the endpoints serving that height, preferring the ones with the shortest history, i.e., recent heights go to
+// pruned nodes and historical heights to archive nodes.
+type EndpointPool struct {
+	cfg       PoolConfig
+	endpoints []*endpoint
+	next      atomic.Uint64
+
+	mu sync.RWMutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ grpc.ClientConnInterface = (*EndpointPool)(nil)
+
+// NewEndpointPool connects to the given gRPC servers, checks their health, and starts the periodic health checks.
+// It fails if none of the endpoints is healthy.
+func NewEndpointPool(ctx context.Context, addresses []string, cfg PoolConfig, opts ...grpc.DialOption) (*EndpointPool, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no gRPC endpoint")
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		return nil, errors.New("health check interval must be greater than 0")
+	}
+	if cfg.RateLimit < 0 {
+		return nil, errors.New("rate limit must not be negative")
+	}
+
+	var endpoints []*endpoint
+	for _, address := range addresses {
+		conn, err := grpc.NewClient(address, opts...)
+		if err != nil {
+			for _, e := range endpoints {
+				e.conn.Close()
+			}
+			return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+		}
+		e := &endpoint{address: address, conn: conn}
+		if cfg.RateLimit > 0 {
+			// The burst allows one second worth of calls to be sent at once
+			e.limiter = rate.NewLimiter(rate.Limit(cfg.RateLimit), max(1, int(math.Ceil(cfg.RateLimit))))
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	pool := newEndpointPool(endpoints, cfg)
+	if !pool.checkHealth(ctx) {
+		pool.closeConns()
+		return nil, errors.New("no healthy gRPC endpoint")
+	}
+
+	pool.stop = make(chan struct{})
+	pool.done = make(chan struct{})
+	go pool.healthCheckLoop(ctx)
+
+	return pool, nil
+}
+
+func newEndpointPool(endpoints []*endpoint, cfg PoolConfig) *EndpointPool {
+	return &EndpointPool{cfg: cfg, endpoints: endpoints}
+}
+
+// Invoke performs a unary call on the next healthy endpoint, failing over to the other endpoints on failure.
+func (p *EndpointPool) Invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	var err error
+	for _, e := range p.candidates(heightFromContext(ctx)) {
+		err = e.invoke(ctx, method, args, reply, opts...)
+		if !p.shouldFailover(ctx, e, err) {
+			return err
+		}
+		slog.Debug("gRPC call failed, failing over to the next endpoint", "method", method, "endpoint", e.address, "error", err)
+	}
+	return err
+}
+
+// NewStream opens a stream on the next healthy endpoint, failing over to the other endpoints if it cannot be opened.
+// The stream is bound to its endpoint for its whole lifetime.
+func (p *EndpointPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	var err error
+	for _, e := range p.candidates(heightFromContext(ctx)) {
+		var stream grpc.ClientStream
+		stream, err = e.newStream(ctx, desc, method, opts...)
+		if !p.shouldFailover(ctx, e, err) {
+			return stream, err
+		}
+		slog.Debug("gRPC stream failed, failing over to the next endpoint", "method", method, "endpoint", e.address, "error", err)
+	}
+	return nil, err
+}
+
+// shouldFailover records the result of a call to the endpoint, and returns true if the call must be retried on
+// the next endpoint: the endpoint failed, or it does not serve the requested height anymore.
+func (p *EndpointPool) shouldFailover(ctx context.Context, e *endpoint, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		e.record(err)
+		return false
+	}
+
+	if lowest := ParseLowestHeight(err.Error()); lowest > 0 {
+		p.mu.Lock()
+		e.earliest = lowest
+		p.mu.Unlock()
+		e.record(nil)
+		return true
+	}
+
+	e.record(err)
+	return isFailoverError(err)
+}
+
+// candidates returns the endpoints in the order they must be tried for the given block height, 0 if none.
+// The healthy endpoints serving the height come first, those with the shortest history in round-robin order,
+// followed by the unhealthy endpoints serving the height, and the endpoints known not to serve it, as a last resort.
+func (p *EndpointPool) candidates(height uint64) []*endpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var healthy, unhealthy, unavailable []*endpoint
+	var maxEarliest uint64
+	for _, e := range p.endpoints {
+		switch {
+		case height > 0 && e.earliest > height:
+			unavailable = append(unavailable, e)
+		case e.healthy:
+			healthy = append(healthy, e)
+			maxEarliest = max(maxEarliest, e.earliest)
+		default:
+			unhealthy = append(unhealthy, e)
+		}
+	}
+
+	// Without a height, all the healthy endpoints are equivalent
+	var preferred, others []*endpoint
+	for _, e := range healthy {
+		if height == 0 || e.earliest == maxEarliest {
+			preferred = append(preferred, e)
+		} else {
+			others = append(others, e)
+		}
+	}
+
+	if n := len(preferred); n > 1 {
+		offset := int(p.next.Add(1) % uint64(n))
+		preferred = append(preferred[offset:], preferred[:offset]...)
+	}
+
+	return append(append(append(preferred, others...), unhealthy...), unavailable...)
+}
+
+// EarliestHeight returns the earliest block height available on the healthy endpoints,
+// and false if it is unknown for all of them.
+func (p *EndpointPool) EarliestHeight() (uint64, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var earliest uint64
+	for _, e := range p.endpoints {
+		if e.healthy && e.earliest > 0 && (earliest == 0 || e.earliest < earliest) {
+			earliest = e.earliest
+		}
+	}
+	return earliest, earliest > 0
+}
+
+// Healthy returns the addresses of the healthy endpoints.
+func (p *EndpointPool) Healthy() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var addresses []string
+	for _, e := range p.endpoints {
+		if e.healthy {
+			addresses = append(addresses, e.address)
+		}
+	}
+	return addresses
+}
+
+func (p *EndpointPool) healthCheckLoop(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !p.checkHealth(ctx) {
+				slog.Error("No healthy gRPC endpoint, using all the endpoints")
+			}
+		case <-p.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkHealth queries the latest block height of every endpoint and updates their health.
+// The earliest block height available is probed on the endpoints not known to be archive nodes.
+// It returns true if at least one endpoint is healthy.
+func (p *EndpointPool) checkHealth(ctx context.Context) bool {
+	heights := make([]uint64, len(p.endpoints))
+	earliests := make([]uint64, len(p.endpoints))
+	errs := make([]error, len(p.endpoints))
+
+	p.mu.RLock()
+	for i, e := range p.endpoints {
+		earliests[i] = e.earliest
+	}
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for i, e := range p.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			heights[i], errs[i] = latestHeight(ctx, e.conn)
+			if errs[i] == nil && earliests[i] != 1 {
+				earliest, err := earliestHeight(ctx, e.conn)
+				if err != nil {
+					slog.Debug("Failed to probe the earliest block height", "endpoint", e.address, "error", err)
+				} else {
+					earliests[i] = earliest
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var maxHeight uint64
+	for i := range p.endpoints {
+		if errs[i] == nil {
+			maxHeight = max(maxHeight, heights[i])
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	anyHealthy := false
+	for i, e := range p.endpoints {
+		calls, failures := e.calls.Swap(0), e.failures.Swap(0)
+
+		var reason string
+		switch {
+		case errs[i] != nil:
+			reason = fmt.Sprintf("health check failed: %v", errs[i])
+		case heights[i]+p.cfg.MaxLag < maxHeight:
+			reason = fmt.Sprintf("%d blocks behind", maxHeight-heights[i])
+		case calls >= minCallsForErrorRate && float64(failures)/float64(calls) > p.cfg.MaxErrorRate:
+			reason = fmt.Sprintf("%d of %d calls failed", failures, calls)
+		}
+
+		healthy := reason == ""
+		if errs[i] == nil {
+			e.height = heights[i]
+			e.earliest = max(e.earliest, earliests[i])
+		}
+		if healthy != e.healthy {
+			if healthy {
+				slog.Info("gRPC endpoint is healthy", "endpoint", e.address, "height", e.height, "earliest_height", e.earliest)
+			} else {
+				slog.Warn("gRPC endpoint is unhealthy", "endpoint", e.address, "reason", reason)
+			}
+		}
+		e.healthy = healthy
+		anyHealthy = anyHealthy || healthy
+	}
+
+	return anyHealthy
+}
+
+// latestHeight queries the latest block height of the node. The response is decoded without its message type,
+// which is only known once the descriptors are fetched from the node. The latest block is queried instead on the
+// nodes without the node status service.
+func latestHeight(ctx context.Context, conn grpc.ClientConnInterface) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var reply emptypb.Empty
+	if err := conn.Invoke(ctx, statusMethod, &emptypb.Empty{}, &reply); err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return latestBlockHeight(ctx, conn)
+		}
+		return 0, err
+	}
+
+	b := reply.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return 0, fmt.Errorf("failed to decode status response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if num == statusHeightField && typ == protowire.VarintType {
+			height, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return 0, fmt.Errorf("failed to decode status response: %w", protowire.ParseError(n))
+			}
+			return height, nil
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return 0, fmt.Errorf("failed to decode status response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+
+	return 0, errors.New("missing height in status response")
+}
+
+// latestBlockHeight queries the height of the latest block of the node. Like latestHeight, the response is decoded
+// without its message type.
+func latestBlockHeight(ctx context.Context, conn grpc.ClientConnInterface) (uint64, error) {
+	var reply emptypb.Empty
+	if err := conn.Invoke(ctx, getLatestBlockMethod, &emptypb.Empty{}, &reply); err != nil {
+		return 0, err
+	}
+
+	block, err := bytesField(reply.ProtoReflect().GetUnknown(), latestBlockBlockField)
+	if err != nil {
+		return 0, err
+	}
+	header, err := bytesField(block, blockHeaderField)
+	if err != nil {
+		return 0, err
+	}
+	height, err := varintField(header, headerHeightField)
+	if err != nil {
+		return 0, err
+	}
+	if height == 0 {
+		return 0, errors.New("missing height in latest block response")
+	}
+	return height, nil
+}
+
+// earliestHeight probes the earliest block height available on the node, by requesting the first block:
+// archive nodes return it, and pruned nodes return an error with their lowest height.
+func earliestHeight(ctx context.Context, conn grpc.ClientConnInterface) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	request := &emptypb.Empty{}
+	request.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, getBlockByHeightHeightField, protowire.VarintType), 1))
+
+	err := conn.Invoke(ctx, getBlockByHeightMethod, request, &emptypb.Empty{})
+	if err == nil {
+		return 1, nil
+	}
+	if lowest := ParseLowestHeight(err.Error()); lowest > 0 {
+		return lowest, nil
+	}
+	return 0, err
+}
+
+// isFailoverError returns true if the call failed because of the endpoint, rather than because of the request.
+func isFailoverError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the health checks and closes the connections to the endpoints.
+func (p *EndpointPool) Close() error {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+	}
+	return p.closeConns()
+}
+
+func (p *EndpointPool) closeConns() error {
+	var errs []error
+	for _, e := range p.endpoints {
+		errs = append(errs, e.conn.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,289 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const testMethod = "/test.Service/Echo"
+
+func init() {
+	// The fake nodes are dialed by name, without resolving their address
+	resolver.SetDefaultScheme("passthrough")
+}
+
+// fakeNode answers the status method with its height, and every other method with an empty message,
+// or an Unavailable error when failing. Like pruned nodes, it rejects the requests for heights below its earliest height.
+// Like the nodes older than Cosmos SDK 0.50, it only answers the latest block method with its height when noStatus is set.
+type fakeNode struct {
+	height   atomic.Uint64
+	earliest atomic.Uint64
+	fail     atomic.Bool
+	noStatus atomic.Bool
+	calls    atomic.Uint64
+}
+
+func (n *fakeNode) handle(_ any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	request := &emptypb.Empty{}
+	if err := stream.RecvMsg(request); err != nil {
+		return err
+	}
+
+	if method == statusMethod && n.noStatus.Load() {
+		return status.Errorf(codes.Unimplemented, "unknown service cosmos.base.node.v1beta1.Service")
+	}
+	if method == getLatestBlockMethod {
+		// block { header { chain_id, height = n.height } }
+		header := protowire.AppendString(protowire.AppendTag(nil, 2, protowire.BytesType), "test-1")
+		header = protowire.AppendVarint(protowire.AppendTag(header, headerHeightField, protowire.VarintType), n.height.Load())
+		block := protowire.AppendBytes(protowire.AppendTag(nil, blockHeaderField, protowire.BytesType), header)
+		reply := &emptypb.Empty{}
+		reply.ProtoReflect().SetUnknown(protowire.AppendBytes(protowire.AppendTag(nil, latestBlockBlockField, protowire.BytesType), block))
+		return stream.SendMsg(reply)
+	}
+	if method == statusMethod {
+		// earliest_store_height = 1, height = n.height
+		b := protowire.AppendTag(nil, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+		b = protowire.AppendTag(b, statusHeightField, protowire.VarintType)
+		b = protowire.AppendVarint(b, n.height.Load())
+		reply := &emptypb.Empty{}
+		reply.ProtoReflect().SetUnknown(b)
+		return stream.SendMsg(reply)
+	}
+
+	if height := requestHeight(request); height > 0 && height < n.earliest.Load() {
+		return status.Errorf(codes.InvalidArgument, "height %d is not available, lowest height is %d", height, n.earliest.Load())
+	}
+	if method == getBlockByHeightMethod {
+		return stream.SendMsg(&emptypb.Empty{})
+	}
+
+	n.calls.Add(1)
+	if n.fail.Load() {
+		return status.Error(codes.Unavailable, "node unavailable")
+	}
+	return stream.SendMsg(&emptypb.Empty{})
+}
+
+// heightRequest returns a request for the given height, encoded in the first field like GetBlockByHeightRequest.
+func heightRequest(height uint64) *emptypb.Empty {
+	request := &emptypb.Empty{}
+	request.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), height))
+	return request
+}
+
+// requestHeight returns the height of a request built by heightRequest, or 0.
+func requestHeight(request *emptypb.Empty) uint64 {
+	b := request.ProtoReflect().GetUnknown()
+	if num, typ, n := protowire.ConsumeTag(b); n > 0 && num == 1 && typ == protowire.VarintType {
+		height, _ := protowire.ConsumeVarint(b[n:])
+		return height
+	}
+	return 0
+}
+
+// startFakeNodes starts in-memory gRPC servers, and returns the dial option connecting to them by address.
+func startFakeNodes(t *testing.T, nodes map[string]*fakeNode) grpc.DialOption {
+	listeners := make(map[string]*bufconn.Listener)
+	for address, node := range nodes {
+		lis := bufconn.Listen(1024 * 1024)
+		s := grpc.NewServer(grpc.UnknownServiceHandler(node.handle))
+		go func() { _ = s.Serve(lis) }()
+		t.Cleanup(s.Stop)
+		listeners[address] = lis
+	}
+
+	return grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+		lis, ok := listeners[address]
+		if !ok {
+			return nil, fmt.Errorf("unknown address %s", address)
+		}
+		return lis.DialContext(ctx)
+	})
+}
+
+func newTestPool(t *testing.T, nodes map[string]*fakeNode, addresses []string) *EndpointPool {
+	dialer := startFakeNodes(t, nodes)
+	cfg := PoolConfig{HealthCheckInterval: time.Hour, MaxLag: 5, MaxErrorRate: 0.5}
+
+	pool, err := NewEndpointPool(context.Background(), addresses, cfg, dialer, grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+func TestEndpointPoolLoadBalancing(t *testing.T) {
+	a, b := &fakeNode{}, &fakeNode{}
+	a.height.Store(100)
+	b.height.Store(100)
+	pool := newTestPool(t, map[string]*fakeNode{"a": a, "b": b}, []string{"a", "b"})
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, pool.Invoke(context.Background(), testMethod, &emptypb.Empty{}, &emptypb.Empty{}))
+	}
+
+	assert.Equal(t, uint64(5), a.calls.Load())
+	assert.Equal(t, uint64(5), b.calls.Load())
+}
+
+func TestEndpointPoolFailover(t *testing.T) {
+	a, b := &fakeNode{}, &fakeNode{}
+	a.height.Store(100)
+	b.height.Store(100)
+	a.fail.Store(true)
+	pool := newTestPool(t, map[string]*fakeNode{"a": a, "b": b}, []string{"a", "b"})
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, pool.Invoke(context.Background(), testMethod, &emptypb.Empty{}, &emptypb.Empty{}))
+	}
+	assert.Equal(t, uint64(20), b.calls.Load())
+	assert.Equal(t, uint64(10), a.calls.Load())
+
+	// The failing endpoint is unhealthy once its error rate is checked
+	assert.True(t, pool.checkHealth(context.Background()))
+	assert.Equal(t, []string{"b"}, pool.Healthy())
+
+	// The endpoint is healthy again at the next health check, once it stops failing
+	a.fail.Store(false)
+	assert.True(t, pool.checkHealth(context.Background()))
+	assert.Equal(t, []string{"a", "b"}, pool.Healthy())
+
+	// The last error is returned when all the endpoints fail
+	b.fail.Store(true)
+	a.fail.Store(true)
+	err := pool.Invoke(context.Background(), testMethod, &emptypb.Empty{}, &emptypb.Empty{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestEndpointPoolLag(t *testing.T) {
+	a, b := &fakeNode{}, &fakeNode{}
+	a.height.Store(100)
+	b.height.Store(100)
+	pool := newTestPool(t, map[string]*fakeNode{"a": a, "b": b}, []string{"a", "b"})
+	assert.Equal(t, []string{"a", "b"}, pool.Healthy())
+
+	b.height.Store(110)
+	assert.True(t, pool.checkHealth(context.Background()))
+	assert.Equal(t, []string{"b"}, pool.Healthy())
+
+	// The unhealthy endpoint is only used as a last resort
+	for i := 0; i < 4; i++ {
+		require.NoError(t, pool.Invoke(context.Background(), testMethod, &emptypb.Empty{}, &emptypb.Empty{}))
+	}
+	assert.Equal(t, uint64(0), a.calls.Load())
+	assert.Equal(t, uint64(4), b.calls.Load())
+
+	a.height.Store(108)
+	assert.True(t, pool.checkHealth(context.Background()))
+	assert.Equal(t, []string{"a", "b"}, pool.Healthy())
+}
+
+func TestEndpointPoolWithoutStatus(t *testing.T) {
+	a, b := &fakeNode{}, &fakeNode{}
+	a.height.Store(100)
+	b.height.Store(100)
+	a.noStatus.Store(true)
+	pool := newTestPool(t, map[string]*fakeNode{"a": a, "b": b}, []string{"a", "b"})
+	assert.Equal(t, []string{"a", "b"}, pool.Healthy())
+
+	// The height of the latest block is used to check the lag
+	a.height.Store(90)
+	assert.True(t, pool.checkHealth(context.Background()))
+	assert.Equal(t, []string{"b"}, pool.Healthy())
+
+	b.noStatus.Store(true)
+	a.height.Store(120)
+	assert.True(t, pool.checkHealth(context.Background()))
+	assert.Equal(t, []string{"a"}, pool.Healthy())
+	height, err := latestHeight(context.Background(), pool)
+	require.NoError(t, err)
+	assert.Contains(t, []uint64{100, 120}, height)
+}
+
+func TestNewEndpointPoolUnhealthy(t *testing.T) {
+	dialer := startFakeNodes(t, map[string]*fakeNode{})
+	_, err := NewEndpointPool(context.Background(), []string{"missing"}, PoolConfig{HealthCheckInterval: time.Hour}, dialer, grpc.WithInsecure())
+	assert.ErrorContains(t, err, "no healthy gRPC endpoint")
+
+	_, err = NewEndpointPool(context.Background(), nil, PoolConfig{HealthCheckInterval: time.Hour})
+	assert.ErrorContains(t, err, "no gRPC endpoint")
+}
+
+func TestEndpointPoolHeightRouting(t *testing.T) {
+	archive, pruned := &fakeNode{}, &fakeNode{}
+	archive.height.Store(2000)
+	pruned.height.Store(2000)
+	pruned.earliest.Store(1000)
+	pool := newTestPool(t, map[string]*fakeNode{"archive": archive, "pruned": pruned}, []string{"archive", "pruned"})
+
+	earliest, ok := pool.EarliestHeight()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), earliest)
+
+	// Historical heights go to the archive node, recent heights to the pruned node
+	for _, height := range []uint64{500, 1500, 1800} {
+		ctx := WithHeight(context.Background(), height)
+		require.NoError(t, pool.Invoke(ctx, testMethod, heightRequest(height), &emptypb.Empty{}))
+	}
+	assert.Equal(t, uint64(1), archive.calls.Load())
+	assert.Equal(t, uint64(2), pruned.calls.Load())
+
+	// The pruned node drops more blocks: the call fails over to the archive node, and the new earliest height is learned
+	pruned.earliest.Store(1600)
+	for _, height := range []uint64{1500, 1500} {
+		ctx := WithHeight(context.Background(), height)
+		require.NoError(t, pool.Invoke(ctx, testMethod, heightRequest(height), &emptypb.Empty{}))
+	}
+	assert.Equal(t, uint64(3), archive.calls.Load())
+	assert.Equal(t, uint64(2), pruned.calls.Load())
+	assert.Equal(t, []string{"archive", "pruned"}, pool.Healthy())
+
+	// Calls without a height are spread across all the healthy endpoints
+	for i := 0; i < 4; i++ {
+		require.NoError(t, pool.Invoke(context.Background(), testMethod, &emptypb.Empty{}, &emptypb.Empty{}))
+	}
+	assert.Equal(t, uint64(5), archive.calls.Load())
+	assert.Equal(t, uint64(4), pruned.calls.Load())
+}
+
+func TestEndpointPoolRateLimit(t *testing.T) {
+	a := &fakeNode{}
+	a.height.Store(100)
+	dialer := startFakeNodes(t, map[string]*fakeNode{"a": a})
+	cfg := PoolConfig{HealthCheckInterval: time.Hour, MaxLag: 5, MaxErrorRate: 0.5, RateLimit: 100}
+
+	pool, err := NewEndpointPool(context.Background(), []string{"a"}, cfg, dialer, grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { pool.Close() })
+
+	// The burst of 100 calls is served at once, the next 20 calls at 100 per second
+	begin := time.Now()
+	for i := 0; i < 120; i++ {
+		require.NoError(t, pool.Invoke(context.Background(), testMethod, &emptypb.Empty{}, &emptypb.Empty{}))
+	}
+	assert.GreaterOrEqual(t, time.Since(begin), 150*time.Millisecond)
+
+	// Waiting for the limiter stops with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, pool.Invoke(ctx, testMethod, &emptypb.Empty{}, &emptypb.Empty{}))
+
+	_, err = NewEndpointPool(context.Background(), []string{"a"}, PoolConfig{HealthCheckInterval: time.Hour, RateLimit: -1}, dialer, grpc.WithInsecure())
+	assert.ErrorContains(t, err, "rate limit")
+}
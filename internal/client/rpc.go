@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const rpcRequestTimeout = 30 * time.Second
+
+// RPCConfig configures the connection to the CometBFT RPC server. The gRPC settings apply, as both servers are
+// usually exposed by the same provider.
+type RPCConfig struct {
+	Insecure bool
+	Auth     AuthConfig
+	TLS      TLSConfig
+}
+
+// RPCClient is a minimal CometBFT JSON-RPC client.
+// It is used for data that is not exposed by the Cosmos SDK gRPC services, e.g., block results.
+type RPCClient struct {
+	Address    string
+	httpClient *http.Client
+	// auth is nil when no metadata is configured
+	auth *authCredentials
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data"`
+}
+
+func (e *rpcError) Error() string {
+	if e.Data != "" {
+		return fmt.Sprintf("rpc error %d: %s: %s", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// NewRPCClient creates a new CometBFT RPC client, sending the configured headers and bearer token with every request.
+// If the address has no scheme, `http` is used when insecure is set and `https` otherwise.
+func NewRPCClient(address string, cfg RPCConfig) (*RPCClient, error) {
+	if !strings.Contains(address, "://") {
+		scheme := "https"
+		if cfg.Insecure {
+			scheme = "http"
+		}
+		address = scheme + "://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse RPC address: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported RPC address scheme: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in RPC address: %s", address)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if u.Scheme == "https" {
+		tlsConfig, err := NewTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	c := &RPCClient{
+		Address:    strings.TrimRight(u.String(), "/"),
+		httpClient: &http.Client{Timeout: rpcRequestTimeout, Transport: transport},
+	}
+	if cfg.Auth.Enabled() {
+		c.auth = newAuthCredentials(cfg.Auth, u.Scheme == "https")
+	}
+
+	return c, nil
+}
+
+// Call invokes the given RPC method using the URI over HTTP interface and returns the raw `result` field.
+func (c *RPCClient) Call(ctx context.Context, method string, params url.Values) ([]byte, error) {
+	endpoint := c.Address + "/" + method
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RPC request: %w", err)
+	}
+	if c.auth != nil {
+		headers, err := c.auth.GetRequestMetadata(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get RPC request headers: %w", err)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call RPC method %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RPC response: %w", err)
+	}
+
+	var rpcResp rpcResponse
+	if err := json.Unmarshal(body, &rpcResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal RPC response (status %d): %w", resp.StatusCode, err)
+	}
+
+	if rpcResp.Error != nil {
+		return nil, rpcResp.Error
+	}
+
+	if len(rpcResp.Result) == 0 {
+		return nil, fmt.Errorf("empty RPC result for method %s (status %d)", method, resp.StatusCode)
+	}
+
+	return rpcResp.Result, nil
+}
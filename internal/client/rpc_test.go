@@ -0,0 +1,103 @@
+package client_test
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/manifest-network/yaci/internal/client"
+)
+
+func TestNewRPCClient(t *testing.T) {
+	cases := []struct {
+		name     string
+		address  string
+		insecure bool
+		want     string
+		error    string
+	}{
+		{name: "no scheme, secure", address: "rpc.example.com:443", want: "https://rpc.example.com:443"},
+		{name: "no scheme, insecure", address: "localhost:26657", insecure: true, want: "http://localhost:26657"},
+		{name: "explicit scheme", address: "http://localhost:26657/", want: "http://localhost:26657"},
+		{name: "invalid scheme", address: "tcp://localhost:26657", error: "unsupported RPC address scheme"},
+		{name: "missing host", address: "http://", error: "missing host"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := client.NewRPCClient(tc.address, client.RPCConfig{Insecure: tc.insecure})
+			if tc.error != "" {
+				assert.ErrorContains(t, err, tc.error)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, c.Address)
+		})
+	}
+}
+
+func TestRPCClientCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("height") {
+		case "10":
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":-1,"result":{"height":"10","finalize_block_events":[]}}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":-1,"error":{"code":-32603,"message":"Internal error","data":"height 1 is not available"}}`))
+		}
+	}))
+	defer server.Close()
+
+	c, err := client.NewRPCClient(server.URL, client.RPCConfig{})
+	require.NoError(t, err)
+
+	result, err := c.Call(context.Background(), "block_results", url.Values{"height": []string{"10"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"height":"10","finalize_block_events":[]}`, string(result))
+
+	_, err = c.Call(context.Background(), "block_results", url.Values{"height": []string{"1"}})
+	assert.ErrorContains(t, err, "height 1 is not available")
+}
+
+func TestRPCClientAuthAndTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":-1,"error":{"code":-32600,"message":"unauthorized"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":-1,"result":{}}`))
+	}))
+	defer server.Close()
+
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	c, err := client.NewRPCClient(server.URL, client.RPCConfig{
+		Auth: client.AuthConfig{Headers: map[string]string{"x-api-key": "key"}, BearerToken: "secret"},
+		TLS:  client.TLSConfig{CACert: caCert},
+	})
+	require.NoError(t, err)
+	_, err = c.Call(context.Background(), "status", nil)
+	require.NoError(t, err)
+
+	// The server certificate is not trusted by the system roots
+	c, err = client.NewRPCClient(server.URL, client.RPCConfig{Auth: client.AuthConfig{BearerToken: "secret"}})
+	require.NoError(t, err)
+	_, err = c.Call(context.Background(), "status", nil)
+	assert.ErrorContains(t, err, "certificate")
+
+	// The headers are required by the server
+	c, err = client.NewRPCClient(server.URL, client.RPCConfig{TLS: client.TLSConfig{CACert: caCert}})
+	require.NoError(t, err)
+	_, err = c.Call(context.Background(), "status", nil)
+	assert.ErrorContains(t, err, "unauthorized")
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSVersions are the supported minimum TLS versions, by name.
+var TLSVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig configures the TLS connections to the servers. The zero value verifies the servers against the system roots.
+type TLSConfig struct {
+	// CACert is a PEM bundle of the certificate authorities verifying the servers, replacing the system roots.
+	CACert string
+	// ClientCert and ClientKey are the PEM certificate and key authenticating the client, for mutual TLS.
+	ClientCert string
+	ClientKey  string
+	// ServerName overrides the name verified in the server certificates, which defaults to the host of the address.
+	ServerName string
+	// MinVersion is the minimum TLS version, one of TLSVersions. Defaults to 1.2.
+	MinVersion string
+}
+
+// NewTLSConfig loads the certificates of the TLS configuration.
+func NewTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: cfg.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.MinVersion != "" {
+		version, ok := TLSVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid minimum TLS version: %s", cfg.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// testCA issues the certificates of the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a server or client certificate for the given name.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, name string, content []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	return path
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	tlsConfig, err := NewTLSConfig(TLSConfig{
+		CACert:     writeFile(t, "ca.pem", ca.pem),
+		ClientCert: writeFile(t, "client.pem", certPEM),
+		ClientKey:  writeFile(t, "client.key", keyPEM),
+		ServerName: "node.internal",
+		MinVersion: "1.3",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "node.internal", tlsConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+
+	tlsConfig, err = NewTLSConfig(TLSConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Nil(t, tlsConfig.RootCAs)
+
+	_, err = NewTLSConfig(TLSConfig{CACert: writeFile(t, "empty.pem", nil)})
+	assert.ErrorContains(t, err, "no certificate found")
+	_, err = NewTLSConfig(TLSConfig{ClientCert: writeFile(t, "client.pem", certPEM)})
+	assert.ErrorContains(t, err, "failed to load client certificate")
+	_, err = NewTLSConfig(TLSConfig{MinVersion: "1.0"})
+	assert.ErrorContains(t, err, "invalid minimum TLS version")
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCertPEM, serverKeyPEM := ca.issue(t, "node.internal", x509.ExtKeyUsageServerAuth)
+	clientCertPEM, clientKeyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	serverCert, err := tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	serverCreds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+
+	node := &fakeNode{}
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(grpc.Creds(serverCreds), grpc.UnknownServiceHandler(node.handle))
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})
+
+	invoke := func(cfg TLSConfig) error {
+		opts, err := dialOptions(Config{MaxCallRecvMsgSize: 1024 * 1024, TLS: cfg})
+		require.NoError(t, err)
+		conn, err := grpc.NewClient("passthrough:///10.0.0.1:9090", append(opts, dialer)...)
+		require.NoError(t, err)
+		defer conn.Close()
+		return conn.Invoke(context.Background(), testMethod, &emptypb.Empty{}, &emptypb.Empty{})
+	}
+
+	// The server is verified against the CA with the overridden name, and the client is authenticated
+	cfg := TLSConfig{
+		CACert:     writeFile(t, "ca.pem", ca.pem),
+		ClientCert: writeFile(t, "client.pem", clientCertPEM),
+		ClientKey:  writeFile(t, "client.key", clientKeyPEM),
+		ServerName: "node.internal",
+	}
+	require.NoError(t, invoke(cfg))
+	assert.Equal(t, uint64(1), node.calls.Load())
+
+	// The server name must match the server certificate
+	wrongName := cfg
+	wrongName.ServerName = "other.internal"
+	assert.Error(t, invoke(wrongName))
+
+	// The server rejects the clients without certificate
+	noClientCert := cfg
+	noClientCert.ClientCert, noClientCert.ClientKey = "", ""
+	assert.Error(t, invoke(noClientCert))
+	assert.Equal(t, uint64(1), node.calls.Load())
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+)
+
+// currentPlanMethod returns the pending upgrade plan of the chain, whose height is the first height of the new schema.
+const currentPlanMethod = "/cosmos.upgrade.v1beta1.Query/CurrentPlan"
+
+// Field numbers of CurrentPlanResponse.plan, Plan.name and Plan.height.
+const (
+	currentPlanPlanField = 1
+	planNameField        = 1
+	planHeightField      = 3
+)
+
+// upgradeWatcher detects the chain upgrades, i.e., changes of the application version of the nodes, and reloads
+// the descriptors of the new schema while the extraction continues. The new resolver applies from the height of
+// the upgrade plan, or from the height following the last check before the upgrade if no plan was seen.
+type upgradeWatcher struct {
+	client *GRPCClient
+	cfg    Config
+
+	appVersion string
+	// lastHeight is the latest height of the nodes at the last check before the upgrade
+	lastHeight uint64
+	planName   string
+	planHeight uint64
+}
+
+func newUpgradeWatcher(client *GRPCClient, cfg Config) *upgradeWatcher {
+	return &upgradeWatcher{client: client, cfg: cfg}
+}
+
+// run checks the application version of the nodes at every interval, until the context is done.
+func (w *upgradeWatcher) run(ctx context.Context) {
+	version, err := w.nodeVersion(ctx)
+	if err != nil {
+		slog.Warn("Failed to get the node version, chain upgrade detection disabled", "error", err)
+		return
+	}
+	w.appVersion = version
+	w.updatePlan(ctx)
+
+	ticker := time.NewTicker(w.cfg.UpgradeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+// check reloads the descriptors if the application version of the nodes changed.
+// A failed reload is retried at the next check.
+func (w *upgradeWatcher) check(ctx context.Context) {
+	version, err := w.nodeVersion(ctx)
+	if err != nil {
+		slog.Debug("Failed to get the node version", "error", err)
+		return
+	}
+	if version == w.appVersion {
+		w.updatePlan(ctx)
+		return
+	}
+
+	fromHeight := w.upgradeHeight()
+	slog.Info("Chain upgrade detected, reloading the protocol buffer descriptors",
+		"previous_version", w.appVersion, "version", version, "plan", w.planName, "height", fromHeight)
+
+	resolver, err := newResolver(ctx, w.client.Conn, w.cfg)
+	if err != nil {
+		slog.Error("Failed to reload the protocol buffer descriptors after the chain upgrade", "version", version, "error", err)
+		return
+	}
+	w.client.Resolvers.Add(fromHeight, resolver)
+	if w.client.schemas != nil {
+		if err := w.client.schemas.Add(reflection.SchemaBoundary{FromHeight: fromHeight, AppVersion: version}); err != nil {
+			slog.Warn("Failed to write the schema history", "file", w.client.schemas.Path(), "error", err)
+		}
+	}
+
+	w.appVersion = version
+	w.planName, w.planHeight = "", 0
+	slog.Info("Protocol buffer descriptors reloaded", "version", version, "height", fromHeight)
+}
+
+// newResolverHistory returns the history of the resolvers of the nodes, ending with the given resolver of their
+// current schema. When the descriptor cache is enabled, the resolvers of the previous schemas are rebuilt from the
+// schema history file and the descriptor cache files of their application versions, so that the blocks extracted
+// after a restart are still decoded with the schema of their height. The returned history file is nil if disabled.
+func newResolverHistory(ctx context.Context, conn grpc.ClientConnInterface, cfg Config, resolver *reflection.CustomResolver) (*reflection.ResolverHistory, *reflection.SchemaHistoryFile) {
+	if cfg.DescriptorCacheDir == "" {
+		return reflection.NewResolverHistory(resolver), nil
+	}
+
+	chainID, appVersion, err := nodeInfo(ctx, conn)
+	if err != nil {
+		slog.Warn("Failed to get the node version, schema history disabled", "error", err)
+		return reflection.NewResolverHistory(resolver), nil
+	}
+
+	schemas := reflection.NewSchemaHistoryFile(cfg.DescriptorCacheDir, cfg.Addresses, chainID)
+	boundaries, err := schemas.Load()
+	if err != nil {
+		slog.Warn("Failed to load the schema history", "file", schemas.Path(), "error", err)
+	}
+
+	current := -1
+	for i, boundary := range boundaries {
+		if boundary.AppVersion == appVersion {
+			current = i
+		}
+	}
+	if current < 0 {
+		// The height of an upgrade made while yaci was stopped is unknown, the previous schemas cannot be placed
+		if len(boundaries) > 0 {
+			slog.Warn("The nodes were upgraded since the last run, the previous schemas are not used",
+				"version", appVersion, "previous_version", boundaries[len(boundaries)-1].AppVersion)
+		}
+		if err := schemas.Add(reflection.SchemaBoundary{FromHeight: 0, AppVersion: appVersion}); err != nil {
+			slog.Warn("Failed to write the schema history", "file", schemas.Path(), "error", err)
+		}
+		return reflection.NewResolverHistory(resolver), schemas
+	}
+
+	// The first rebuilt resolver also applies to the heights below its boundary
+	var history *reflection.ResolverHistory
+	for _, boundary := range boundaries[:current] {
+		previous, err := cachedResolver(ctx, conn, cfg, chainID, boundary.AppVersion)
+		if err != nil {
+			slog.Warn("Failed to rebuild the resolver of a previous schema", "version", boundary.AppVersion, "height", boundary.FromHeight, "error", err)
+			continue
+		}
+		if history == nil {
+			history = reflection.NewResolverHistory(previous)
+		} else {
+			history.Add(boundary.FromHeight, previous)
+		}
+		slog.Info("Rebuilt the resolver of a previous schema", "version", boundary.AppVersion, "height", boundary.FromHeight)
+	}
+	if history == nil {
+		return reflection.NewResolverHistory(resolver), schemas
+	}
+	history.Add(boundaries[current].FromHeight, resolver)
+	return history, schemas
+}
+
+// cachedResolver returns the resolver of a previous schema of the nodes, built from the descriptor sets and the
+// descriptors cached for its application version. Reflection is not used, as the nodes serve their current schema.
+func cachedResolver(ctx context.Context, conn grpc.ClientConnInterface, cfg Config, chainID, appVersion string) (*reflection.CustomResolver, error) {
+	offline, err := reflection.LoadDescriptorSets(cfg.DescriptorSets)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := reflection.NewDescriptorCache(cfg.DescriptorCacheDir, cfg.Addresses, chainID, appVersion)
+	cached, err := cache.Load()
+	if err != nil {
+		return nil, err
+	}
+	if len(cached) == 0 {
+		return nil, fmt.Errorf("no cached descriptors in %s", cache.Path())
+	}
+
+	files, err := reflection.BuildFileDescriptorSet(append(offline, withoutDescriptors(cached, descriptorNames(offline))...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build descriptor set: %w", err)
+	}
+	// The resolver is not given the cache, so that the descriptors missing from the previous schema, fetched from
+	// the nodes on demand, are not cached for its version
+	return reflection.NewCustomResolver(ctx, files, conn, cfg.RetryPolicy, 3, nil), nil
+}
+
+// upgradeHeight returns the first height of the new schema.
+func (w *upgradeWatcher) upgradeHeight() uint64 {
+	if w.planHeight > 0 {
+		return w.planHeight
+	}
+	return w.lastHeight + 1
+}
+
+// updatePlan records the latest height of the nodes and their pending upgrade plan, if any.
+func (w *upgradeWatcher) updatePlan(ctx context.Context) {
+	if height, err := latestHeight(ctx, w.client.Conn); err == nil {
+		w.lastHeight = height
+	}
+
+	name, height, err := currentPlan(ctx, w.client.Conn)
+	if err != nil {
+		slog.Debug("Failed to get the upgrade plan", "error", err)
+		return
+	}
+	if height > 0 && height != w.planHeight {
+		slog.Info("Chain upgrade planned", "plan", name, "height", height)
+	}
+	w.planName, w.planHeight = name, height
+}
+
+func (w *upgradeWatcher) nodeVersion(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	_, version, err := nodeInfo(ctx, w.client.Conn)
+	return version, err
+}
+
+// currentPlan queries the name and height of the pending upgrade plan, or a zero height if none.
+// Like nodeInfo, the response is decoded without its message type.
+func currentPlan(ctx context.Context, conn grpc.ClientConnInterface) (string, uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var reply emptypb.Empty
+	if err := conn.Invoke(ctx, currentPlanMethod, &emptypb.Empty{}, &reply); err != nil {
+		return "", 0, err
+	}
+
+	plan, err := bytesField(reply.ProtoReflect().GetUnknown(), currentPlanPlanField)
+	if err != nil {
+		return "", 0, err
+	}
+	name, err := bytesField(plan, planNameField)
+	if err != nil {
+		return "", 0, err
+	}
+	height, err := varintField(plan, planHeightField)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(name), height, nil
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/retry"
+)
+
+// upgradingNode answers the node info, upgrade plan and status methods, without reflection.
+type upgradingNode struct {
+	version    atomic.Value
+	height     atomic.Uint64
+	planHeight atomic.Uint64
+}
+
+func (n *upgradingNode) handle(_ any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+		return err
+	}
+
+	var b []byte
+	switch method {
+	case nodeInfoMethod:
+		defaultNodeInfo := protowire.AppendString(protowire.AppendTag(nil, defaultNodeInfoNetworkField, protowire.BytesType), "manifest-1")
+		applicationVersion := protowire.AppendString(protowire.AppendTag(nil, versionInfoVersionField, protowire.BytesType), n.version.Load().(string))
+		b = protowire.AppendBytes(protowire.AppendTag(nil, nodeInfoDefaultNodeInfoField, protowire.BytesType), defaultNodeInfo)
+		b = protowire.AppendBytes(protowire.AppendTag(b, nodeInfoApplicationVersionField, protowire.BytesType), applicationVersion)
+	case currentPlanMethod:
+		if height := n.planHeight.Load(); height > 0 {
+			plan := protowire.AppendString(protowire.AppendTag(nil, planNameField, protowire.BytesType), "v2")
+			plan = protowire.AppendVarint(protowire.AppendTag(plan, planHeightField, protowire.VarintType), height)
+			b = protowire.AppendBytes(protowire.AppendTag(nil, currentPlanPlanField, protowire.BytesType), plan)
+		}
+	case statusMethod:
+		b = protowire.AppendVarint(protowire.AppendTag(nil, statusHeightField, protowire.VarintType), n.height.Load())
+	default:
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+
+	reply := &emptypb.Empty{}
+	reply.ProtoReflect().SetUnknown(b)
+	return stream.SendMsg(reply)
+}
+
+func newUpgradeTestClient(t *testing.T, node *upgradingNode) (*GRPCClient, Config) {
+	content, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{Name: proto.String("chain.proto")}}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "chain.binpb")
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(grpc.UnknownServiceHandler(node.handle))
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///node", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	cfg := Config{DescriptorSets: []string{path}, RetryPolicy: retry.DefaultPolicy()}
+	resolver, err := newResolver(context.Background(), conn, cfg)
+	require.NoError(t, err)
+	return &GRPCClient{Ctx: context.Background(), Conn: conn, Resolvers: reflection.NewResolverHistory(resolver)}, cfg
+}
+
+func TestUpgradeWatcher(t *testing.T) {
+	node := &upgradingNode{}
+	node.version.Store("v1.0.0")
+	node.height.Store(120)
+	gRPCClient, cfg := newUpgradeTestClient(t, node)
+	initial := gRPCClient.Resolvers.Latest()
+
+	w := newUpgradeWatcher(gRPCClient, cfg)
+	w.appVersion = "v1.0.0"
+
+	// No upgrade
+	w.check(context.Background())
+	assert.Same(t, initial, gRPCClient.Resolvers.Latest())
+
+	// The plan is seen before the upgrade: the new schema applies from its height
+	node.planHeight.Store(150)
+	w.check(context.Background())
+	node.version.Store("v2.0.0")
+	node.planHeight.Store(0)
+	w.check(context.Background())
+
+	assert.Equal(t, "v2.0.0", w.appVersion)
+	assert.Same(t, initial, gRPCClient.Resolvers.At(149))
+	upgraded := gRPCClient.Resolvers.At(150)
+	assert.NotSame(t, initial, upgraded)
+	assert.Same(t, upgraded, gRPCClient.Resolvers.Latest())
+
+	// The client resolves with the schema of the height of its context
+	assert.Same(t, initial, gRPCClient.WithContext(WithHeight(context.Background(), 140)).Resolver())
+	assert.Same(t, upgraded, gRPCClient.Resolver())
+
+	// Without plan, the new schema applies from the height following the last check before the upgrade
+	node.height.Store(300)
+	w.check(context.Background())
+	node.version.Store("v3.0.0")
+	node.height.Store(310)
+	w.check(context.Background())
+	assert.Same(t, upgraded, gRPCClient.Resolvers.At(300))
+	assert.NotSame(t, upgraded, gRPCClient.Resolvers.At(301))
+}
+
+func TestResolverHistoryRebuiltFromCache(t *testing.T) {
+	node := &upgradingNode{}
+	node.version.Store("v2.0.0")
+	node.height.Store(200)
+	gRPCClient, cfg := newUpgradeTestClient(t, node)
+	cfg.DescriptorCacheDir = t.TempDir()
+
+	// The previous run cached the descriptors of v1, and recorded the upgrade to v2 at height 150
+	v1 := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("v1.proto"),
+		Package:     proto.String("v1"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Msg")}},
+	}
+	require.NoError(t, reflection.NewDescriptorCache(cfg.DescriptorCacheDir, cfg.Addresses, "manifest-1", "v1.0.0").Add(v1))
+	schemas := reflection.NewSchemaHistoryFile(cfg.DescriptorCacheDir, cfg.Addresses, "manifest-1")
+	require.NoError(t, schemas.Add(reflection.SchemaBoundary{FromHeight: 0, AppVersion: "v1.0.0"}))
+	require.NoError(t, schemas.Add(reflection.SchemaBoundary{FromHeight: 150, AppVersion: "v2.0.0"}))
+
+	current, err := newResolver(context.Background(), gRPCClient.Conn, cfg)
+	require.NoError(t, err)
+	gRPCClient.Resolvers, gRPCClient.schemas = newResolverHistory(context.Background(), gRPCClient.Conn, cfg, current)
+	require.NotNil(t, gRPCClient.schemas)
+
+	previous := gRPCClient.Resolvers.At(149)
+	assert.NotSame(t, current, previous)
+	_, err = previous.FindMessageByName("v1.Msg")
+	assert.NoError(t, err)
+	assert.Same(t, current, gRPCClient.Resolvers.At(150))
+	assert.Same(t, current, gRPCClient.Resolvers.Latest())
+
+	// The upgrades detected by the watcher are recorded
+	w := newUpgradeWatcher(gRPCClient, cfg)
+	w.appVersion = "v2.0.0"
+	node.planHeight.Store(300)
+	w.check(context.Background())
+	node.version.Store("v3.0.0")
+	w.check(context.Background())
+
+	boundaries, err := reflection.NewSchemaHistoryFile(cfg.DescriptorCacheDir, cfg.Addresses, "manifest-1").Load()
+	require.NoError(t, err)
+	assert.Equal(t, []reflection.SchemaBoundary{
+		{FromHeight: 0, AppVersion: "v1.0.0"},
+		{FromHeight: 150, AppVersion: "v2.0.0"},
+		{FromHeight: 300, AppVersion: "v3.0.0"},
+	}, boundaries)
+
+	// The height of an upgrade made while stopped is unknown: the history starts over with the current schema
+	node.version.Store("v4.0.0")
+	resolvers, schemas := newResolverHistory(context.Background(), gRPCClient.Conn, cfg, current)
+	assert.Same(t, current, resolvers.At(1))
+	boundaries, err = schemas.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []reflection.SchemaBoundary{{FromHeight: 0, AppVersion: "v4.0.0"}}, boundaries)
+}
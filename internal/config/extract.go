@@ -2,10 +2,45 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"maps"
 	"net"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/manifest-network/yaci/internal/client"
+	"github.com/manifest-network/yaci/internal/retry"
+)
+
+const (
+	// TxFetchStrategyHash fetches every transaction of a block individually using GetTx.
+	TxFetchStrategyHash = "hash"
+	// TxFetchStrategyHeight fetches all the transactions of a block at once using GetTxsEvent.
+	// It falls back to TxFetchStrategyHash when GetTxsEvent fails, e.g., when the node has transaction indexing disabled.
+	TxFetchStrategyHeight = "height"
+)
+
+const (
+	// OnReorgHalt stops the extraction when a chain reorganization is detected.
+	OnReorgHalt = "halt"
+	// OnReorgRollback rolls back the diverging blocks from the outputs and extracts them again.
+	OnReorgRollback = "rollback"
+)
+
+const (
+	// OnChainResetHalt stops when the node serves a different chain than the one the output was built from.
+	OnChainResetHalt = "halt"
+	// OnChainResetWipe clears the output, then extracts the new chain.
+	OnChainResetWipe = "wipe"
+	// OnChainResetNewSchema renames the schema of the database to keep its data, then extracts the new chain into a fresh schema.
+	OnChainResetNewSchema = "new-schema"
 )
 
 type ExtractConfig struct {
@@ -20,6 +55,154 @@ type ExtractConfig struct {
 	MaxRecvMsgSize       int
 	EnablePrometheus     bool
 	PrometheusListenAddr string
+	RPCAddress           string
+	TxFetchStrategy      string
+	OnReorg              string
+	OnChainReset         string
+	HealthCheckInterval  time.Duration
+	MaxEndpointLag       uint64
+	MaxEndpointErrorRate float64
+	RetryInitialDelay    time.Duration
+	RetryMultiplier      float64
+	RetryMaxDelay        time.Duration
+	RetryJitter          float64
+	RateLimit            float64
+	AdaptiveConcurrency  bool
+	TargetLatency        time.Duration
+	// The authentication settings are secrets, not logged
+	Headers         []string `json:"-"`
+	BearerToken     string   `json:"-"`
+	BearerTokenFile string
+	TLSCACert       string
+	TLSClientCert   string
+	TLSClientKey    string
+	TLSServerName   string
+	TLSMinVersion   string
+	// DescriptorCacheDir is the directory of the descriptor cache files. The cache is disabled if empty.
+	DescriptorCacheDir string
+	DescriptorSets     []string
+	// UpgradeCheckInterval is the interval between two checks of the application version of the nodes. Disabled if 0.
+	UpgradeCheckInterval time.Duration
+	// RetryCodes overrides the retry rule of gRPC status codes, by code name. It is only read from the config file.
+	RetryCodes map[string]RetryCodeConfig
+}
+
+// RetryCodeConfig overrides the retry rule of a gRPC status code. The unset values are inherited from the default rule.
+type RetryCodeConfig struct {
+	Action       string        `mapstructure:"action"`
+	InitialDelay time.Duration `mapstructure:"initial-delay"`
+	Multiplier   float64       `mapstructure:"multiplier"`
+	MaxDelay     time.Duration `mapstructure:"max-delay"`
+	Jitter       *float64      `mapstructure:"jitter"`
+}
+
+// RetryPolicy builds the retry policy of the gRPC calls: the default policy, with the configured default rule,
+// overridden by the rules of the configured status codes.
+func (c ExtractConfig) RetryPolicy() (retry.Policy, error) {
+	policy := retry.DefaultPolicy()
+	apply := func(rule retry.Rule) retry.Rule {
+		rule.InitialDelay = c.RetryInitialDelay
+		rule.Multiplier = c.RetryMultiplier
+		rule.MaxDelay = c.RetryMaxDelay
+		rule.Jitter = c.RetryJitter
+		return rule
+	}
+	policy.Default = apply(policy.Default)
+	for code, rule := range policy.Codes {
+		policy.Codes[code] = apply(rule)
+	}
+
+	for name, override := range c.RetryCodes {
+		code, ok := parseCode(name)
+		if !ok {
+			return policy, fmt.Errorf("invalid gRPC status code in retry-codes: %s", name)
+		}
+
+		rule := policy.Rule(status.Error(code, ""))
+		if override.Action != "" {
+			rule.Action = retry.Action(override.Action)
+		}
+		if override.InitialDelay != 0 {
+			rule.InitialDelay = override.InitialDelay
+		}
+		if override.Multiplier != 0 {
+			rule.Multiplier = override.Multiplier
+		}
+		if override.MaxDelay != 0 {
+			rule.MaxDelay = override.MaxDelay
+		}
+		if override.Jitter != nil {
+			rule.Jitter = *override.Jitter
+		}
+		policy.Codes[code] = rule
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// AuthHeaders parses the metadata headers attached to every gRPC call, given as key=value.
+// The keys are lowercased, as required by gRPC.
+func (c ExtractConfig) AuthHeaders() (map[string]string, error) {
+	headers := make(map[string]string, len(c.Headers))
+	for _, header := range c.Headers {
+		key, value, found := strings.Cut(header, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !found {
+			return nil, fmt.Errorf("invalid header: %s, expected key=value", header)
+		}
+		if key == "" {
+			return nil, fmt.Errorf("header key must not be empty")
+		}
+		if strings.ContainsFunc(key, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+		}) {
+			return nil, fmt.Errorf("invalid header key: %s", key)
+		}
+		if key == "authorization" && (c.BearerToken != "" || c.BearerTokenFile != "") {
+			return nil, fmt.Errorf("cannot set the authorization header and a bearer token together")
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// AuthConfig returns the metadata attached to the gRPC calls and to the CometBFT RPC calls.
+func (c ExtractConfig) AuthConfig() (client.AuthConfig, error) {
+	headers, err := c.AuthHeaders()
+	if err != nil {
+		return client.AuthConfig{}, err
+	}
+	return client.AuthConfig{
+		Headers:         headers,
+		BearerToken:     c.BearerToken,
+		BearerTokenFile: c.BearerTokenFile,
+	}, nil
+}
+
+// TLSConfig returns the TLS settings of the connections to the gRPC and CometBFT RPC servers.
+func (c ExtractConfig) TLSConfig() client.TLSConfig {
+	return client.TLSConfig{
+		CACert:     c.TLSCACert,
+		ClientCert: c.TLSClientCert,
+		ClientKey:  c.TLSClientKey,
+		ServerName: c.TLSServerName,
+		MinVersion: c.TLSMinVersion,
+	}
+}
+
+// parseCode parses a gRPC status code name, e.g., NotFound or NOT_FOUND, case-insensitively.
+// The config file keys are lowercased, so the names cannot be matched exactly.
+func parseCode(name string) (codes.Code, bool) {
+	normalized := strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if strings.ToLower(code.String()) == normalized {
+			return code, true
+		}
+	}
+	return 0, false
 }
 
 func (c ExtractConfig) Validate() error {
@@ -41,6 +224,99 @@ func (c ExtractConfig) Validate() error {
 			return fmt.Errorf("invalid host in prometheus-addr: %s", host)
 		}
 	}
+
+	if c.RPCAddress != "" {
+		if scheme, _, found := strings.Cut(c.RPCAddress, "://"); found && scheme != "http" && scheme != "https" {
+			return fmt.Errorf("invalid scheme in rpc-address: %s, expected http or https", scheme)
+		}
+	}
+
+	if c.TxFetchStrategy != TxFetchStrategyHash && c.TxFetchStrategy != TxFetchStrategyHeight {
+		return fmt.Errorf("invalid tx-fetch-strategy: %s, expected %s or %s", c.TxFetchStrategy, TxFetchStrategyHash, TxFetchStrategyHeight)
+	}
+
+	if c.OnReorg != OnReorgHalt && c.OnReorg != OnReorgRollback {
+		return fmt.Errorf("invalid on-reorg: %s, expected %s or %s", c.OnReorg, OnReorgHalt, OnReorgRollback)
+	}
+
+	switch c.OnChainReset {
+	case OnChainResetHalt, OnChainResetWipe, OnChainResetNewSchema:
+	default:
+		return fmt.Errorf("invalid on-chain-reset: %s, expected %s, %s or %s", c.OnChainReset, OnChainResetHalt, OnChainResetWipe, OnChainResetNewSchema)
+	}
+
+	if c.HealthCheckInterval <= 0 {
+		return fmt.Errorf("health-check-interval must be greater than 0")
+	}
+
+	if c.MaxEndpointErrorRate < 0 || c.MaxEndpointErrorRate > 1 {
+		return fmt.Errorf("max-endpoint-error-rate must be between 0 and 1")
+	}
+
+	if c.RateLimit < 0 {
+		return fmt.Errorf("rate-limit must not be negative")
+	}
+
+	if c.AdaptiveConcurrency && c.TargetLatency <= 0 {
+		return fmt.Errorf("target-latency must be greater than 0")
+	}
+
+	if _, err := c.AuthHeaders(); err != nil {
+		return err
+	}
+
+	if c.BearerToken != "" && c.BearerTokenFile != "" {
+		return fmt.Errorf("cannot set bearer-token and bearer-token-file together")
+	}
+
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+
+	if c.UpgradeCheckInterval < 0 {
+		return fmt.Errorf("upgrade-check-interval must not be negative")
+	}
+
+	for _, file := range c.DescriptorSets {
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("invalid descriptor-set: %w", err)
+		}
+	}
+
+	if _, err := c.RetryPolicy(); err != nil {
+		return fmt.Errorf("invalid retry policy: %w", err)
+	}
+
+	return nil
+}
+
+// validateTLS checks the TLS settings, and that the certificate files exist.
+func (c ExtractConfig) validateTLS() error {
+	if c.Insecure && (c.TLSCACert != "" || c.TLSClientCert != "" || c.TLSClientKey != "" || c.TLSServerName != "") {
+		return fmt.Errorf("cannot set --insecure and TLS flags together")
+	}
+
+	if (c.TLSClientCert == "") != (c.TLSClientKey == "") {
+		return fmt.Errorf("tls-client-cert and tls-client-key must be set together")
+	}
+
+	for flag, file := range map[string]string{
+		"tls-ca-cert":     c.TLSCACert,
+		"tls-client-cert": c.TLSClientCert,
+		"tls-client-key":  c.TLSClientKey,
+	} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("invalid %s: %w", flag, err)
+		}
+	}
+
+	if _, ok := client.TLSVersions[c.TLSMinVersion]; !ok {
+		return fmt.Errorf("invalid tls-min-version: %s, expected one of %s", c.TLSMinVersion, strings.Join(slices.Sorted(maps.Keys(client.TLSVersions)), ", "))
+	}
+
 	return nil
 }
 
@@ -57,5 +333,40 @@ func LoadExtractConfigFromCLI() ExtractConfig {
 		MaxRecvMsgSize:       viper.GetInt("max-recv-msg-size"),
 		EnablePrometheus:     viper.GetBool("enable-prometheus"),
 		PrometheusListenAddr: viper.GetString("prometheus-addr"),
+		RPCAddress:           viper.GetString("rpc-address"),
+		TxFetchStrategy:      viper.GetString("tx-fetch-strategy"),
+		OnReorg:              viper.GetString("on-reorg"),
+		OnChainReset:         viper.GetString("on-chain-reset"),
+		HealthCheckInterval:  viper.GetDuration("health-check-interval"),
+		MaxEndpointLag:       viper.GetUint64("max-endpoint-lag"),
+		MaxEndpointErrorRate: viper.GetFloat64("max-endpoint-error-rate"),
+		RetryInitialDelay:    viper.GetDuration("retry-initial-delay"),
+		RetryMultiplier:      viper.GetFloat64("retry-multiplier"),
+		RetryMaxDelay:        viper.GetDuration("retry-max-delay"),
+		RetryJitter:          viper.GetFloat64("retry-jitter"),
+		RateLimit:            viper.GetFloat64("rate-limit"),
+		AdaptiveConcurrency:  viper.GetBool("adaptive-concurrency"),
+		TargetLatency:        viper.GetDuration("target-latency"),
+		Headers:              viper.GetStringSlice("header"),
+		BearerToken:          viper.GetString("bearer-token"),
+		BearerTokenFile:      viper.GetString("bearer-token-file"),
+		TLSCACert:            viper.GetString("tls-ca-cert"),
+		TLSClientCert:        viper.GetString("tls-client-cert"),
+		TLSClientKey:         viper.GetString("tls-client-key"),
+		TLSServerName:        viper.GetString("tls-server-name"),
+		TLSMinVersion:        viper.GetString("tls-min-version"),
+		DescriptorCacheDir:   viper.GetString("descriptor-cache-dir"),
+		DescriptorSets:       viper.GetStringSlice("descriptor-set"),
+		UpgradeCheckInterval: viper.GetDuration("upgrade-check-interval"),
+		RetryCodes:           loadRetryCodes(),
+	}
+}
+
+// loadRetryCodes reads the retry rules of the status codes from the retry-codes section of the config file.
+func loadRetryCodes() map[string]RetryCodeConfig {
+	var retryCodes map[string]RetryCodeConfig
+	if err := viper.UnmarshalKey("retry-codes", &retryCodes); err != nil {
+		slog.Error("Failed to read retry-codes", "error", err)
 	}
+	return retryCodes
 }
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+type JSONLConfig struct {
+	Dir         string
+	Compression string
+	MaxFileSize uint
+}
+
+func (c JSONLConfig) Validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("missing JSON Lines output directory")
+	}
+
+	if c.MaxFileSize == 0 {
+		return fmt.Errorf("jsonl-max-file-size must be greater than 0")
+	}
+
+	return nil
+}
+
+// MaxFileSizeBytes returns the maximum uncompressed size of a data file, in bytes.
+func (c JSONLConfig) MaxFileSizeBytes() int64 {
+	return int64(c.MaxFileSize) * 1024 * 1024
+}
+
+func LoadJSONLConfigFromCLI() JSONLConfig {
+	return JSONLConfig{
+		Dir:         viper.GetString("jsonl-dir"),
+		Compression: viper.GetString("jsonl-compression"),
+		MaxFileSize: viper.GetUint("jsonl-max-file-size"),
+	}
+}
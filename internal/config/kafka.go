@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/manifest-network/yaci/internal/client"
+)
+
+// Supported Kafka SASL mechanisms
+const (
+	KafkaSASLPlain       = "PLAIN"
+	KafkaSASLScramSHA256 = "SCRAM-SHA-256"
+	KafkaSASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+var kafkaSASLMechanisms = []string{KafkaSASLPlain, KafkaSASLScramSHA256, KafkaSASLScramSHA512}
+
+type KafkaConfig struct {
+	Brokers            []string
+	BlocksTopic        string
+	TransactionsTopic  string
+	BlockResultsTopic  string
+	CheckpointTopic    string
+	CheckpointKey      string
+	CheckpointInterval time.Duration
+	CreateTopics       bool
+	Timeout            time.Duration
+	// TLS enables TLS, using the TLS* settings
+	TLS           bool
+	TLSCACert     string
+	TLSClientCert string
+	TLSClientKey  string
+	TLSServerName string
+	// SASLMechanism enables the SASL authentication, one of the KafkaSASL* mechanisms. Disabled if empty.
+	SASLMechanism string
+	SASLUsername  string
+	// The password is a secret, not logged
+	SASLPassword string `json:"-"`
+}
+
+// TLSConfig returns the TLS settings of the connections to the brokers.
+func (c KafkaConfig) TLSConfig() client.TLSConfig {
+	return client.TLSConfig{
+		CACert:     c.TLSCACert,
+		ClientCert: c.TLSClientCert,
+		ClientKey:  c.TLSClientKey,
+		ServerName: c.TLSServerName,
+	}
+}
+
+func (c KafkaConfig) Validate() error {
+	if len(c.Brokers) == 0 {
+		return fmt.Errorf("missing Kafka brokers")
+	}
+
+	for _, broker := range c.Brokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			return fmt.Errorf("invalid Kafka broker address %s, expected host:port: %w", broker, err)
+		}
+	}
+
+	topics := []struct{ flag, topic string }{
+		{"kafka-blocks-topic", c.BlocksTopic},
+		{"kafka-transactions-topic", c.TransactionsTopic},
+		{"kafka-block-results-topic", c.BlockResultsTopic},
+		{"kafka-checkpoint-topic", c.CheckpointTopic},
+	}
+	for _, t := range topics {
+		if t.topic == "" {
+			return fmt.Errorf("%s cannot be empty", t.flag)
+		}
+	}
+
+	if c.CheckpointKey == "" {
+		return fmt.Errorf("kafka-checkpoint-key cannot be empty")
+	}
+
+	if c.CheckpointInterval < 0 {
+		return fmt.Errorf("kafka-checkpoint-interval cannot be negative")
+	}
+
+	if c.Timeout <= 0 {
+		return fmt.Errorf("kafka-timeout must be greater than 0")
+	}
+
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+
+	if c.SASLMechanism != "" {
+		if !slices.Contains(kafkaSASLMechanisms, c.SASLMechanism) {
+			return fmt.Errorf("invalid kafka-sasl-mechanism: %s, expected one of %s", c.SASLMechanism, strings.Join(kafkaSASLMechanisms, ", "))
+		}
+		if c.SASLUsername == "" || c.SASLPassword == "" {
+			return fmt.Errorf("kafka-sasl-username and kafka-sasl-password are required with kafka-sasl-mechanism")
+		}
+	} else if c.SASLUsername != "" || c.SASLPassword != "" {
+		return fmt.Errorf("kafka-sasl-username and kafka-sasl-password require kafka-sasl-mechanism")
+	}
+
+	return nil
+}
+
+// validateTLS checks the TLS settings, and that the certificate files exist.
+func (c KafkaConfig) validateTLS() error {
+	files := map[string]string{
+		"kafka-tls-ca-cert":     c.TLSCACert,
+		"kafka-tls-client-cert": c.TLSClientCert,
+		"kafka-tls-client-key":  c.TLSClientKey,
+	}
+
+	if !c.TLS {
+		for _, flag := range slices.Sorted(maps.Keys(files)) {
+			if files[flag] != "" {
+				return fmt.Errorf("%s requires kafka-tls", flag)
+			}
+		}
+		if c.TLSServerName != "" {
+			return fmt.Errorf("kafka-tls-server-name requires kafka-tls")
+		}
+		return nil
+	}
+
+	if (c.TLSClientCert == "") != (c.TLSClientKey == "") {
+		return fmt.Errorf("kafka-tls-client-cert and kafka-tls-client-key must be set together")
+	}
+
+	for flag, file := range files {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("invalid %s: %w", flag, err)
+		}
+	}
+
+	return nil
+}
+
+func LoadKafkaConfigFromCLI() KafkaConfig {
+	return KafkaConfig{
+		Brokers:            viper.GetStringSlice("kafka-brokers"),
+		BlocksTopic:        viper.GetString("kafka-blocks-topic"),
+		TransactionsTopic:  viper.GetString("kafka-transactions-topic"),
+		BlockResultsTopic:  viper.GetString("kafka-block-results-topic"),
+		CheckpointTopic:    viper.GetString("kafka-checkpoint-topic"),
+		CheckpointKey:      viper.GetString("kafka-checkpoint-key"),
+		CheckpointInterval: viper.GetDuration("kafka-checkpoint-interval"),
+		CreateTopics:       viper.GetBool("kafka-create-topics"),
+		Timeout:            viper.GetDuration("kafka-timeout"),
+		TLS:                viper.GetBool("kafka-tls"),
+		TLSCACert:          viper.GetString("kafka-tls-ca-cert"),
+		TLSClientCert:      viper.GetString("kafka-tls-client-cert"),
+		TLSClientKey:       viper.GetString("kafka-tls-client-key"),
+		TLSServerName:      viper.GetString("kafka-tls-server-name"),
+		SASLMechanism:      viper.GetString("kafka-sasl-mechanism"),
+		SASLUsername:       viper.GetString("kafka-sasl-username"),
+		SASLPassword:       viper.GetString("kafka-sasl-password"),
+	}
+}
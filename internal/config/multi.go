@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Outputs selectable with the multi subcommand. They are named after their subcommand.
+const (
+	OutputPostgres = "postgres"
+	OutputJSONL    = "jsonl"
+	OutputParquet  = "parquet"
+	OutputSQLite   = "sqlite"
+	OutputKafka    = "kafka"
+)
+
+var Outputs = []string{OutputPostgres, OutputJSONL, OutputParquet, OutputSQLite, OutputKafka}
+
+const (
+	// OutputModeAllOrNothing fails the write of a block when any output fails to write it.
+	// The extraction stops, and the next run resumes from the laggiest output.
+	OutputModeAllOrNothing = "all-or-nothing"
+	// OutputModeBestEffort only fails the write of a block when all the outputs fail to write it.
+	// The blocks an output failed to write are reported as missing by that output on the next run.
+	OutputModeBestEffort = "best-effort"
+)
+
+type MultiConfig struct {
+	Outputs    []string
+	OutputMode string
+}
+
+func (c MultiConfig) Validate() error {
+	if len(c.Outputs) == 0 {
+		return fmt.Errorf("missing outputs, set --output at least once")
+	}
+
+	seen := make(map[string]bool, len(c.Outputs))
+	for _, output := range c.Outputs {
+		if !slices.Contains(Outputs, output) {
+			return fmt.Errorf("unsupported output %s, expected one of %s", output, strings.Join(Outputs, ", "))
+		}
+		if seen[output] {
+			return fmt.Errorf("duplicate output %s", output)
+		}
+		seen[output] = true
+	}
+
+	return ValidateOutputMode(c.OutputMode)
+}
+
+// ValidateOutputMode returns an error if the output mode of the multi subcommand is not supported.
+func ValidateOutputMode(mode string) error {
+	switch mode {
+	case OutputModeAllOrNothing, OutputModeBestEffort:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output mode %s, expected %s or %s", mode, OutputModeAllOrNothing, OutputModeBestEffort)
+	}
+}
+
+func LoadMultiConfigFromCLI() MultiConfig {
+	return MultiConfig{
+		Outputs:    viper.GetStringSlice("output"),
+		OutputMode: viper.GetString("output-mode"),
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+type ParquetConfig struct {
+	Dir           string
+	Compression   string
+	PartitionSize uint64
+}
+
+func (c ParquetConfig) Validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("missing Parquet output directory")
+	}
+
+	if c.PartitionSize == 0 {
+		return fmt.Errorf("parquet-partition-size must be greater than 0")
+	}
+
+	return nil
+}
+
+func LoadParquetConfigFromCLI() ParquetConfig {
+	return ParquetConfig{
+		Dir:           viper.GetString("parquet-dir"),
+		Compression:   viper.GetString("parquet-compression"),
+		PartitionSize: viper.GetUint64("parquet-partition-size"),
+	}
+}
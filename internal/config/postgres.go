@@ -2,13 +2,17 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/spf13/viper"
 )
 
 type PostgresConfig struct {
-	ConnString string
+	ConnString      string
+	SkipSchemaCheck bool
+	BatchSize       uint
+	FlushInterval   time.Duration
 }
 
 func (c PostgresConfig) Validate() error {
@@ -21,11 +25,22 @@ func (c PostgresConfig) Validate() error {
 		return fmt.Errorf("failed to parse PostgreSQL connection string: %w", err)
 	}
 
+	if c.BatchSize == 0 {
+		return fmt.Errorf("postgres-batch-size must be greater than 0")
+	}
+
+	if c.BatchSize > 1 && c.FlushInterval <= 0 {
+		return fmt.Errorf("postgres-flush-interval must be greater than 0")
+	}
+
 	return nil
 }
 
 func LoadPostgresConfigFromCLI() PostgresConfig {
 	return PostgresConfig{
-		ConnString: viper.GetString("postgres-conn"),
+		ConnString:      viper.GetString("postgres-conn"),
+		SkipSchemaCheck: viper.GetBool("skip-schema-check"),
+		BatchSize:       viper.GetUint("postgres-batch-size"),
+		FlushInterval:   viper.GetDuration("postgres-flush-interval"),
 	}
 }
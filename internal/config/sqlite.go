@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type SQLiteConfig struct {
+	Path          string
+	BatchSize     uint
+	FlushInterval time.Duration
+}
+
+func (c SQLiteConfig) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("missing SQLite database path")
+	}
+
+	if c.BatchSize == 0 {
+		return fmt.Errorf("sqlite-batch-size must be greater than 0")
+	}
+
+	if c.FlushInterval <= 0 {
+		return fmt.Errorf("sqlite-flush-interval must be greater than 0")
+	}
+
+	return nil
+}
+
+func LoadSQLiteConfigFromCLI() SQLiteConfig {
+	return SQLiteConfig{
+		Path:          viper.GetString("sqlite-path"),
+		BatchSize:     viper.GetUint("sqlite-batch-size"),
+		FlushInterval: viper.GetDuration("sqlite-flush-interval"),
+	}
+}
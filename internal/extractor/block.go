@@ -2,22 +2,28 @@ package extractor
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/manifest-network/yaci/internal/client"
 	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/metrics"
 	"github.com/manifest-network/yaci/internal/models"
 	"github.com/manifest-network/yaci/internal/output"
+	"github.com/manifest-network/yaci/internal/retry"
 	"github.com/manifest-network/yaci/internal/utils"
 	"github.com/schollz/progressbar/v3"
 	"golang.org/x/sync/errgroup"
 )
 
 // extractBlocksAndTransactions extracts blocks and transactions from the gRPC server.
-func extractBlocksAndTransactions(gRPCClient *client.GRPCClient, start, stop uint64, outputHandler output.OutputHandler, maxConcurrency, maxRetries uint) error {
+func extractBlocksAndTransactions(gRPCClient *client.GRPCClient, rpcClient *client.RPCClient, txs *txFetcher, start, stop uint64, outputHandler output.OutputHandler, limiter *concurrencyLimiter, cfg config.ExtractConfig) error {
 	displayProgress := start != stop
 	if displayProgress {
 		slog.Info("Extracting blocks and transactions", "range", fmt.Sprintf("[%d, %d]", start, stop))
@@ -46,10 +52,17 @@ func extractBlocksAndTransactions(gRPCClient *client.GRPCClient, start, stop uin
 		}
 	}
 
-	if err := processBlocks(gRPCClient, start, stop, outputHandler, maxConcurrency, maxRetries, bar); err != nil {
+	if err := processBlocks(gRPCClient, rpcClient, txs, start, stop, outputHandler, limiter, cfg, bar); err != nil {
 		return fmt.Errorf("failed to process blocks and transactions: %w", err)
 	}
 
+	// Write the buffered blocks, so that the blocks of the range are visible before the next range is extracted
+	if flusher, ok := outputHandler.(output.Flusher); ok {
+		if err := flusher.Flush(gRPCClient.Ctx); err != nil {
+			return fmt.Errorf("failed to flush blocks: %w", err)
+		}
+	}
+
 	if bar != nil {
 		if err := bar.Finish(); err != nil {
 			return fmt.Errorf("failed to finish progress bar: %w", err)
@@ -60,7 +73,7 @@ func extractBlocksAndTransactions(gRPCClient *client.GRPCClient, start, stop uin
 }
 
 // processMissingBlocks processes missing blocks by fetching them from the gRPC server.
-func processMissingBlocks(gRPCClient *client.GRPCClient, outputHandler output.OutputHandler, cfg config.ExtractConfig) error {
+func processMissingBlocks(gRPCClient *client.GRPCClient, rpcClient *client.RPCClient, txs *txFetcher, outputHandler output.OutputHandler, cfg config.ExtractConfig) error {
 	missingBlockIds, err := outputHandler.GetMissingBlockIds(gRPCClient.Ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get missing block IDs: %w", err)
@@ -69,7 +82,7 @@ func processMissingBlocks(gRPCClient *client.GRPCClient, outputHandler output.Ou
 	if len(missingBlockIds) > 0 {
 		slog.Warn("Missing blocks detected", "count", len(missingBlockIds))
 		for _, blockID := range missingBlockIds {
-			if err := processSingleBlockWithRetry(gRPCClient, blockID, outputHandler, cfg.MaxRetries); err != nil {
+			if err := processSingleBlockWithRetry(gRPCClient, rpcClient, txs, blockID, outputHandler, cfg); err != nil {
 				return fmt.Errorf("failed to process missing block %d: %w", blockID, err)
 			}
 		}
@@ -77,10 +90,10 @@ func processMissingBlocks(gRPCClient *client.GRPCClient, outputHandler output.Ou
 	return nil
 }
 
-// processBlocks processes blocks in parallel using goroutines.
-func processBlocks(gRPCClient *client.GRPCClient, start, stop uint64, outputHandler output.OutputHandler, maxConcurrency, maxRetries uint, bar *progressbar.ProgressBar) error {
+// processBlocks processes blocks in parallel using goroutines, as many as allowed by the concurrency limiter.
+// The blocks throttled by the nodes are processed again after a backoff delay instead of aborting the extraction.
+func processBlocks(gRPCClient *client.GRPCClient, rpcClient *client.RPCClient, txs *txFetcher, start, stop uint64, outputHandler output.OutputHandler, limiter *concurrencyLimiter, cfg config.ExtractConfig, bar *progressbar.ProgressBar) error {
 	eg, ctx := errgroup.WithContext(gRPCClient.Ctx)
-	sem := make(chan struct{}, maxConcurrency)
 
 	for height := start; height <= stop; height++ {
 		if ctx.Err() != nil {
@@ -89,18 +102,17 @@ func processBlocks(gRPCClient *client.GRPCClient, start, stop uint64, outputHand
 		}
 
 		blockHeight := height
-		sem <- struct{}{}
-
-		clientWithCtx := &client.GRPCClient{
-			Conn:     gRPCClient.Conn,
-			Ctx:      ctx,
-			Resolver: gRPCClient.Resolver,
+		if err := limiter.acquire(ctx); err != nil {
+			if egErr := eg.Wait(); egErr != nil {
+				return fmt.Errorf("error while fetching blocks: %w", egErr)
+			}
+			return err
 		}
 
-		eg.Go(func() error {
-			defer func() { <-sem }()
+		clientWithCtx := gRPCClient.WithContext(ctx)
 
-			err := processSingleBlockWithRetry(clientWithCtx, blockHeight, outputHandler, maxRetries)
+		eg.Go(func() error {
+			err := processThrottledBlock(clientWithCtx, rpcClient, txs, blockHeight, outputHandler, limiter, cfg)
 			if err != nil {
 				if errors.Is(err, context.Canceled) {
 					return fmt.Errorf("failed to process block %d: %w", blockHeight, err)
@@ -129,16 +141,44 @@ func processBlocks(gRPCClient *client.GRPCClient, start, stop uint64, outputHand
 	return nil
 }
 
+// processThrottledBlock processes a block holding a slot of the limiter, which must be acquired by the caller.
+// When the nodes throttle the calls, it releases the slot, waits for the backoff delay of the retry policy,
+// and processes the block again, up to maxThrottledAttempts times.
+func processThrottledBlock(gRPCClient *client.GRPCClient, rpcClient *client.RPCClient, txs *txFetcher, blockHeight uint64, outputHandler output.OutputHandler, limiter *concurrencyLimiter, cfg config.ExtractConfig) error {
+	for attempt := uint(1); ; attempt++ {
+		begin := time.Now()
+		err := processSingleBlockWithRetry(gRPCClient, rpcClient, txs, blockHeight, outputHandler, cfg)
+		limiter.release(time.Since(begin), err)
+		if !isThrottlingError(err) || attempt == maxThrottledAttempts {
+			return err
+		}
+
+		metrics.ThrottledTotal.Inc()
+		delay := gRPCClient.RetryPolicy.Default.Delay(attempt)
+		slog.Warn("Block processing throttled, retrying", "height", blockHeight, "attempt", attempt, "delay", delay, "concurrency", limiter.current(), "error", err)
+		if err := retry.Sleep(gRPCClient.Ctx, delay); err != nil {
+			return err
+		}
+		if err := limiter.acquire(gRPCClient.Ctx); err != nil {
+			return err
+		}
+	}
+}
+
 // processSingleBlockWithRetry fetches a block and its transactions from the gRPC server with retries.
+// If an RPC client is provided, the block results are fetched as well.
 // It unmarshals the block data and writes it to the output handler.
-func processSingleBlockWithRetry(gRPCClient *client.GRPCClient, blockHeight uint64, outputHandler output.OutputHandler, maxRetries uint) error {
+func processSingleBlockWithRetry(gRPCClient *client.GRPCClient, rpcClient *client.RPCClient, txs *txFetcher, blockHeight uint64, outputHandler output.OutputHandler, cfg config.ExtractConfig) error {
+	// Route the calls of the block to the endpoints serving its height
+	gRPCClient = gRPCClient.WithContext(client.WithHeight(gRPCClient.Ctx, blockHeight))
+
 	blockJsonParams := []byte(fmt.Sprintf(`{"height": %d}`, blockHeight))
 
 	// Get block data with retries
 	blockJsonBytes, err := utils.GetGRPCResponse(
 		gRPCClient,
 		blockMethodFullName,
-		maxRetries,
+		cfg.MaxRetries,
 		blockJsonParams,
 	)
 	if err != nil {
@@ -151,12 +191,22 @@ func processSingleBlockWithRetry(gRPCClient *client.GRPCClient, blockHeight uint
 		Data: blockJsonBytes,
 	}
 
+	// Get block results (FinalizeBlock events, ...) with retries
+	if rpcClient != nil {
+		resultsJsonBytes, err := utils.GetBlockResultsWithRetry(gRPCClient.Ctx, rpcClient, gRPCClient.RetryPolicy, blockHeight, cfg.MaxRetries)
+		if err != nil {
+			return fmt.Errorf("failed to get block results: %w", err)
+		}
+		block.Results = resultsJsonBytes
+	}
+
 	var data map[string]interface{}
 	if err := json.Unmarshal(blockJsonBytes, &data); err != nil {
 		return fmt.Errorf("failed to unmarshal block JSON: %w", err)
 	}
+	block.Hash, block.LastBlockHash = parseBlockHashes(data)
 
-	transactions, err := extractTransactions(gRPCClient, data, maxRetries)
+	transactions, err := txs.fetch(gRPCClient, blockHeight, data)
 	if err != nil {
 		return fmt.Errorf("failed to extract transactions from block: %w", err)
 	}
@@ -169,3 +219,30 @@ func processSingleBlockWithRetry(gRPCClient *client.GRPCClient, blockHeight uint
 
 	return nil
 }
+
+// parseBlockHashes returns the uppercase hex-encoded hashes of the block and of its parent, if present.
+func parseBlockHashes(data map[string]interface{}) (hash, lastBlockHash string) {
+	if blockID, ok := data["blockId"].(map[string]interface{}); ok {
+		hash = base64ToHex(blockID["hash"])
+	}
+	if blockData, ok := data["block"].(map[string]interface{}); ok {
+		if header, ok := blockData["header"].(map[string]interface{}); ok {
+			if lastBlockID, ok := header["lastBlockId"].(map[string]interface{}); ok {
+				lastBlockHash = base64ToHex(lastBlockID["hash"])
+			}
+		}
+	}
+	return hash, lastBlockHash
+}
+
+func base64ToHex(value interface{}) string {
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return ""
+	}
+	return strings.ToUpper(hex.EncodeToString(decoded))
+}
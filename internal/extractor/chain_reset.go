@@ -0,0 +1,48 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/manifest-network/yaci/internal/client"
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/output"
+	"github.com/manifest-network/yaci/internal/utils"
+)
+
+// chainNode queries the chain served by the gRPC server.
+type chainNode struct {
+	gRPCClient *client.GRPCClient
+	maxRetries uint
+}
+
+func (n chainNode) LatestHeight() (uint64, error) {
+	return utils.GetLatestBlockHeightWithRetry(n.gRPCClient, n.maxRetries)
+}
+
+func (n chainNode) EarliestHeight() (uint64, error) {
+	return utils.GetEarliestBlockHeight(n.gRPCClient, n.maxRetries)
+}
+
+func (n chainNode) BlockIdentity(height uint64) (string, string, error) {
+	return utils.GetBlockIdentityWithRetry(n.gRPCClient, height, n.maxRetries)
+}
+
+// checkChainReset verifies that the node serves the chain the output was built from, and handles a chain reset
+// according to the on-chain-reset policy. Only the halt policy is accepted for the outputs not detecting chain resets.
+func checkChainReset(gRPCClient *client.GRPCClient, outputHandler output.OutputHandler, cfg config.ExtractConfig) error {
+	err := output.ErrChainResetUnsupported
+	if checker, ok := outputHandler.(output.ChainResetChecker); ok {
+		node := chainNode{gRPCClient: gRPCClient, maxRetries: cfg.MaxRetries}
+		err = checker.CheckChainReset(gRPCClient.Ctx, node, cfg.OnChainReset)
+	}
+
+	if errors.Is(err, output.ErrChainResetUnsupported) {
+		if cfg.OnChainReset != config.OnChainResetHalt {
+			return fmt.Errorf("on-chain-reset %s is not supported by the output, only the PostgreSQL output detects chain resets", cfg.OnChainReset)
+		}
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,44 @@
+package extractor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/manifest-network/yaci/internal/client"
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+// chainResetOutputHandler records the policies it is checked with.
+type chainResetOutputHandler struct {
+	*memoryOutputHandler
+	policies []string
+	err      error
+}
+
+func (h *chainResetOutputHandler) CheckChainReset(_ context.Context, _ output.ChainNode, policy string) error {
+	h.policies = append(h.policies, policy)
+	return h.err
+}
+
+func TestCheckChainReset(t *testing.T) {
+	gRPCClient := &client.GRPCClient{Ctx: context.Background()}
+
+	// The outputs not detecting chain resets only accept the halt policy
+	out := newMemoryOutputHandler()
+	require.NoError(t, checkChainReset(gRPCClient, out, config.ExtractConfig{OnChainReset: config.OnChainResetHalt}))
+	err := checkChainReset(gRPCClient, out, config.ExtractConfig{OnChainReset: config.OnChainResetWipe})
+	assert.ErrorContains(t, err, "on-chain-reset wipe is not supported by the output")
+
+	checker := &chainResetOutputHandler{memoryOutputHandler: newMemoryOutputHandler()}
+	require.NoError(t, checkChainReset(gRPCClient, checker, config.ExtractConfig{OnChainReset: config.OnChainResetNewSchema}))
+	assert.Equal(t, []string{config.OnChainResetNewSchema}, checker.policies)
+
+	// As well as a multi output without any output detecting chain resets
+	checker.err = output.ErrChainResetUnsupported
+	require.NoError(t, checkChainReset(gRPCClient, checker, config.ExtractConfig{OnChainReset: config.OnChainResetHalt}))
+	assert.Error(t, checkChainReset(gRPCClient, checker, config.ExtractConfig{OnChainReset: config.OnChainResetWipe}))
+}
@@ -0,0 +1,111 @@
+package extractor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/manifest-network/yaci/internal/metrics"
+	"github.com/manifest-network/yaci/internal/retry"
+)
+
+// decreaseFactor is the factor applied to the concurrency limit when the nodes throttle the requests.
+const decreaseFactor = 0.5
+
+// maxThrottledAttempts is the maximum number of attempts to process a block throttled by the nodes.
+const maxThrottledAttempts = 20
+
+// concurrencyLimiter bounds the number of blocks processed concurrently. When adaptive, the limit follows an AIMD
+// scheme: it is multiplied by decreaseFactor when the nodes throttle the requests, at most once per target latency,
+// and increased by about one every limit blocks processed within the target latency, up to the maximum.
+type concurrencyLimiter struct {
+	adaptive      bool
+	max           float64
+	targetLatency time.Duration
+
+	mu           sync.Mutex
+	limit        float64
+	inflight     int
+	lastDecrease time.Time
+	// released is closed and replaced when a block is released, waking up the blocks waiting for a slot
+	released chan struct{}
+}
+
+func newConcurrencyLimiter(maxConcurrency uint, adaptive bool, targetLatency time.Duration) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		adaptive:      adaptive,
+		max:           float64(max(maxConcurrency, 1)),
+		targetLatency: targetLatency,
+		released:      make(chan struct{}),
+	}
+	l.limit = l.max
+	metrics.ConcurrencyLimit.Set(l.limit)
+	return l
+}
+
+// acquire waits for a slot to process a block, or returns the error of the context if it is done first.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inflight < int(l.limit) {
+			l.inflight++
+			l.mu.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees the slot of a block processed in the given time with the given result, and adapts the limit.
+func (l *concurrencyLimiter) release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	if l.adaptive {
+		switch {
+		case isThrottlingError(err):
+			if time.Since(l.lastDecrease) >= l.targetLatency {
+				l.limit = max(1, l.limit*decreaseFactor)
+				l.lastDecrease = time.Now()
+				metrics.ConcurrencyLimit.Set(l.limit)
+			}
+		case err == nil && latency <= l.targetLatency:
+			l.limit = min(l.max, l.limit+1/l.limit)
+			metrics.ConcurrencyLimit.Set(l.limit)
+		}
+	}
+
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// current returns the current concurrency limit.
+func (l *concurrencyLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// isThrottlingError returns true if the nodes rejected the request because of its rate, rather than its content.
+// ResourceExhausted is also returned when a message exceeds the maximum size, which is not throttling.
+func isThrottlingError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return true
+	case codes.ResourceExhausted:
+		return !retry.IsMessageTooLarge(err)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,79 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+	limiter := newConcurrencyLimiter(2, false, time.Second)
+	require.NoError(t, limiter.acquire(context.Background()))
+	require.NoError(t, limiter.acquire(context.Background()))
+
+	// The third block waits for a slot
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.acquire(ctx), context.DeadlineExceeded)
+
+	acquired := make(chan error)
+	go func() { acquired <- limiter.acquire(context.Background()) }()
+	limiter.release(time.Millisecond, nil)
+	require.NoError(t, <-acquired)
+}
+
+func TestConcurrencyLimiterAdaptive(t *testing.T) {
+	limiter := newConcurrencyLimiter(16, true, time.Hour)
+	throttled := status.Error(codes.ResourceExhausted, "rate limit exceeded")
+
+	// Throttling halves the limit, at most once per target latency
+	for i := 0; i < 2; i++ {
+		require.NoError(t, limiter.acquire(context.Background()))
+		limiter.release(time.Millisecond, throttled)
+	}
+	assert.Equal(t, 8, limiter.current())
+
+	// Fast blocks raise the limit by about one every limit blocks
+	for i := 0; i < 9; i++ {
+		require.NoError(t, limiter.acquire(context.Background()))
+		limiter.release(time.Millisecond, nil)
+	}
+	assert.Equal(t, 9, limiter.current())
+
+	// Slow blocks and other errors leave the limit unchanged
+	require.NoError(t, limiter.acquire(context.Background()))
+	limiter.release(2*time.Hour, nil)
+	require.NoError(t, limiter.acquire(context.Background()))
+	limiter.release(time.Millisecond, errors.New("failed to unmarshal block JSON"))
+	assert.Equal(t, 9, limiter.current())
+
+	// The limit never exceeds the maximum concurrency
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, limiter.acquire(context.Background()))
+		limiter.release(time.Millisecond, nil)
+	}
+	assert.Equal(t, 16, limiter.current())
+}
+
+func TestConcurrencyLimiterFixed(t *testing.T) {
+	limiter := newConcurrencyLimiter(4, false, time.Second)
+	require.NoError(t, limiter.acquire(context.Background()))
+	limiter.release(time.Millisecond, status.Error(codes.Unavailable, "unavailable"))
+	assert.Equal(t, 4, limiter.current())
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	assert.True(t, isThrottlingError(status.Error(codes.Unavailable, "unavailable")))
+	assert.True(t, isThrottlingError(status.Error(codes.ResourceExhausted, "rate limit exceeded")))
+	assert.True(t, isThrottlingError(fmt.Errorf("failed to get block data: %w", status.Error(codes.Unavailable, "unavailable"))))
+	assert.False(t, isThrottlingError(status.Error(codes.ResourceExhausted, "grpc: received message larger than max (5000000 vs. 4194304)")))
+	assert.False(t, isThrottlingError(status.Error(codes.NotFound, "not found")))
+	assert.False(t, isThrottlingError(nil))
+}
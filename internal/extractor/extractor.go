@@ -1,6 +1,7 @@
 package extractor
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -11,8 +12,9 @@ import (
 )
 
 const (
-	blockMethodFullName = "cosmos.tx.v1beta1.Service.GetBlockWithTxs"
-	txMethodFullName    = "cosmos.tx.v1beta1.Service.GetTx"
+	blockMethodFullName    = "cosmos.tx.v1beta1.Service.GetBlockWithTxs"
+	txMethodFullName       = "cosmos.tx.v1beta1.Service.GetTx"
+	txsEventMethodFullName = "cosmos.tx.v1beta1.Service.GetTxsEvent"
 )
 
 // Extract extracts blocks and transactions from a gRPC server.
@@ -20,25 +22,82 @@ func Extract(gRPCClient *client.GRPCClient, outputHandler output.OutputHandler,
 	// Check if the missing block check should be skipped before setting the block range
 	skipMissingBlockCheck := shouldSkipMissingBlockCheck(config)
 
+	// A chain reset may clear the output, so it is handled before reading the blocks of the output
+	if err := checkChainReset(gRPCClient, outputHandler, config); err != nil {
+		return err
+	}
+
 	if err := setBlockRange(gRPCClient, outputHandler, &config); err != nil {
 		return err
 	}
 
+	var rpcClient *client.RPCClient
+	if config.RPCAddress != "" {
+		auth, err := config.AuthConfig()
+		if err != nil {
+			return fmt.Errorf("invalid headers: %w", err)
+		}
+		rpcClient, err = client.NewRPCClient(config.RPCAddress, client.RPCConfig{
+			Insecure: config.Insecure,
+			Auth:     auth,
+			TLS:      config.TLSConfig(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to initialize RPC client: %w", err)
+		}
+		slog.Info("Block results extraction enabled", "rpc_address", rpcClient.Address)
+	}
+
+	// Verify the parent hash of every written block
+	verifier := newChainVerifier(outputHandler)
+	if err := verifier.seed(gRPCClient.Ctx); err != nil {
+		return err
+	}
+
+	// The concurrency limit learned by the limiter is kept across the extracted ranges
+	limiter := newConcurrencyLimiter(config.MaxConcurrency, config.AdaptiveConcurrency, config.TargetLatency)
+	txs := newTxFetcher(config)
+
+	for {
+		err := extract(gRPCClient, rpcClient, txs, verifier, limiter, config, skipMissingBlockCheck)
+
+		var reorg *ReorgError
+		if !errors.As(err, &reorg) {
+			return err
+		}
+
+		start, err := handleReorg(gRPCClient.Ctx, verifier, reorg, config.BlockStart, config.OnReorg)
+		if err != nil {
+			return err
+		}
+		if !config.LiveMonitoring && start > config.BlockStop {
+			return nil
+		}
+
+		slog.Info("Restarting extraction after rollback", "start", start)
+		config.BlockStart = start
+		// Outputs may roll back blocks below the restart height
+		skipMissingBlockCheck = false
+	}
+}
+
+// extract extracts the missing blocks, unless skipped, then the configured block range or the live blocks.
+func extract(gRPCClient *client.GRPCClient, rpcClient *client.RPCClient, txs *txFetcher, outputHandler output.OutputHandler, limiter *concurrencyLimiter, config config.ExtractConfig, skipMissingBlockCheck bool) error {
 	if !skipMissingBlockCheck {
-		if err := processMissingBlocks(gRPCClient, outputHandler, config); err != nil {
+		if err := processMissingBlocks(gRPCClient, rpcClient, txs, outputHandler, config); err != nil {
 			return err
 		}
 	}
 
 	if config.LiveMonitoring {
 		slog.Info("Starting live extraction", "block_time", config.BlockTime)
-		err := extractLiveBlocksAndTransactions(gRPCClient, config.BlockStart, outputHandler, config.BlockTime, config.MaxConcurrency, config.MaxRetries)
+		err := extractLiveBlocksAndTransactions(gRPCClient, rpcClient, txs, config.BlockStart, outputHandler, limiter, config)
 		if err != nil {
 			return fmt.Errorf("failed to process live blocks and transactions: %w", err)
 		}
 	} else {
 		slog.Info("Starting extraction", "start", config.BlockStart, "stop", config.BlockStop)
-		err := extractBlocksAndTransactions(gRPCClient, config.BlockStart, config.BlockStop, outputHandler, config.MaxConcurrency, config.MaxRetries)
+		err := extractBlocksAndTransactions(gRPCClient, rpcClient, txs, config.BlockStart, config.BlockStop, outputHandler, limiter, config)
 		if err != nil {
 			return fmt.Errorf("failed to process blocks and transactions: %w", err)
 		}
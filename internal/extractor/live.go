@@ -5,12 +5,13 @@ import (
 	"time"
 
 	"github.com/manifest-network/yaci/internal/client"
+	"github.com/manifest-network/yaci/internal/config"
 	"github.com/manifest-network/yaci/internal/output"
 	"github.com/manifest-network/yaci/internal/utils"
 )
 
 // extractLiveBlocksAndTransactions monitors the chain and processes new blocks as they are produced.
-func extractLiveBlocksAndTransactions(gRPCClient *client.GRPCClient, start uint64, outputHandler output.OutputHandler, blockTime, maxConcurrency, maxRetries uint) error {
+func extractLiveBlocksAndTransactions(gRPCClient *client.GRPCClient, rpcClient *client.RPCClient, txs *txFetcher, start uint64, outputHandler output.OutputHandler, limiter *concurrencyLimiter, cfg config.ExtractConfig) error {
 	currentHeight := start - 1
 	for {
 		select {
@@ -18,13 +19,13 @@ func extractLiveBlocksAndTransactions(gRPCClient *client.GRPCClient, start uint6
 			return nil
 		default:
 			// Get the latest block height
-			latestHeight, err := utils.GetLatestBlockHeightWithRetry(gRPCClient, maxRetries)
+			latestHeight, err := utils.GetLatestBlockHeightWithRetry(gRPCClient, cfg.MaxRetries)
 			if err != nil {
 				return fmt.Errorf("failed to get latest block height: %w", err)
 			}
 
 			if latestHeight > currentHeight {
-				err = extractBlocksAndTransactions(gRPCClient, currentHeight+1, latestHeight, outputHandler, maxConcurrency, maxRetries)
+				err = extractBlocksAndTransactions(gRPCClient, rpcClient, txs, currentHeight+1, latestHeight, outputHandler, limiter, cfg)
 				if err != nil {
 					return fmt.Errorf("failed to process blocks and transactions: %w", err)
 				}
@@ -32,7 +33,7 @@ func extractLiveBlocksAndTransactions(gRPCClient *client.GRPCClient, start uint6
 			}
 
 			// Sleep before checking again
-			time.Sleep(time.Duration(blockTime) * time.Second)
+			time.Sleep(time.Duration(cfg.BlockTime) * time.Second)
 		}
 	}
 }
@@ -0,0 +1,204 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/metrics"
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+// ReorgError reports a block whose parent hash does not match the hash of its parent,
+// i.e., the node serves a chain diverging from the extracted blocks.
+type ReorgError struct {
+	// Height is the height of the extracted block diverging from the chain served by the node.
+	Height uint64
+	// ParentHeight is the height of the parent block.
+	ParentHeight uint64
+	// ParentHash is the hash of the parent block.
+	ParentHash string
+	// LastBlockHash is the parent hash of the child block.
+	LastBlockHash string
+}
+
+func (e *ReorgError) Error() string {
+	return fmt.Sprintf("chain reorganization detected at height %d: block %d has parent hash %s, but block %d has hash %s",
+		e.Height, e.ParentHeight+1, e.LastBlockHash, e.ParentHeight, e.ParentHash)
+}
+
+// blockHashes are the hashes of a block and of its parent.
+type blockHashes struct {
+	hash          string
+	lastBlockHash string
+	// end is the height at the other end of the run of consecutive written blocks the block ends
+	end uint64
+}
+
+// chainVerifier wraps an output handler and verifies that the written blocks form a chain of parent hashes.
+// The written blocks form runs of consecutive heights, separated by the heights still in flight or missing.
+// Only the hashes of the blocks at both ends of the runs are kept in memory, as the blocks inside the runs
+// have both their parent and child known. Blocks may be written in any order, e.g., missing blocks far below
+// the extracted ones, and memory only grows with the number of gaps between the written blocks.
+type chainVerifier struct {
+	output.OutputHandler
+
+	mu sync.Mutex
+	// hashes holds the hashes of the blocks at the ends of the runs, by height
+	hashes map[uint64]blockHashes
+}
+
+func newChainVerifier(outputHandler output.OutputHandler) *chainVerifier {
+	return &chainVerifier{
+		OutputHandler: outputHandler,
+		hashes:        make(map[uint64]blockHashes),
+	}
+}
+
+// seed records the hashes of the latest block of the output, if the output stores them,
+// so that the first extracted block is verified against it.
+func (v *chainVerifier) seed(ctx context.Context) error {
+	latest, err := v.GetLatestBlock(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the latest block: %w", err)
+	}
+	if latest == nil || latest.Hash == "" {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.record(latest)
+	return nil
+}
+
+// WriteBlockWithTransactions verifies that the block chains with the blocks already written, then writes it.
+// Blocks with an unknown hash are written without verification.
+func (v *chainVerifier) WriteBlockWithTransactions(ctx context.Context, block *models.Block, transactions []*models.Transaction) error {
+	if block.Hash != "" {
+		if err := v.verify(block); err != nil {
+			return err
+		}
+	}
+
+	return v.OutputHandler.WriteBlockWithTransactions(ctx, block, transactions)
+}
+
+// Rollback forgets the hashes of the blocks, and rolls back the output.
+// The extraction restarts from the rolled back output, whose latest block is seeded again.
+func (v *chainVerifier) Rollback(ctx context.Context, height uint64) error {
+	v.mu.Lock()
+	clear(v.hashes)
+	v.mu.Unlock()
+
+	return v.OutputHandler.Rollback(ctx, height)
+}
+
+// Flush flushes the output, if it buffers the written blocks.
+func (v *chainVerifier) Flush(ctx context.Context) error {
+	if flusher, ok := v.OutputHandler.(output.Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+	return nil
+}
+
+// verify checks the block against its parent and its child, then records its hashes.
+// Blocks already written are not verified again.
+func (v *chainVerifier) verify(block *models.Block) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.recorded(block.ID) {
+		return nil
+	}
+	if parent, ok := v.hashes[block.ID-1]; ok && block.LastBlockHash != parent.hash {
+		return &ReorgError{Height: block.ID - 1, ParentHeight: block.ID - 1, ParentHash: parent.hash, LastBlockHash: block.LastBlockHash}
+	}
+	if child, ok := v.hashes[block.ID+1]; ok && child.lastBlockHash != block.Hash {
+		return &ReorgError{Height: block.ID + 1, ParentHeight: block.ID, ParentHash: block.Hash, LastBlockHash: child.lastBlockHash}
+	}
+
+	v.record(block)
+	return nil
+}
+
+// recorded returns true if the block at the height was recorded, i.e., is inside or at an end of a run.
+// The caller must hold the lock.
+func (v *chainVerifier) recorded(height uint64) bool {
+	for first, hashes := range v.hashes {
+		if first <= height && height <= hashes.end {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds the block to the runs, merging the runs ending at its parent and starting at its child,
+// and prunes the hashes of the blocks no longer at the end of a run.
+// The caller must hold the lock, and the block must not be recorded already.
+func (v *chainVerifier) record(block *models.Block) {
+	first, last := block.ID, block.ID
+	if parent, ok := v.hashes[block.ID-1]; ok {
+		first = parent.end
+		if first != block.ID-1 {
+			delete(v.hashes, block.ID-1)
+		}
+	}
+	if child, ok := v.hashes[block.ID+1]; ok {
+		last = child.end
+		if last != block.ID+1 {
+			delete(v.hashes, block.ID+1)
+		}
+	}
+
+	if first == block.ID || last == block.ID {
+		v.hashes[block.ID] = blockHashes{hash: block.Hash, lastBlockHash: block.LastBlockHash}
+	}
+	start, end := v.hashes[first], v.hashes[last]
+	start.end, end.end = last, first
+	v.hashes[first], v.hashes[last] = start, end
+}
+
+// handleReorg handles a chain reorganization according to the configured action.
+// When rolling back, it returns the height the extraction must restart from.
+func handleReorg(ctx context.Context, verifier *chainVerifier, reorg *ReorgError, start uint64, onReorg string) (uint64, error) {
+	metrics.ReorgsTotal.WithLabelValues(onReorg).Inc()
+
+	attrs := []any{
+		"height", reorg.Height,
+		"parent_height", reorg.ParentHeight,
+		"parent_hash", reorg.ParentHash,
+		"child_last_block_hash", reorg.LastBlockHash,
+		"action", onReorg,
+	}
+
+	if onReorg != config.OnReorgRollback {
+		slog.Error("Chain reorganization detected, halting the extraction", attrs...)
+		return 0, reorg
+	}
+
+	slog.Warn("Chain reorganization detected, rolling back the diverging blocks", attrs...)
+	if err := verifier.Rollback(ctx, reorg.Height); err != nil {
+		return 0, fmt.Errorf("failed to roll back to block %d: %w", reorg.Height, err)
+	}
+
+	// Outputs may roll back blocks below the requested height, e.g., whole files
+	latest, err := verifier.GetLatestBlock(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the latest block: %w", err)
+	}
+	start = min(start, reorg.Height)
+	if latest != nil {
+		start = min(latest.ID+1, reorg.Height)
+	}
+
+	if err := verifier.seed(ctx); err != nil {
+		return 0, err
+	}
+
+	return start, nil
+}
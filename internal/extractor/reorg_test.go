@@ -0,0 +1,187 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+// memoryOutputHandler is an in-memory output handler storing the written blocks.
+type memoryOutputHandler struct {
+	blocks map[uint64]*models.Block
+}
+
+func newMemoryOutputHandler(blocks ...*models.Block) *memoryOutputHandler {
+	h := &memoryOutputHandler{blocks: make(map[uint64]*models.Block)}
+	for _, block := range blocks {
+		h.blocks[block.ID] = block
+	}
+	return h
+}
+
+func (h *memoryOutputHandler) WriteBlockWithTransactions(_ context.Context, block *models.Block, _ []*models.Transaction) error {
+	h.blocks[block.ID] = block
+	return nil
+}
+
+func (h *memoryOutputHandler) GetLatestBlock(_ context.Context) (*models.Block, error) {
+	var latest *models.Block
+	for _, block := range h.blocks {
+		if latest == nil || block.ID > latest.ID {
+			latest = block
+		}
+	}
+	return latest, nil
+}
+
+func (h *memoryOutputHandler) GetEarliestBlock(_ context.Context) (*models.Block, error) {
+	return nil, nil
+}
+
+func (h *memoryOutputHandler) GetMissingBlockIds(_ context.Context) ([]uint64, error) {
+	return nil, nil
+}
+
+func (h *memoryOutputHandler) Rollback(_ context.Context, height uint64) error {
+	for id := range h.blocks {
+		if id >= height {
+			delete(h.blocks, id)
+		}
+	}
+	return nil
+}
+
+func (h *memoryOutputHandler) Close() error {
+	return nil
+}
+
+var _ output.OutputHandler = (*memoryOutputHandler)(nil)
+
+func block(height uint64, hash, lastBlockHash string) *models.Block {
+	return &models.Block{ID: height, Hash: hash, LastBlockHash: lastBlockHash}
+}
+
+func TestChainVerifier(t *testing.T) {
+	ctx := context.Background()
+	out := newMemoryOutputHandler(block(10, "A10", "A9"))
+	v := newChainVerifier(out)
+	require.NoError(t, v.seed(ctx))
+
+	// Blocks chaining with the stored blocks, in any order
+	require.NoError(t, v.WriteBlockWithTransactions(ctx, block(12, "A12", "A11"), nil))
+	require.NoError(t, v.WriteBlockWithTransactions(ctx, block(11, "A11", "A10"), nil))
+
+	// Only the hashes of the blocks at the ends of the run are kept
+	assert.Len(t, v.hashes, 2)
+	assert.Contains(t, v.hashes, uint64(10))
+	assert.Contains(t, v.hashes, uint64(12))
+
+	// The parent of the block diverges
+	err := v.WriteBlockWithTransactions(ctx, block(13, "B13", "B12"), nil)
+	var reorg *ReorgError
+	require.ErrorAs(t, err, &reorg)
+	assert.Equal(t, ReorgError{Height: 12, ParentHeight: 12, ParentHash: "A12", LastBlockHash: "B12"}, *reorg)
+	assert.NotContains(t, out.blocks, uint64(13))
+
+	// The child of the block diverges
+	require.NoError(t, v.WriteBlockWithTransactions(ctx, block(15, "B15", "B14"), nil))
+	err = v.WriteBlockWithTransactions(ctx, block(14, "C14", "A13"), nil)
+	require.ErrorAs(t, err, &reorg)
+	assert.Equal(t, uint64(15), reorg.Height)
+
+	// Blocks with an unknown hash are not verified
+	require.NoError(t, v.WriteBlockWithTransactions(ctx, block(16, "", ""), nil))
+}
+
+func TestChainVerifierOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	out := newMemoryOutputHandler(block(1000, "A1000", "A999"))
+	v := newChainVerifier(newLockedOutputHandler(out))
+	require.NoError(t, v.seed(ctx))
+
+	hash := func(height uint64) string { return fmt.Sprintf("A%d", height) }
+
+	// Blocks above the latest block, and missing blocks far below it, written concurrently in any order
+	heights := make([]uint64, 0, 600)
+	for height := uint64(1001); height <= 1500; height++ {
+		heights = append(heights, height)
+	}
+	for height := uint64(101); height <= 200; height++ {
+		heights = append(heights, height)
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(heights), func(i, j int) { heights[i], heights[j] = heights[j], heights[i] })
+
+	var g errgroup.Group
+	g.SetLimit(8)
+	for _, height := range heights {
+		g.Go(func() error {
+			return v.WriteBlockWithTransactions(ctx, block(height, hash(height), hash(height-1)), nil)
+		})
+	}
+	require.NoError(t, g.Wait())
+
+	// Only the ends of the runs [101, 200] and [1000, 1500] are kept
+	assert.Len(t, v.hashes, 4)
+	for _, height := range []uint64{101, 200, 1000, 1500} {
+		assert.Contains(t, v.hashes, height)
+	}
+
+	// Blocks are still verified at both ends of the runs
+	var reorg *ReorgError
+	require.ErrorAs(t, v.WriteBlockWithTransactions(ctx, block(100, "B100", "A99"), nil), &reorg)
+	assert.Equal(t, uint64(101), reorg.Height)
+	require.ErrorAs(t, v.WriteBlockWithTransactions(ctx, block(1501, "B1501", "B1500"), nil), &reorg)
+	assert.Equal(t, uint64(1500), reorg.Height)
+	require.NoError(t, v.WriteBlockWithTransactions(ctx, block(201, hash(201), hash(200)), nil))
+
+	// Blocks written again are not verified again
+	require.NoError(t, v.WriteBlockWithTransactions(ctx, block(150, hash(150), hash(149)), nil))
+	assert.Len(t, v.hashes, 4)
+}
+
+// lockedOutputHandler serializes the writes to an output handler.
+type lockedOutputHandler struct {
+	*memoryOutputHandler
+	mu sync.Mutex
+}
+
+func newLockedOutputHandler(out *memoryOutputHandler) *lockedOutputHandler {
+	return &lockedOutputHandler{memoryOutputHandler: out}
+}
+
+func (h *lockedOutputHandler) WriteBlockWithTransactions(ctx context.Context, block *models.Block, transactions []*models.Transaction) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.memoryOutputHandler.WriteBlockWithTransactions(ctx, block, transactions)
+}
+
+func TestHandleReorg(t *testing.T) {
+	ctx := context.Background()
+	out := newMemoryOutputHandler(block(1, "A1", ""), block(2, "A2", "A1"), block(3, "A3", "A2"))
+	v := newChainVerifier(out)
+	reorg := &ReorgError{Height: 2, ParentHeight: 2, ParentHash: "A2", LastBlockHash: "B2"}
+
+	_, err := handleReorg(ctx, v, reorg, 1, config.OnReorgHalt)
+	assert.ErrorIs(t, err, reorg)
+	assert.Len(t, out.blocks, 3)
+
+	start, err := handleReorg(ctx, v, reorg, 1, config.OnReorgRollback)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), start)
+	assert.Len(t, out.blocks, 1)
+
+	// The verifier is seeded with the new latest block
+	err = v.WriteBlockWithTransactions(ctx, block(2, "B2", "B1"), nil)
+	require.ErrorAs(t, err, &reorg)
+	assert.Equal(t, uint64(1), reorg.Height)
+}
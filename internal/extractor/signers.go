@@ -0,0 +1,95 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+)
+
+// messageSigners returns the addresses of the signers of each message of the transaction, by message index, as
+// listed by the cosmos.msg.v1.signer option of the messages. The signers of a message whose type or signers are
+// unknown are nil, and the result is nil for the transactions that could not be fetched.
+func messageSigners(resolver *reflection.CustomResolver, data []byte) [][]string {
+	var raw struct {
+		Tx struct {
+			Body struct {
+				Messages []map[string]any `json:"messages"`
+			} `json:"body"`
+		} `json:"tx"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil || len(raw.Tx.Body.Messages) == 0 {
+		return nil
+	}
+
+	signers := make([][]string, len(raw.Tx.Body.Messages))
+	for i, msg := range raw.Tx.Body.Messages {
+		typeURL, _ := msg["@type"].(string)
+		name := typeURL[strings.LastIndex(typeURL, "/")+1:]
+		if name == "" {
+			continue
+		}
+		msgType, err := resolver.FindMessageByName(protoreflect.FullName(name))
+		if err != nil {
+			slog.Debug("Failed to find message type, signers unknown", "type", typeURL, "error", err)
+			continue
+		}
+
+		addresses, err := collectSigners(resolver, msgType.Descriptor(), msg, nil)
+		if err != nil {
+			slog.Debug("Failed to collect message signers", "type", typeURL, "error", err)
+			continue
+		}
+		signers[i] = addresses
+	}
+
+	return signers
+}
+
+// collectSigners appends the addresses held by the signer fields of the JSON message to the signers, once each.
+func collectSigners(resolver *reflection.CustomResolver, desc protoreflect.MessageDescriptor, msg map[string]any, signers []string) ([]string, error) {
+	fields, err := resolver.SignerFields(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fd := range fields {
+		value, ok := msg[fd.JSONName()]
+		if !ok {
+			// The JSON may use the original field names
+			value = msg[string(fd.Name())]
+		}
+
+		values := []any{value}
+		if fd.IsList() {
+			values, _ = value.([]any)
+		}
+
+		for _, v := range values {
+			switch fd.Kind() {
+			case protoreflect.StringKind:
+				address, _ := v.(string)
+				if address != "" && !slices.Contains(signers, address) {
+					signers = append(signers, address)
+				}
+			case protoreflect.MessageKind:
+				nested, ok := v.(map[string]any)
+				if !ok {
+					continue
+				}
+				if signers, err = collectSigners(resolver, fd.Message(), nested, signers); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fmt.Errorf("unsupported kind %s of signer field %s", fd.Kind(), fd.FullName())
+			}
+		}
+	}
+
+	return signers, nil
+}
@@ -0,0 +1,38 @@
+package extractor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/retry"
+	"github.com/manifest-network/yaci/internal/testutil"
+)
+
+func TestMessageSigners(t *testing.T) {
+	files, err := reflection.BuildFileDescriptorSet(testutil.MockMsgFileDescriptorSet.GetFile())
+	require.NoError(t, err)
+	resolver := reflection.NewCustomResolver(context.Background(), files, nil, retry.DefaultPolicy(), 3, nil)
+
+	data := []byte(`{
+	  "tx": {"body": {"messages": [
+	    {"@type": "/test.v1.MsgSend", "fromAddress": "manifest1a", "toAddress": "manifest1b"},
+	    {"@type": "/test.v1.MsgMultiSend", "inputs": [{"address": "manifest1c"}, {"address": "manifest1d"}, {"address": "manifest1c"}]},
+	    {"@type": "/test.v1.MsgNoSigner", "creator": "manifest1e"},
+	    {"@type": "/test.v1.MsgSend", "from_address": "manifest1f"}
+	  ]}},
+	  "txResponse": {"code": 0}
+	}`)
+	assert.Equal(t, [][]string{
+		{"manifest1a"},
+		{"manifest1c", "manifest1d"},
+		nil,
+		{"manifest1f"},
+	}, messageSigners(resolver, data))
+
+	// Transactions that could not be fetched have no messages
+	assert.Nil(t, messageSigners(resolver, []byte(`{"error": "failed to fetch transaction details", "hash": "aa", "reason": "timeout"}`)))
+}
@@ -1,18 +1,115 @@
 package extractor
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
 
 	"github.com/manifest-network/yaci/internal/client"
+	"github.com/manifest-network/yaci/internal/config"
 	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/retry"
 	"github.com/manifest-network/yaci/internal/utils"
 )
 
-func extractTransactions(gRPCClient *client.GRPCClient, data map[string]interface{}, maxRetries uint) ([]*models.Transaction, error) {
+// txsEventPageLimit is the maximum page size accepted by the CosmosSDK GetTxsEvent endpoint.
+const txsEventPageLimit = 100
+
+// txFetcher fetches the transactions of the blocks according to the fetch strategy.
+// It is shared by the workers of an extraction.
+type txFetcher struct {
+	strategy   string
+	maxRetries uint
+	// byHeightDisabled is set once GetTxsEvent failed with an error that is not transient, e.g., when transaction
+	// indexing is disabled on the node. All subsequent blocks then use the per-hash strategy without probing
+	// GetTxsEvent again.
+	byHeightDisabled atomic.Bool
+
+	mu sync.Mutex
+	// requests holds the shape of the GetTxsEvent requests of the latest schemas, as it changes with chain upgrades.
+	requests map[*reflection.CustomResolver]txsEventRequest
+}
+
+func newTxFetcher(cfg config.ExtractConfig) *txFetcher {
+	return &txFetcher{
+		strategy:   cfg.TxFetchStrategy,
+		maxRetries: cfg.MaxRetries,
+		requests:   make(map[*reflection.CustomResolver]txsEventRequest),
+	}
+}
+
+// txsEventRequest is the shape of the cosmos.tx.v1beta1.GetTxsEventRequest of a schema.
+type txsEventRequest struct {
+	// query is set when the request has the query field, added in Cosmos SDK 0.50 to replace the events field.
+	query bool
+	// page is set when the request has the page and limit fields, added in Cosmos SDK 0.46 to replace the pagination field.
+	page bool
+}
+
+func newTxsEventRequest(method protoreflect.MethodDescriptor) txsEventRequest {
+	fields := method.Input().Fields()
+	return txsEventRequest{
+		query: fields.ByName("query") != nil,
+		page:  fields.ByName("page") != nil,
+	}
+}
+
+// params returns the JSON request for a page of the transactions of the block, pages starting at 1.
+func (r txsEventRequest) params(blockHeight, page uint64) []byte {
+	query := fmt.Sprintf("tx.height=%d", blockHeight)
+	if !r.page {
+		offset := (page - 1) * txsEventPageLimit
+		return []byte(fmt.Sprintf(`{"events": [%q], "pagination": {"offset": "%d", "limit": "%d", "countTotal": true}}`, query, offset, txsEventPageLimit))
+	}
+	if r.query {
+		return []byte(fmt.Sprintf(`{"query": %q, "page": %d, "limit": %d}`, query, page, txsEventPageLimit))
+	}
+	return []byte(fmt.Sprintf(`{"events": [%q], "page": %d, "limit": %d}`, query, page, txsEventPageLimit))
+}
+
+type getTxsEventResponse struct {
+	Txs         []json.RawMessage `json:"txs"`
+	TxResponses []json.RawMessage `json:"txResponses"`
+	Total       string            `json:"total"`
+	// Pagination holds the total before Cosmos SDK 0.46
+	Pagination *struct {
+		Total string `json:"total"`
+	} `json:"pagination"`
+}
+
+// total returns the total number of transactions, if reported.
+func (r getTxsEventResponse) total() (uint64, bool) {
+	total := r.Total
+	if total == "" && r.Pagination != nil {
+		total = r.Pagination.Total
+	}
+	value, err := strconv.ParseUint(total, 10, 64)
+	return value, err == nil
+}
+
+// getTxResponse mirrors the JSON representation of cosmos.tx.v1beta1.GetTxResponse,
+// so that batched transactions are stored in the same format as the ones fetched by hash.
+type getTxResponse struct {
+	Tx         json.RawMessage `json:"tx"`
+	TxResponse json.RawMessage `json:"txResponse"`
+}
+
+// fetch extracts the transactions of the block.
+func (f *txFetcher) fetch(gRPCClient *client.GRPCClient, blockHeight uint64, data map[string]interface{}) ([]*models.Transaction, error) {
 	blockData, exists := data["block"].(map[string]interface{})
 	if !exists || blockData == nil {
 		return nil, nil
@@ -28,7 +125,7 @@ func extractTransactions(gRPCClient *client.GRPCClient, data map[string]interfac
 		return nil, nil
 	}
 
-	var transactions []*models.Transaction
+	hashes := make([]string, 0, len(txs))
 	for _, tx := range txs {
 		txStr, ok := tx.(string)
 		if !ok {
@@ -39,44 +136,204 @@ func extractTransactions(gRPCClient *client.GRPCClient, data map[string]interfac
 			return nil, fmt.Errorf("failed to decode tx: %w", err)
 		}
 		hash := sha256.Sum256(decodedBytes)
-		hashStr := hex.EncodeToString(hash[:])
-
-		txJsonParams := []byte(fmt.Sprintf(`{"hash": "%s"}`, hashStr))
-		txJsonBytes, err := utils.GetGRPCResponse(
-			gRPCClient,
-			txMethodFullName,
-			maxRetries,
-			txJsonParams,
-		)
-
-		// Graceful degradation: store error metadata instead of failing the entire block.
-		// This handles edge cases discovered in production:
-		// - Oversized transactions exceeding max gRPC message size (seen on Mantrachain)
-		// - Transient RPC failures for individual transactions
-		// - Malformed transaction data on certain chains
-		// The block is still recorded, and downstream consumers can identify failed
-		// transactions by checking for the "error" field in the JSON data.
-		if err != nil {
-			errorJSON := []byte(fmt.Sprintf(`{"error": "failed to fetch transaction details", "hash": "%s", "reason": %q}`, hashStr, err.Error()))
-			transaction := &models.Transaction{
-				Hash: hashStr,
-				Data: errorJSON,
-			}
-			transactions = append(transactions, transaction)
+		hashes = append(hashes, hex.EncodeToString(hash[:]))
+	}
 
-			slog.Warn("Failed to fetch transaction details, storing with error metadata",
-				"hash", hashStr,
-				"error", err)
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	var batched map[string][]byte
+	if f.strategy == config.TxFetchStrategyHeight && !f.byHeightDisabled.Load() {
+		batched = f.fetchByHeight(gRPCClient, blockHeight, len(hashes))
+	}
+
+	transactions := make([]*models.Transaction, 0, len(hashes))
+	for _, hashStr := range hashes {
+		if txJsonBytes, ok := batched[hashStr]; ok {
+			transactions = append(transactions, &models.Transaction{
+				Hash: hashStr,
+				Data: txJsonBytes,
+			})
 			continue
 		}
 
-		transaction := &models.Transaction{
-			Hash: hashStr,
-			Data: txJsonBytes,
+		tx, err := fetchTransactionByHash(func(params []byte) ([]byte, error) {
+			return utils.GetGRPCResponse(gRPCClient, txMethodFullName, f.maxRetries, params)
+		}, hashStr)
+		if err != nil {
+			return nil, err
 		}
+		transactions = append(transactions, tx)
+	}
 
-		transactions = append(transactions, transaction)
+	resolver := gRPCClient.Resolver()
+	for _, tx := range transactions {
+		tx.Signers = messageSigners(resolver, tx.Data)
 	}
 
 	return transactions, nil
 }
+
+// fetchTransactionByHash fetches a single transaction using the GetTx endpoint, called with the JSON request.
+// The errors caused by the state of the nodes, e.g., throttling, and by the cancellation of the extraction are
+// returned, so that the whole block is retried and the concurrency limiter backs off.
+func fetchTransactionByHash(call func(params []byte) ([]byte, error), hashStr string) (*models.Transaction, error) {
+	txJsonBytes, err := call([]byte(fmt.Sprintf(`{"hash": "%s"}`, hashStr)))
+	if err != nil && (isTransientError(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return nil, fmt.Errorf("failed to get transaction %s: %w", hashStr, err)
+	}
+
+	// Graceful degradation: store error metadata instead of failing the entire block, for the errors that
+	// retrying cannot fix. This handles edge cases discovered in production:
+	// - Oversized transactions exceeding max gRPC message size (seen on Mantrachain)
+	// - Transactions not found by the node
+	// - Malformed transaction data on certain chains
+	// The block is still recorded, and downstream consumers can identify failed
+	// transactions by checking for the "error" field in the JSON data.
+	if err != nil {
+		errorJSON := []byte(fmt.Sprintf(`{"error": "failed to fetch transaction details", "hash": "%s", "reason": %q}`, hashStr, err.Error()))
+
+		slog.Warn("Failed to fetch transaction details, storing with error metadata",
+			"hash", hashStr,
+			"error", err)
+
+		return &models.Transaction{
+			Hash: hashStr,
+			Data: errorJSON,
+		}, nil
+	}
+
+	return &models.Transaction{
+		Hash: hashStr,
+		Data: txJsonBytes,
+	}, nil
+}
+
+// fetchByHeight fetches the transactions of a block with GetTxsEvent, see fetchTransactionsByHeight.
+// It returns nil if they could not be fetched, and disables the per-height strategy if the error is not transient.
+func (f *txFetcher) fetchByHeight(gRPCClient *client.GRPCClient, blockHeight uint64, expected int) map[string][]byte {
+	request, err := f.txsEventRequest(gRPCClient.Resolvers.Latest())
+	if err == nil {
+		var result map[string][]byte
+		result, err = fetchTransactionsByHeight(func(params []byte) ([]byte, error) {
+			return utils.GetGRPCResponse(gRPCClient, txsEventMethodFullName, f.maxRetries, params)
+		}, request, blockHeight, expected)
+		if err == nil {
+			return result
+		}
+	}
+
+	f.fallback(gRPCClient.Ctx, blockHeight, err)
+	return nil
+}
+
+// fallback handles a GetTxsEvent failure. The transactions of the block are fetched by hash, and so are those of all
+// the next blocks unless the error is transient.
+func (f *txFetcher) fallback(ctx context.Context, blockHeight uint64, err error) {
+	if ctx.Err() != nil || isTransientError(err) {
+		slog.Warn("Failed to fetch transactions by height, falling back to fetching transactions by hash",
+			"height", blockHeight,
+			"error", err)
+		return
+	}
+	if f.byHeightDisabled.CompareAndSwap(false, true) {
+		slog.Warn("GetTxsEvent is not usable on the node, e.g., transaction indexing is disabled, falling back to fetching transactions by hash",
+			"height", blockHeight,
+			"error", err)
+	}
+}
+
+// txsEventRequest returns the shape of the GetTxsEvent requests of the schema, detected once per schema.
+// The requests of all the heights have the shape of the latest schema, served by the current binary of the nodes.
+func (f *txFetcher) txsEventRequest(resolver *reflection.CustomResolver) (txsEventRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if request, ok := f.requests[resolver]; ok {
+		return request, nil
+	}
+
+	serviceName, methodName, err := utils.ParseMethodFullName(txsEventMethodFullName)
+	if err != nil {
+		return txsEventRequest{}, err
+	}
+	method, err := resolver.FindMethodDescriptor(serviceName, methodName)
+	if err != nil {
+		return txsEventRequest{}, fmt.Errorf("failed to find method descriptor: %w", err)
+	}
+
+	request := newTxsEventRequest(method)
+	f.requests[resolver] = request
+	return request, nil
+}
+
+// fetchTransactionsByHeight fetches all the transactions of a block using the paginated GetTxsEvent endpoint,
+// called with the JSON request of every page.
+// It returns the transactions in the GetTx JSON format, indexed by their lowercase hex hash.
+// Transactions missing from the result are expected to be fetched by hash by the caller.
+func fetchTransactionsByHeight(call func(params []byte) ([]byte, error), request txsEventRequest, blockHeight uint64, expected int) (map[string][]byte, error) {
+	result := make(map[string][]byte, expected)
+
+	for page := uint64(1); len(result) < expected; page++ {
+		respJsonBytes, err := call(request.params(blockHeight, page))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transactions for height %d (page %d): %w", blockHeight, page, err)
+		}
+
+		var resp getTxsEventResponse
+		if err := json.Unmarshal(respJsonBytes, &resp); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal transactions for height %d: %w", blockHeight, err)
+		}
+
+		if len(resp.TxResponses) == 0 {
+			break
+		}
+
+		for i, txResponse := range resp.TxResponses {
+			var txResp struct {
+				TxHash string `json:"txhash"`
+			}
+			if err := json.Unmarshal(txResponse, &txResp); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal transaction response: %w", err)
+			}
+
+			var tx json.RawMessage
+			if i < len(resp.Txs) {
+				tx = resp.Txs[i]
+			}
+
+			txJsonBytes, err := json.Marshal(getTxResponse{Tx: tx, TxResponse: txResponse})
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal transaction %s: %w", txResp.TxHash, err)
+			}
+			result[strings.ToLower(txResp.TxHash)] = txJsonBytes
+		}
+
+		if total, ok := resp.total(); ok && page*txsEventPageLimit >= total {
+			break
+		}
+	}
+
+	if len(result) != expected {
+		slog.Debug("Transaction count mismatch between block and GetTxsEvent",
+			"height", blockHeight,
+			"expected", expected,
+			"got", len(result))
+	}
+
+	return result, nil
+}
+
+// isTransientError returns true if the call failed because of the state of the node, e.g., unavailable or overloaded,
+// rather than because the node cannot answer it.
+func isTransientError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	case codes.ResourceExhausted:
+		return !retry.IsMessageTooLarge(err)
+	default:
+		return false
+	}
+}
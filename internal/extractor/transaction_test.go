@@ -0,0 +1,226 @@
+package extractor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// txsEventMethod returns the file of a GetTxsEvent method whose request has the given fields.
+func txsEventMethod(fields ...string) *descriptorpb.FileDescriptorProto {
+	request := &descriptorpb.DescriptorProto{Name: proto.String("GetTxsEventRequest")}
+	for i, field := range fields {
+		request.Field = append(request.Field, &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(field),
+			Number: proto.Int32(int32(i + 1)),
+			Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		})
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("cosmos/tx/v1beta1/service.proto"),
+		Package:     proto.String("cosmos.tx.v1beta1"),
+		MessageType: []*descriptorpb.DescriptorProto{request, {Name: proto.String("GetTxsEventResponse")}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Service"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("GetTxsEvent"),
+				InputType:  proto.String(".cosmos.tx.v1beta1.GetTxsEventRequest"),
+				OutputType: proto.String(".cosmos.tx.v1beta1.GetTxsEventResponse"),
+			}},
+		}},
+	}
+}
+
+func TestTxsEventRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   []string
+		expected txsEventRequest
+		params   string
+	}{
+		{
+			name:     "sdk 0.50",
+			fields:   []string{"events", "pagination", "order_by", "page", "limit", "query"},
+			expected: txsEventRequest{query: true, page: true},
+			params:   `{"query": "tx.height=10", "page": 2, "limit": 100}`,
+		},
+		{
+			name:     "sdk 0.47",
+			fields:   []string{"events", "pagination", "order_by", "page", "limit"},
+			expected: txsEventRequest{page: true},
+			params:   `{"events": ["tx.height=10"], "page": 2, "limit": 100}`,
+		},
+		{
+			name:     "sdk 0.45",
+			fields:   []string{"events", "pagination", "order_by"},
+			expected: txsEventRequest{},
+			params:   `{"events": ["tx.height=10"], "pagination": {"offset": "100", "limit": "100", "countTotal": true}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := protodesc.NewFile(txsEventMethod(tt.fields...), nil)
+			require.NoError(t, err)
+			request := newTxsEventRequest(file.Services().Get(0).Methods().Get(0))
+			assert.Equal(t, tt.expected, request)
+			assert.JSONEq(t, tt.params, string(request.params(10, 2)))
+		})
+	}
+}
+
+// txsEventPage returns a GetTxsEvent response holding the transactions of the hashes.
+func txsEventPage(total string, hashes ...string) []byte {
+	var resp struct {
+		Txs         []json.RawMessage `json:"txs"`
+		TxResponses []json.RawMessage `json:"txResponses"`
+		Total       string            `json:"total,omitempty"`
+	}
+	resp.Total = total
+	for _, hash := range hashes {
+		resp.Txs = append(resp.Txs, json.RawMessage(fmt.Sprintf(`{"body": {"memo": %q}}`, hash)))
+		resp.TxResponses = append(resp.TxResponses, json.RawMessage(fmt.Sprintf(`{"txhash": %q, "code": 0}`, hash)))
+	}
+	data, _ := json.Marshal(resp)
+	return data
+}
+
+func TestFetchTransactionsByHeight(t *testing.T) {
+	hashes := make([]string, txsEventPageLimit+1)
+	for i := range hashes {
+		hashes[i] = fmt.Sprintf("%064X", i)
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		var pages []string
+		result, err := fetchTransactionsByHeight(func(params []byte) ([]byte, error) {
+			pages = append(pages, string(params))
+			if len(pages) == 1 {
+				return txsEventPage("101", hashes[:txsEventPageLimit]...), nil
+			}
+			return txsEventPage("101", hashes[txsEventPageLimit:]...), nil
+		}, txsEventRequest{query: true, page: true}, 10, len(hashes))
+		require.NoError(t, err)
+
+		require.Len(t, pages, 2)
+		assert.JSONEq(t, `{"query": "tx.height=10", "page": 1, "limit": 100}`, pages[0])
+		assert.JSONEq(t, `{"query": "tx.height=10", "page": 2, "limit": 100}`, pages[1])
+
+		require.Len(t, result, len(hashes))
+		assert.JSONEq(t,
+			fmt.Sprintf(`{"tx": {"body": {"memo": %q}}, "txResponse": {"txhash": %q, "code": 0}}`, hashes[100], hashes[100]),
+			string(result[fmt.Sprintf("%064x", 100)]))
+	})
+
+	t.Run("total", func(t *testing.T) {
+		// The block has more transactions than reported, the missing ones are fetched by hash
+		calls := 0
+		result, err := fetchTransactionsByHeight(func(params []byte) ([]byte, error) {
+			calls++
+			return txsEventPage("2", hashes[:2]...), nil
+		}, txsEventRequest{query: true, page: true}, 10, 3)
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Len(t, result, 2)
+	})
+
+	t.Run("pagination total", func(t *testing.T) {
+		// Before Cosmos SDK 0.46, the total is in the pagination
+		calls := 0
+		result, err := fetchTransactionsByHeight(func(params []byte) ([]byte, error) {
+			calls++
+			return []byte(`{"txs": [{}], "txResponses": [{"txhash": "AB"}], "pagination": {"total": "1"}}`), nil
+		}, txsEventRequest{}, 10, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Contains(t, result, "ab")
+	})
+
+	t.Run("empty page", func(t *testing.T) {
+		calls := 0
+		result, err := fetchTransactionsByHeight(func(params []byte) ([]byte, error) {
+			calls++
+			return txsEventPage(""), nil
+		}, txsEventRequest{query: true, page: true}, 10, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Empty(t, result)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := fetchTransactionsByHeight(func(params []byte) ([]byte, error) {
+			return nil, status.Error(codes.Unavailable, "unavailable")
+		}, txsEventRequest{query: true, page: true}, 10, 1)
+		require.Error(t, err)
+		assert.True(t, isTransientError(err))
+	})
+}
+
+func TestTxFetcherFallback(t *testing.T) {
+	ctx := context.Background()
+	f := &txFetcher{}
+
+	// Transient errors fall back for the block only
+	f.fallback(ctx, 10, fmt.Errorf("failed to get transactions: %w", status.Error(codes.Unavailable, "unavailable")))
+	f.fallback(ctx, 10, status.Error(codes.DeadlineExceeded, "deadline exceeded"))
+	assert.False(t, f.byHeightDisabled.Load())
+
+	// The errors caused by the cancellation of the extraction as well
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	f.fallback(canceled, 10, canceled.Err())
+	assert.False(t, f.byHeightDisabled.Load())
+
+	// Any other error disables the per-height strategy
+	f.fallback(ctx, 10, status.Error(codes.Internal, "transaction indexing is disabled"))
+	assert.True(t, f.byHeightDisabled.Load())
+}
+
+func TestFetchTransactionByHash(t *testing.T) {
+	t.Run("permanent error", func(t *testing.T) {
+		for _, err := range []error{
+			status.Error(codes.NotFound, "tx not found"),
+			status.Error(codes.ResourceExhausted, "grpc: received message larger than max (5000000 vs. 4194304)"),
+		} {
+			tx, fetchErr := fetchTransactionByHash(func(params []byte) ([]byte, error) {
+				return nil, err
+			}, "aa")
+			require.NoError(t, fetchErr)
+			assert.Equal(t, "aa", tx.Hash)
+			assert.Contains(t, string(tx.Data), `"error": "failed to fetch transaction details"`)
+		}
+	})
+
+	t.Run("throttled", func(t *testing.T) {
+		limiter := newConcurrencyLimiter(16, true, time.Hour)
+		require.NoError(t, limiter.acquire(context.Background()))
+
+		_, err := fetchTransactionByHash(func(params []byte) ([]byte, error) {
+			return nil, fmt.Errorf("failed after 3 attempts: %w", status.Error(codes.ResourceExhausted, "rate limit exceeded"))
+		}, "aa")
+		require.Error(t, err)
+		assert.True(t, isThrottlingError(fmt.Errorf("failed to extract transactions from block: %w", err)))
+
+		// The block is released with the error, which halves the concurrency limit
+		limiter.release(time.Millisecond, err)
+		assert.Equal(t, 8, limiter.current())
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		_, err := fetchTransactionByHash(func(params []byte) ([]byte, error) {
+			return nil, context.Canceled
+		}, "aa")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
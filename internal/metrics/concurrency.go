@@ -0,0 +1,27 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ConcurrencyLimit is the number of blocks the extractor processes concurrently, adapted to the throttling of the nodes.
+var ConcurrencyLimit = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "yaci",
+		Subsystem: "extractor",
+		Name:      "concurrency_limit",
+		Help:      "Number of blocks processed concurrently",
+	},
+)
+
+// ThrottledTotal counts the blocks whose processing was throttled by the nodes, then retried.
+var ThrottledTotal = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "yaci",
+		Subsystem: "extractor",
+		Name:      "throttled_total",
+		Help:      "Number of block processing attempts throttled by the nodes",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(ConcurrencyLimit, ThrottledTotal)
+}
@@ -0,0 +1,18 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// ReorgsTotal counts the chain reorganizations detected by the extractor, by action taken.
+var ReorgsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "yaci",
+		Subsystem: "chain",
+		Name:      "reorgs_total",
+		Help:      "Number of chain reorganizations detected, by action taken",
+	},
+	[]string{"action"},
+)
+
+func init() {
+	prometheus.MustRegister(ReorgsTotal)
+}
@@ -4,10 +4,19 @@ package models
 type Block struct {
 	ID   uint64
 	Data []byte
+	// Hash is the hex-encoded hash of the block, and LastBlockHash the hash of its parent.
+	// They are empty when unknown, e.g., for blocks returned by outputs that do not store them.
+	Hash          string
+	LastBlockHash string
+	// Results holds the raw CometBFT block results, if extracted.
+	Results []byte
 }
 
 // Transaction represents a blockchain transaction.
 type Transaction struct {
 	Hash string
 	Data []byte
+	// Signers holds the addresses of the signers of each message of the transaction, by message index, as listed by
+	// the cosmos.msg.v1.signer option of the messages. The signers of a message are nil when unknown.
+	Signers [][]string
 }
@@ -0,0 +1,289 @@
+// Package flatten converts the raw JSON returned by the CosmosSDK gRPC services into flat, typed rows.
+// It is used by the output handlers that do not rely on PostgreSQL triggers to build their tables.
+package flatten
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// msgIndexAttribute is the event attribute holding the index of the message that emitted the event.
+const msgIndexAttribute = "msg_index"
+
+// senderFields lists the common names of the signer field of the messages, by precedence, and senderListFields the
+// names of the fields holding a list of signers. They are the heuristics of the api.extract_sender PostgreSQL
+// function, used when the signers of a message are unknown.
+var (
+	senderFields     = []string{"sender", "fromAddress", "signer", "authority", "admin", "proposer", "voter", "executor", "delegatorAddress", "granter", "grantee", "creator", "owner"}
+	senderListFields = []string{"proposers", "signers"}
+)
+
+// Block is a flattened cosmos.tx.v1beta1.GetBlockWithTxsResponse.
+type Block struct {
+	Height          uint64
+	Hash            string
+	LastBlockHash   string
+	ChainID         string
+	Time            time.Time
+	ProposerAddress string
+	NumTxs          int
+}
+
+// Transaction is a flattened cosmos.tx.v1beta1.GetTxResponse.
+type Transaction struct {
+	Hash      string
+	Height    uint64
+	Timestamp time.Time
+	Code      uint32
+	Codespace string
+	GasWanted int64
+	GasUsed   int64
+	Memo      string
+	// Fee is the JSON encoded fee of the transaction, if any.
+	Fee string
+	// Error is the error message of a failed transaction, or the reason why the transaction could not be fetched.
+	Error string
+}
+
+// Message is a single message of a transaction.
+type Message struct {
+	TxHash       string
+	Height       uint64
+	MessageIndex int
+	Type         string
+	// Sender is the first signer of the message, or is derived from its field names if its signers are unknown.
+	// Signers holds all the signers of the message, if known.
+	Sender  string
+	Signers []string
+	// Data is the JSON encoded message.
+	Data string
+}
+
+// Event is a single attribute of an event emitted by a transaction.
+// Events without attributes are represented by a single row with an empty key and value.
+type Event struct {
+	TxHash     string
+	Height     uint64
+	EventIndex int
+	AttrIndex  int
+	EventType  string
+	AttrKey    string
+	AttrValue  string
+	// MsgIndex is the index of the message that emitted the event, or -1 if unknown.
+	MsgIndex int
+}
+
+type blockJSON struct {
+	BlockID struct {
+		Hash string `json:"hash"`
+	} `json:"blockId"`
+	Block struct {
+		Header struct {
+			ChainID     string    `json:"chainId"`
+			Time        time.Time `json:"time"`
+			LastBlockID struct {
+				Hash string `json:"hash"`
+			} `json:"lastBlockId"`
+			ProposerAddress string `json:"proposerAddress"`
+		} `json:"header"`
+		Data struct {
+			Txs []string `json:"txs"`
+		} `json:"data"`
+	} `json:"block"`
+}
+
+type txJSON struct {
+	Tx struct {
+		Body struct {
+			Messages []json.RawMessage `json:"messages"`
+			Memo     string            `json:"memo"`
+		} `json:"body"`
+		AuthInfo struct {
+			Fee json.RawMessage `json:"fee"`
+		} `json:"authInfo"`
+	} `json:"tx"`
+	TxResponse struct {
+		Code      uint32 `json:"code"`
+		Codespace string `json:"codespace"`
+		RawLog    string `json:"rawLog"`
+		GasWanted string `json:"gasWanted"`
+		GasUsed   string `json:"gasUsed"`
+		Timestamp string `json:"timestamp"`
+		Events    []struct {
+			Type       string `json:"type"`
+			Attributes []struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			} `json:"attributes"`
+		} `json:"events"`
+	} `json:"txResponse"`
+
+	// Set when the transaction could not be fetched, see extractor.fetchTransactionByHash
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+}
+
+// ParseBlock flattens the JSON of a block.
+func ParseBlock(height uint64, data []byte) (*Block, error) {
+	var raw blockJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block %d: %w", height, err)
+	}
+
+	return &Block{
+		Height:          height,
+		Hash:            base64ToHex(raw.BlockID.Hash),
+		LastBlockHash:   base64ToHex(raw.Block.Header.LastBlockID.Hash),
+		ChainID:         raw.Block.Header.ChainID,
+		Time:            raw.Block.Header.Time,
+		ProposerAddress: base64ToHex(raw.Block.Header.ProposerAddress),
+		NumTxs:          len(raw.Block.Data.Txs),
+	}, nil
+}
+
+// ParseTransaction flattens the JSON of a transaction into the transaction itself, its messages and its events.
+// The signers of the messages, by message index, are set on the messages, see models.Transaction.
+// Transactions that could not be fetched only have their hash, height and error set.
+func ParseTransaction(height uint64, hash string, data []byte, signers [][]string) (*Transaction, []Message, []Event, error) {
+	var raw txJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to unmarshal transaction %s: %w", hash, err)
+	}
+
+	tx := &Transaction{
+		Hash:   hash,
+		Height: height,
+	}
+
+	if raw.Error != "" {
+		tx.Error = raw.Error
+		if raw.Reason != "" {
+			tx.Error = raw.Error + ": " + raw.Reason
+		}
+		return tx, nil, nil, nil
+	}
+
+	tx.Code = raw.TxResponse.Code
+	tx.Codespace = raw.TxResponse.Codespace
+	tx.GasWanted = parseInt(raw.TxResponse.GasWanted)
+	tx.GasUsed = parseInt(raw.TxResponse.GasUsed)
+	tx.Memo = raw.Tx.Body.Memo
+	if len(raw.Tx.AuthInfo.Fee) > 0 && string(raw.Tx.AuthInfo.Fee) != "null" {
+		tx.Fee = string(raw.Tx.AuthInfo.Fee)
+	}
+	if tx.Code != 0 {
+		tx.Error = raw.TxResponse.RawLog
+	}
+	if raw.TxResponse.Timestamp != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, raw.TxResponse.Timestamp)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse timestamp of transaction %s: %w", hash, err)
+		}
+		tx.Timestamp = timestamp
+	}
+
+	messages := make([]Message, 0, len(raw.Tx.Body.Messages))
+	for i, msg := range raw.Tx.Body.Messages {
+		var typed struct {
+			Type string `json:"@type"`
+		}
+		if err := json.Unmarshal(msg, &typed); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to unmarshal message %d of transaction %s: %w", i, hash, err)
+		}
+		message := Message{
+			TxHash:       hash,
+			Height:       height,
+			MessageIndex: i,
+			Type:         typed.Type,
+			Data:         string(msg),
+		}
+		if i < len(signers) && len(signers[i]) > 0 {
+			message.Sender = signers[i][0]
+			message.Signers = signers[i]
+		} else {
+			message.Sender = extractSender(msg)
+		}
+		messages = append(messages, message)
+	}
+
+	var events []Event
+	for i, event := range raw.TxResponse.Events {
+		msgIndex := -1
+		for _, attr := range event.Attributes {
+			if attr.Key == msgIndexAttribute {
+				if index, err := strconv.Atoi(attr.Value); err == nil {
+					msgIndex = index
+				}
+				break
+			}
+		}
+
+		if len(event.Attributes) == 0 {
+			events = append(events, Event{TxHash: hash, Height: height, EventIndex: i, EventType: event.Type, MsgIndex: msgIndex})
+			continue
+		}
+
+		for j, attr := range event.Attributes {
+			events = append(events, Event{
+				TxHash:     hash,
+				Height:     height,
+				EventIndex: i,
+				AttrIndex:  j,
+				EventType:  event.Type,
+				AttrKey:    attr.Key,
+				AttrValue:  attr.Value,
+				MsgIndex:   msgIndex,
+			})
+		}
+	}
+
+	return tx, messages, events, nil
+}
+
+// extractSender returns the address of the signer of a message based on the common field names, or an empty string.
+func extractSender(msg json.RawMessage) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		return ""
+	}
+
+	for _, name := range senderFields {
+		var sender string
+		if err := json.Unmarshal(fields[name], &sender); err == nil && sender != "" {
+			return sender
+		}
+	}
+	for _, name := range senderListFields {
+		var senders []string
+		if err := json.Unmarshal(fields[name], &senders); err == nil && len(senders) > 0 && senders[0] != "" {
+			return senders[0]
+		}
+	}
+	return ""
+}
+
+// base64ToHex converts a base64 encoded hash or address to the uppercase hex representation used by CometBFT.
+// Invalid inputs are returned as is.
+func base64ToHex(s string) string {
+	if s == "" {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	return strings.ToUpper(hex.EncodeToString(decoded))
+}
+
+func parseInt(s string) int64 {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
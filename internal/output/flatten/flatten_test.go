@@ -0,0 +1,142 @@
+package flatten_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/manifest-network/yaci/internal/output/flatten"
+)
+
+const blockJSON = `{
+  "blockId": {"hash": "3q2+7w=="},
+  "block": {
+    "header": {
+      "chainId": "manifest-1",
+      "height": "42",
+      "time": "2024-05-01T12:00:00.123456Z",
+      "lastBlockId": {"hash": "ASNFZw=="},
+      "proposerAddress": "q83v"
+    },
+    "data": {"txs": ["YQ==", "Yg=="]}
+  }
+}`
+
+const txJSON = `{
+  "tx": {
+    "body": {
+      "messages": [
+        {"@type": "/cosmos.bank.v1beta1.MsgSend", "fromAddress": "manifest1a", "toAddress": "manifest1b"},
+        {"@type": "/cosmos.gov.v1.MsgVote", "proposalId": "1", "voter": "manifest1v"}
+      ],
+      "memo": "hello"
+    },
+    "authInfo": {"fee": {"amount": [{"denom": "umfx", "amount": "10"}], "gasLimit": "200000"}}
+  },
+  "txResponse": {
+    "height": "42",
+    "txhash": "AABB",
+    "code": 0,
+    "gasWanted": "200000",
+    "gasUsed": "150000",
+    "timestamp": "2024-05-01T12:00:00Z",
+    "events": [
+      {"type": "tx", "attributes": [{"key": "fee", "value": "10umfx"}]},
+      {"type": "message", "attributes": [{"key": "action", "value": "send"}, {"key": "msg_index", "value": "0"}]},
+      {"type": "empty"}
+    ]
+  }
+}`
+
+func TestParseBlock(t *testing.T) {
+	block, err := flatten.ParseBlock(42, []byte(blockJSON))
+	require.NoError(t, err)
+
+	assert.Equal(t, &flatten.Block{
+		Height:          42,
+		Hash:            "DEADBEEF",
+		LastBlockHash:   "01234567",
+		ChainID:         "manifest-1",
+		Time:            time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC),
+		ProposerAddress: "ABCDEF",
+		NumTxs:          2,
+	}, block)
+
+	_, err = flatten.ParseBlock(42, []byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestParseTransaction(t *testing.T) {
+	tx, messages, events, err := flatten.ParseTransaction(42, "aabb", []byte(txJSON), [][]string{{"manifest1a"}, nil})
+	require.NoError(t, err)
+
+	assert.Equal(t, &flatten.Transaction{
+		Hash:      "aabb",
+		Height:    42,
+		Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		GasWanted: 200000,
+		GasUsed:   150000,
+		Memo:      "hello",
+		Fee:       `{"amount": [{"denom": "umfx", "amount": "10"}], "gasLimit": "200000"}`,
+	}, tx)
+
+	require.Len(t, messages, 2)
+	assert.Equal(t, "/cosmos.bank.v1beta1.MsgSend", messages[0].Type)
+	assert.Equal(t, "manifest1a", messages[0].Sender)
+	assert.Equal(t, []string{"manifest1a"}, messages[0].Signers)
+	// The sender of the messages with unknown signers is derived from their field names
+	assert.Equal(t, "manifest1v", messages[1].Sender)
+	assert.Nil(t, messages[1].Signers)
+	assert.Equal(t, 1, messages[1].MessageIndex)
+	assert.JSONEq(t, `{"@type": "/cosmos.gov.v1.MsgVote", "proposalId": "1", "voter": "manifest1v"}`, messages[1].Data)
+
+	assert.Equal(t, []flatten.Event{
+		{TxHash: "aabb", Height: 42, EventIndex: 0, AttrIndex: 0, EventType: "tx", AttrKey: "fee", AttrValue: "10umfx", MsgIndex: -1},
+		{TxHash: "aabb", Height: 42, EventIndex: 1, AttrIndex: 0, EventType: "message", AttrKey: "action", AttrValue: "send", MsgIndex: 0},
+		{TxHash: "aabb", Height: 42, EventIndex: 1, AttrIndex: 1, EventType: "message", AttrKey: "msg_index", AttrValue: "0", MsgIndex: 0},
+		{TxHash: "aabb", Height: 42, EventIndex: 2, EventType: "empty", MsgIndex: -1},
+	}, events)
+}
+
+func TestParseTransactionSender(t *testing.T) {
+	for _, tc := range []struct {
+		name, msg, sender string
+	}{
+		{"first field by precedence", `{"authority": "manifest1b", "sender": "manifest1a"}`, "manifest1a"},
+		{"null field", `{"sender": null, "creator": "manifest1c"}`, "manifest1c"},
+		{"list field", `{"proposers": ["manifest1p", "manifest1q"]}`, "manifest1p"},
+		{"no signer field", `{"proposalId": "1"}`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := `{"tx": {"body": {"messages": [` + tc.msg + `]}}, "txResponse": {"height": "42"}}`
+			_, messages, _, err := flatten.ParseTransaction(42, "aabb", []byte(data), nil)
+			require.NoError(t, err)
+			require.Len(t, messages, 1)
+			assert.Equal(t, tc.sender, messages[0].Sender)
+		})
+	}
+}
+
+func TestParseTransactionFailed(t *testing.T) {
+	data := `{"tx": {"body": {"messages": []}}, "txResponse": {"code": 5, "codespace": "sdk", "rawLog": "insufficient funds"}}`
+	tx, messages, events, err := flatten.ParseTransaction(7, "cc", []byte(data), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint32(5), tx.Code)
+	assert.Equal(t, "sdk", tx.Codespace)
+	assert.Equal(t, "insufficient funds", tx.Error)
+	assert.Empty(t, messages)
+	assert.Empty(t, events)
+}
+
+func TestParseTransactionFetchError(t *testing.T) {
+	data := `{"error": "failed to fetch transaction details", "hash": "dd", "reason": "message too large"}`
+	tx, messages, events, err := flatten.ParseTransaction(7, "dd", []byte(data), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, &flatten.Transaction{Hash: "dd", Height: 7, Error: "failed to fetch transaction details: message too large"}, tx)
+	assert.Nil(t, messages)
+	assert.Nil(t, events)
+}
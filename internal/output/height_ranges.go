@@ -0,0 +1,101 @@
+package output
+
+import (
+	"slices"
+	"sort"
+)
+
+// HeightRange is an inclusive range of block heights.
+type HeightRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// HeightRanges is a sorted set of disjoint block height ranges.
+// It is a compact representation of the blocks stored by output handlers that cannot query their own storage,
+// e.g., file-based outputs. It is not safe for concurrent use.
+type HeightRanges struct {
+	ranges []HeightRange
+}
+
+// Add adds a single block height to the set.
+func (r *HeightRanges) Add(height uint64) {
+	r.AddRange(height, height)
+}
+
+// AddRange adds the inclusive range [start, end] to the set, merging overlapping and adjacent ranges.
+func (r *HeightRanges) AddRange(start, end uint64) {
+	if start > end {
+		return
+	}
+
+	// First range that overlaps or is adjacent to [start, end]
+	i := sort.Search(len(r.ranges), func(i int) bool { return r.ranges[i].End+1 >= start })
+	// First range that starts after [start, end] and is not adjacent to it
+	j := sort.Search(len(r.ranges), func(i int) bool { return r.ranges[i].Start > end+1 })
+
+	if i < j {
+		start = min(start, r.ranges[i].Start)
+		end = max(end, r.ranges[j-1].End)
+	}
+
+	r.ranges = slices.Replace(r.ranges, i, j, HeightRange{Start: start, End: end})
+}
+
+// Truncate removes the block heights greater than or equal to the given height from the set.
+func (r *HeightRanges) Truncate(height uint64) {
+	// First range ending at or above height
+	i := sort.Search(len(r.ranges), func(i int) bool { return r.ranges[i].End >= height })
+	if i < len(r.ranges) && r.ranges[i].Start < height {
+		r.ranges[i].End = height - 1
+		i++
+	}
+	r.ranges = r.ranges[:i]
+}
+
+// Contains returns true if the given block height is in the set.
+func (r *HeightRanges) Contains(height uint64) bool {
+	_, ok := r.Range(height)
+	return ok
+}
+
+// Range returns the range of the set containing the given block height.
+func (r *HeightRanges) Range(height uint64) (HeightRange, bool) {
+	i := sort.Search(len(r.ranges), func(i int) bool { return r.ranges[i].End >= height })
+	if i < len(r.ranges) && r.ranges[i].Start <= height {
+		return r.ranges[i], true
+	}
+	return HeightRange{}, false
+}
+
+// Earliest returns the lowest block height of the set.
+func (r *HeightRanges) Earliest() (uint64, bool) {
+	if len(r.ranges) == 0 {
+		return 0, false
+	}
+	return r.ranges[0].Start, true
+}
+
+// Latest returns the highest block height of the set.
+func (r *HeightRanges) Latest() (uint64, bool) {
+	if len(r.ranges) == 0 {
+		return 0, false
+	}
+	return r.ranges[len(r.ranges)-1].End, true
+}
+
+// Missing returns the block heights between the earliest and the latest heights that are not in the set.
+func (r *HeightRanges) Missing() []uint64 {
+	var missing []uint64
+	for i := 1; i < len(r.ranges); i++ {
+		for height := r.ranges[i-1].End + 1; height < r.ranges[i].Start; height++ {
+			missing = append(missing, height)
+		}
+	}
+	return missing
+}
+
+// Ranges returns a copy of the ranges of the set, in ascending order.
+func (r *HeightRanges) Ranges() []HeightRange {
+	return slices.Clone(r.ranges)
+}
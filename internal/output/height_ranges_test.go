@@ -0,0 +1,124 @@
+package output_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+func TestHeightRanges(t *testing.T) {
+	cases := []struct {
+		name     string
+		heights  []uint64
+		ranges   []output.HeightRange
+		missing  []uint64
+		earliest uint64
+		latest   uint64
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "contiguous out of order",
+			heights:  []uint64{3, 1, 2, 5, 4},
+			ranges:   []output.HeightRange{{Start: 1, End: 5}},
+			earliest: 1,
+			latest:   5,
+		},
+		{
+			name:     "gaps",
+			heights:  []uint64{10, 1, 2, 7, 5},
+			ranges:   []output.HeightRange{{Start: 1, End: 2}, {Start: 5, End: 5}, {Start: 7, End: 7}, {Start: 10, End: 10}},
+			missing:  []uint64{3, 4, 6, 8, 9},
+			earliest: 1,
+			latest:   10,
+		},
+		{
+			name:     "filling a gap merges ranges",
+			heights:  []uint64{1, 3, 2},
+			ranges:   []output.HeightRange{{Start: 1, End: 3}},
+			earliest: 1,
+			latest:   3,
+		},
+		{
+			name:     "duplicates",
+			heights:  []uint64{4, 4, 4},
+			ranges:   []output.HeightRange{{Start: 4, End: 4}},
+			earliest: 4,
+			latest:   4,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var r output.HeightRanges
+			for _, h := range tc.heights {
+				r.Add(h)
+			}
+
+			assert.Equal(t, tc.ranges, r.Ranges())
+			assert.Equal(t, tc.missing, r.Missing())
+
+			earliest, ok := r.Earliest()
+			assert.Equal(t, len(tc.heights) > 0, ok)
+			assert.Equal(t, tc.earliest, earliest)
+
+			latest, ok := r.Latest()
+			assert.Equal(t, len(tc.heights) > 0, ok)
+			assert.Equal(t, tc.latest, latest)
+
+			for _, h := range tc.heights {
+				assert.True(t, r.Contains(h))
+			}
+			for _, h := range tc.missing {
+				assert.False(t, r.Contains(h))
+			}
+		})
+	}
+}
+
+func TestHeightRangesAddRange(t *testing.T) {
+	var r output.HeightRanges
+	r.AddRange(10, 20)
+	r.AddRange(30, 40)
+	r.AddRange(21, 29)
+	assert.Equal(t, []output.HeightRange{{Start: 10, End: 40}}, r.Ranges())
+
+	r.AddRange(1, 5)
+	r.AddRange(3, 12)
+	assert.Equal(t, []output.HeightRange{{Start: 1, End: 40}}, r.Ranges())
+
+	// Invalid ranges are ignored
+	r.AddRange(50, 45)
+	assert.Equal(t, []output.HeightRange{{Start: 1, End: 40}}, r.Ranges())
+
+	rng, ok := r.Range(25)
+	assert.True(t, ok)
+	assert.Equal(t, output.HeightRange{Start: 1, End: 40}, rng)
+
+	_, ok = r.Range(41)
+	assert.False(t, ok)
+}
+
+func TestHeightRangesTruncate(t *testing.T) {
+	var r output.HeightRanges
+	r.AddRange(1, 10)
+	r.AddRange(20, 30)
+	r.AddRange(40, 50)
+
+	r.Truncate(25)
+	assert.Equal(t, []output.HeightRange{{Start: 1, End: 10}, {Start: 20, End: 24}}, r.Ranges())
+
+	// Truncating at the start of a range removes it
+	r.Truncate(20)
+	assert.Equal(t, []output.HeightRange{{Start: 1, End: 10}}, r.Ranges())
+
+	// Truncating above the latest height is a no-op
+	r.Truncate(11)
+	assert.Equal(t, []output.HeightRange{{Start: 1, End: 10}}, r.Ranges())
+
+	r.Truncate(0)
+	assert.Empty(t, r.Ranges())
+}
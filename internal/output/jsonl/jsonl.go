@@ -0,0 +1,509 @@
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+const (
+	RecordTypeBlock        = "block"
+	RecordTypeBlockResults = "block_results"
+	RecordTypeTransaction  = "transaction"
+)
+
+// indexFileName is the name of the sidecar index listing the chunks of blocks written to the data files.
+const indexFileName = "index.jsonl"
+
+var dataFileRegexp = regexp.MustCompile(`^data-(\d+)\.jsonl(\.gz|\.zst)?$`)
+
+// Record is a single line of a data file.
+type Record struct {
+	Type   string `json:"type"`
+	Height uint64 `json:"height"`
+	// Hash is the hash of the transaction, or of the block.
+	Hash string `json:"hash,omitempty"`
+	// LastBlockHash is the hash of the parent of the block.
+	LastBlockHash string          `json:"last_block_hash,omitempty"`
+	Data          json.RawMessage `json:"data"`
+	// Signers holds the addresses of the signers of each message of the transaction, see models.Transaction.
+	Signers [][]string `json:"signers,omitempty"`
+}
+
+// indexEntry is a single line of the sidecar index, describing a chunk of blocks written to a data file.
+// An entry is only appended once the records of the chunk have been synced to the data file.
+// A rollback entry removes the blocks at and above its height from the index; the records of these blocks are
+// superseded by the records appended once they are extracted again.
+type indexEntry struct {
+	// File is the data file of the chunk, whose records start at Offset bytes of uncompressed data.
+	File   string `json:"file,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	// First and Last are the lowest and highest heights of the chunk, and LastHash the hash of the highest block.
+	First    uint64 `json:"first,omitempty"`
+	Last     uint64 `json:"last,omitempty"`
+	LastHash string `json:"last_hash,omitempty"`
+	// Ranges are the heights of the chunk, only listed when some heights between First and Last are missing.
+	Ranges []output.HeightRange `json:"ranges,omitempty"`
+	Blocks int                  `json:"blocks,omitempty"`
+	Txs    int                  `json:"txs,omitempty"`
+
+	Rollback bool   `json:"rollback,omitempty"`
+	Height   uint64 `json:"height,omitempty"`
+}
+
+// chunk holds the blocks written to the data file since the last index entry.
+type chunk struct {
+	ranges output.HeightRanges
+	offset int64
+	blocks map[uint64]chunkBlock
+}
+
+// chunkBlock is a block of a chunk.
+type chunkBlock struct {
+	hash string
+	txs  int
+}
+
+// flusher is implemented by the compressed writers.
+type flusher interface {
+	Flush() error
+}
+
+type JSONLOutputHandler struct {
+	dir         string
+	compression string
+	maxFileSize int64
+
+	mu     sync.Mutex
+	ranges output.HeightRanges
+	// latestHash is the hash of the latest block written
+	latestHash string
+	index      *os.File
+	file       *os.File
+	writer     io.Writer
+	compressor io.WriteCloser
+	fileName   string
+	fileSeq    uint64
+	fileSize   int64
+	// chunk holds the blocks written since the last flush, indexed by the next flush
+	chunk chunk
+}
+
+// NewJSONLOutputHandler creates a handler writing JSON Lines files to the given directory.
+// Data files are rotated once they reach maxFileSize uncompressed bytes. The written blocks are synced to disk
+// and indexed by chunks, on Flush, rotation, rollback and Close.
+// The sidecar index found in the directory, if any, is loaded so that extraction can resume.
+func NewJSONLOutputHandler(dir, compression string, maxFileSize int64) (*JSONLOutputHandler, error) {
+	if err := ValidateCompression(compression); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	handler := &JSONLOutputHandler{
+		dir:         dir,
+		compression: compression,
+		maxFileSize: maxFileSize,
+	}
+
+	if err := handler.loadIndex(); err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	if err := handler.scanDataFiles(); err != nil {
+		return nil, fmt.Errorf("failed to scan data files: %w", err)
+	}
+
+	index, err := os.OpenFile(filepath.Join(dir, indexFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	handler.index = index
+
+	return handler, nil
+}
+
+// ValidateCompression returns an error if the compression algorithm is not supported.
+func ValidateCompression(compression string) error {
+	switch compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression: %s, expected %s, %s or %s", compression, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+}
+
+func (h *JSONLOutputHandler) GetLatestBlock(_ context.Context) (*models.Block, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	latest, ok := h.ranges.Latest()
+	if !ok {
+		return nil, nil
+	}
+	return &models.Block{ID: latest, Hash: h.latestHash}, nil
+}
+
+func (h *JSONLOutputHandler) GetEarliestBlock(_ context.Context) (*models.Block, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	earliest, ok := h.ranges.Earliest()
+	if !ok {
+		return nil, nil
+	}
+	return &models.Block{ID: earliest}, nil
+}
+
+func (h *JSONLOutputHandler) GetMissingBlockIds(_ context.Context) ([]uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.ranges.Missing(), nil
+}
+
+func (h *JSONLOutputHandler) WriteBlockWithTransactions(_ context.Context, block *models.Block, transactions []*models.Transaction) error {
+	// Encode all the records before taking the lock
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(Record{Type: RecordTypeBlock, Height: block.ID, Hash: block.Hash, LastBlockHash: block.LastBlockHash, Data: block.Data}); err != nil {
+		return fmt.Errorf("failed to encode block: %w", err)
+	}
+	if block.Results != nil {
+		if err := enc.Encode(Record{Type: RecordTypeBlockResults, Height: block.ID, Data: block.Results}); err != nil {
+			return fmt.Errorf("failed to encode block results: %w", err)
+		}
+	}
+	for _, tx := range transactions {
+		if err := enc.Encode(Record{Type: RecordTypeTransaction, Height: block.ID, Hash: tx.Hash, Data: tx.Data, Signers: tx.Signers}); err != nil {
+			return fmt.Errorf("failed to encode transaction %s: %w", tx.Hash, err)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file == nil || (h.fileSize > 0 && h.fileSize+int64(buf.Len()) > h.maxFileSize) {
+		if err := h.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := h.writer.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write block %d: %w", block.ID, err)
+	}
+	h.fileSize += int64(buf.Len())
+
+	if h.chunk.blocks == nil {
+		h.chunk.blocks = make(map[uint64]chunkBlock)
+	}
+	h.chunk.blocks[block.ID] = chunkBlock{hash: block.Hash, txs: len(transactions)}
+	h.chunk.ranges.Add(block.ID)
+
+	if latest, ok := h.ranges.Latest(); !ok || block.ID >= latest {
+		h.latestHash = block.Hash
+	}
+	h.ranges.Add(block.ID)
+
+	return nil
+}
+
+// Flush syncs the blocks written since the last flush to disk, and indexes them.
+func (h *JSONLOutputHandler) Flush(_ context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flush()
+}
+
+// Rollback removes the blocks at and above the given height from the index, so that they are extracted again.
+// The data files are append-only: the records of the removed blocks are kept, and readers must use the last
+// record of every block height and transaction hash.
+func (h *JSONLOutputHandler) Rollback(_ context.Context, height uint64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// The written blocks below the height are indexed first, the rollback entry removes the blocks of the
+	// previous chunks
+	h.chunk.ranges.Truncate(height)
+	maps.DeleteFunc(h.chunk.blocks, func(id uint64, _ chunkBlock) bool { return id >= height })
+	if err := h.flush(); err != nil {
+		return err
+	}
+	if err := h.writeIndexEntry(indexEntry{Height: height, Rollback: true}); err != nil {
+		return err
+	}
+
+	h.ranges.Truncate(height)
+
+	return h.loadLatestHash()
+}
+
+func (h *JSONLOutputHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	slog.Info("Closing JSON Lines output", "dir", h.dir)
+	err := h.flush()
+	err = errors.Join(err, h.closeDataFile())
+	if h.index != nil {
+		err = errors.Join(err, h.index.Close())
+		h.index = nil
+	}
+	slog.Info("JSON Lines output closed")
+	return err
+}
+
+// flush syncs the blocks of the current chunk to the data file, then appends the index entry of the chunk.
+// The caller must hold the lock.
+func (h *JSONLOutputHandler) flush() error {
+	if len(h.chunk.blocks) == 0 {
+		return nil
+	}
+
+	if f, ok := h.compressor.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return fmt.Errorf("failed to flush data file %s: %w", h.fileName, err)
+		}
+	}
+	if err := h.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync data file %s: %w", h.fileName, err)
+	}
+
+	first, _ := h.chunk.ranges.Earliest()
+	last, _ := h.chunk.ranges.Latest()
+	entry := indexEntry{
+		File:     h.fileName,
+		Offset:   h.chunk.offset,
+		First:    first,
+		Last:     last,
+		LastHash: h.chunk.blocks[last].hash,
+		Blocks:   len(h.chunk.blocks),
+	}
+	for _, block := range h.chunk.blocks {
+		entry.Txs += block.txs
+	}
+	if ranges := h.chunk.ranges.Ranges(); len(ranges) > 1 {
+		entry.Ranges = ranges
+	}
+	if err := h.writeIndexEntry(entry); err != nil {
+		return err
+	}
+
+	h.chunk = chunk{offset: h.fileSize}
+	return nil
+}
+
+// writeIndexEntry appends an entry to the sidecar index, and syncs it to disk. The caller must hold the lock.
+func (h *JSONLOutputHandler) writeIndexEntry(entry indexEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode index entry: %w", err)
+	}
+	if _, err := h.index.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write index entry: %w", err)
+	}
+	if err := h.index.Sync(); err != nil {
+		return fmt.Errorf("failed to sync index: %w", err)
+	}
+	return nil
+}
+
+// rotate closes the current data file, if any, and opens a new one.
+// Data files are never appended to, as compressed streams cannot be safely resumed.
+func (h *JSONLOutputHandler) rotate() error {
+	if err := h.flush(); err != nil {
+		return err
+	}
+	if err := h.closeDataFile(); err != nil {
+		return err
+	}
+
+	h.fileSeq++
+	h.fileName = fmt.Sprintf("data-%06d.jsonl%s", h.fileSeq, extension(h.compression))
+
+	file, err := os.OpenFile(filepath.Join(h.dir, h.fileName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create data file: %w", err)
+	}
+
+	switch h.compression {
+	case CompressionGzip:
+		h.compressor = gzip.NewWriter(file)
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		h.compressor = enc
+	default:
+		h.compressor = nil
+	}
+
+	h.file = file
+	h.writer = file
+	if h.compressor != nil {
+		h.writer = h.compressor
+	}
+	h.fileSize = 0
+	h.chunk = chunk{}
+
+	slog.Debug("Opened data file", "file", h.fileName)
+
+	return nil
+}
+
+func (h *JSONLOutputHandler) closeDataFile() error {
+	if h.file == nil {
+		return nil
+	}
+
+	var err error
+	if h.compressor != nil {
+		err = h.compressor.Close()
+	}
+	err = errors.Join(err, h.file.Close())
+
+	h.file = nil
+	h.writer = nil
+	h.compressor = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to close data file %s: %w", h.fileName, err)
+	}
+	return nil
+}
+
+// loadIndex reads the sidecar index and rebuilds the set of written block heights.
+// A truncated last line, e.g., after a crash, is ignored; the blocks of the chunk are extracted again.
+func (h *JSONLOutputHandler) loadIndex() error {
+	count := 0
+	invalid, err := h.scanIndex(func(entry indexEntry) {
+		switch {
+		case entry.Rollback:
+			h.ranges.Truncate(entry.Height)
+		case len(entry.Ranges) > 0:
+			for _, r := range entry.Ranges {
+				h.ranges.AddRange(r.Start, r.End)
+			}
+		default:
+			h.ranges.AddRange(entry.First, entry.Last)
+		}
+		count += entry.Blocks
+	})
+	if err != nil {
+		return err
+	}
+	if invalid > 0 {
+		slog.Warn("Skipped invalid index entries", "count", invalid)
+	}
+
+	slog.Info("Loaded JSON Lines index", "blocks", count, "ranges", len(h.ranges.Ranges()))
+
+	return h.loadLatestHash()
+}
+
+// loadLatestHash reads the hash of the latest block from the sidecar index. It is empty for the blocks indexed
+// without their hash, and when the latest block is not the highest block of its chunk, after a rollback.
+func (h *JSONLOutputHandler) loadLatestHash() error {
+	h.latestHash = ""
+
+	latest, ok := h.ranges.Latest()
+	if !ok {
+		return nil
+	}
+
+	_, err := h.scanIndex(func(entry indexEntry) {
+		switch {
+		case entry.Rollback && entry.Height <= latest:
+			h.latestHash = ""
+		case !entry.Rollback && entry.Last == latest:
+			h.latestHash = entry.LastHash
+		}
+	})
+	return err
+}
+
+// scanIndex calls fn with every valid entry of the sidecar index, in order, and returns the number of invalid entries.
+func (h *JSONLOutputHandler) scanIndex(fn func(indexEntry)) (int, error) {
+	file, err := os.Open(filepath.Join(h.dir, indexFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	invalid := 0
+	for scanner.Scan() {
+		var entry indexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			invalid++
+			continue
+		}
+		fn(entry)
+	}
+	return invalid, scanner.Err()
+}
+
+// scanDataFiles finds the highest data file sequence number so that new files never overwrite existing ones.
+func (h *JSONLOutputHandler) scanDataFiles() error {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		matches := dataFileRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		seq, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		h.fileSeq = max(h.fileSeq, seq)
+	}
+
+	return nil
+}
+
+func extension(compression string) string {
+	switch compression {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
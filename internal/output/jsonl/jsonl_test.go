@@ -0,0 +1,241 @@
+package jsonl_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output/jsonl"
+)
+
+func writeBlock(t *testing.T, h *jsonl.JSONLOutputHandler, height uint64, txHashes ...string) {
+	t.Helper()
+
+	block := &models.Block{ID: height, Hash: fmt.Sprintf("HASH%d", height), Data: []byte(`{"block": {"header": {"height": "1"}}}`)}
+	var txs []*models.Transaction
+	for _, hash := range txHashes {
+		txs = append(txs, &models.Transaction{Hash: hash, Data: []byte(`{"tx": {}, "txResponse": {}}`)})
+	}
+	require.NoError(t, h.WriteBlockWithTransactions(context.Background(), block, txs))
+}
+
+func readRecords(t *testing.T, path string) []jsonl.Record {
+	t.Helper()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var reader io.Reader = file
+	switch filepath.Ext(path) {
+	case ".gz":
+		gz, err := gzip.NewReader(file)
+		require.NoError(t, err)
+		reader = gz
+	case ".zst":
+		zr, err := zstd.NewReader(file)
+		require.NoError(t, err)
+		defer zr.Close()
+		reader = zr
+	}
+
+	var records []jsonl.Record
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var record jsonl.Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+
+	return records
+}
+
+func TestJSONLOutputHandler(t *testing.T) {
+	for _, tc := range []struct {
+		compression string
+		file        string
+	}{
+		{compression: jsonl.CompressionNone, file: "data-000001.jsonl"},
+		{compression: jsonl.CompressionGzip, file: "data-000001.jsonl.gz"},
+		{compression: jsonl.CompressionZstd, file: "data-000001.jsonl.zst"},
+	} {
+		t.Run(tc.compression, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+
+			h, err := jsonl.NewJSONLOutputHandler(dir, tc.compression, 1024*1024)
+			require.NoError(t, err)
+
+			latest, err := h.GetLatestBlock(ctx)
+			require.NoError(t, err)
+			assert.Nil(t, latest)
+
+			writeBlock(t, h, 1, "aa", "bb")
+			writeBlock(t, h, 2)
+			writeBlock(t, h, 5, "cc")
+			require.NoError(t, h.Close())
+
+			records := readRecords(t, filepath.Join(dir, tc.file))
+			require.Len(t, records, 6)
+			assert.Equal(t, jsonl.Record{Type: jsonl.RecordTypeBlock, Height: 1, Hash: "HASH1", Data: json.RawMessage(`{"block":{"header":{"height":"1"}}}`)}, records[0])
+			assert.Equal(t, jsonl.RecordTypeTransaction, records[1].Type)
+			assert.Equal(t, "aa", records[1].Hash)
+			assert.Equal(t, uint64(1), records[2].Height)
+			assert.Equal(t, "cc", records[5].Hash)
+
+			// Reopen the handler; the index is used to resume
+			h, err = jsonl.NewJSONLOutputHandler(dir, tc.compression, 1024*1024)
+			require.NoError(t, err)
+			defer h.Close()
+
+			latest, err = h.GetLatestBlock(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, &models.Block{ID: 5, Hash: "HASH5"}, latest)
+
+			earliest, err := h.GetEarliestBlock(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(1), earliest.ID)
+
+			missing, err := h.GetMissingBlockIds(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []uint64{3, 4}, missing)
+
+			// New data is written to a new file
+			writeBlock(t, h, 3)
+			writeBlock(t, h, 4)
+			missing, err = h.GetMissingBlockIds(ctx)
+			require.NoError(t, err)
+			assert.Empty(t, missing)
+			require.NoError(t, h.Close())
+
+			assert.FileExists(t, filepath.Join(dir, "data-000002"+tc.file[len("data-000001"):]))
+		})
+	}
+}
+
+func TestJSONLOutputHandlerRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	// A tiny maximum size rotates the file after every block
+	h, err := jsonl.NewJSONLOutputHandler(dir, jsonl.CompressionNone, 1)
+	require.NoError(t, err)
+
+	writeBlock(t, h, 1, "aa")
+	writeBlock(t, h, 2, "bb")
+	writeBlock(t, h, 3, "cc")
+	require.NoError(t, h.Close())
+
+	for _, file := range []string{"data-000001.jsonl", "data-000002.jsonl", "data-000003.jsonl"} {
+		records := readRecords(t, filepath.Join(dir, file))
+		assert.Len(t, records, 2)
+	}
+}
+
+func TestJSONLOutputHandlerRollback(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	h, err := jsonl.NewJSONLOutputHandler(dir, jsonl.CompressionNone, 1024*1024)
+	require.NoError(t, err)
+
+	writeBlock(t, h, 1)
+	writeBlock(t, h, 2)
+	writeBlock(t, h, 3)
+	require.NoError(t, h.Rollback(ctx, 2))
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Block{ID: 1, Hash: "HASH1"}, latest)
+
+	writeBlock(t, h, 2)
+	require.NoError(t, h.Close())
+
+	// The rollback is replayed when the index is loaded
+	h, err = jsonl.NewJSONLOutputHandler(dir, jsonl.CompressionNone, 1024*1024)
+	require.NoError(t, err)
+	defer h.Close()
+
+	latest, err = h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Block{ID: 2, Hash: "HASH2"}, latest)
+}
+
+func TestJSONLOutputHandlerIndexChunks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	h, err := jsonl.NewJSONLOutputHandler(dir, jsonl.CompressionGzip, 1024*1024)
+	require.NoError(t, err)
+
+	// The blocks are only indexed once flushed, by chunk
+	writeBlock(t, h, 2, "aa")
+	writeBlock(t, h, 1)
+	writeBlock(t, h, 4, "bb", "cc")
+	index, err := os.ReadFile(filepath.Join(dir, "index.jsonl"))
+	require.NoError(t, err)
+	assert.Empty(t, index)
+
+	require.NoError(t, h.Flush(ctx))
+	require.NoError(t, h.Flush(ctx))
+	writeBlock(t, h, 5)
+	require.NoError(t, h.Close())
+
+	var entries []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(mustReadFile(t, filepath.Join(dir, "index.jsonl"))), []byte("\n")) {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(line, &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, map[string]any{
+		"file":      "data-000001.jsonl.gz",
+		"first":     float64(1),
+		"last":      float64(4),
+		"last_hash": "HASH4",
+		"ranges":    []any{map[string]any{"start": float64(1), "end": float64(2)}, map[string]any{"start": float64(4), "end": float64(4)}},
+		"blocks":    float64(3),
+		"txs":       float64(3),
+	}, entries[0])
+	assert.Equal(t, "data-000001.jsonl.gz", entries[1]["file"])
+	assert.Greater(t, entries[1]["offset"], float64(0))
+	assert.Equal(t, float64(5), entries[1]["first"])
+	assert.Equal(t, float64(5), entries[1]["last"])
+	assert.NotContains(t, entries[1], "ranges")
+
+	h, err = jsonl.NewJSONLOutputHandler(dir, jsonl.CompressionGzip, 1024*1024)
+	require.NoError(t, err)
+	defer h.Close()
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Block{ID: 5, Hash: "HASH5"}, latest)
+	missing, err := h.GetMissingBlockIds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{3}, missing)
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return content
+}
+
+func TestJSONLOutputHandlerInvalidCompression(t *testing.T) {
+	_, err := jsonl.NewJSONLOutputHandler(t.TempDir(), "lz4", 1)
+	assert.ErrorContains(t, err, "unsupported compression")
+}
@@ -0,0 +1,326 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const fakeDefaultPartitions = 3
+
+// fakeAPIVersions are the maximum versions of the requests supported by the fake broker.
+// They are the latest non-flexible versions, except for ApiVersions whose response header is never flexible.
+var fakeAPIVersions = map[int16]int16{
+	kmsg.ApiVersions.Int16():    3,
+	kmsg.Metadata.Int16():       4,
+	kmsg.CreateTopics.Int16():   4,
+	kmsg.InitProducerID.Int16(): 1,
+	kmsg.Produce.Int16():        7,
+	kmsg.ListOffsets.Int16():    2,
+	kmsg.Fetch.Int16():          7,
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// fakeBroker is a single node in-process Kafka broker, implementing the requests used by the client.
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu     sync.Mutex
+	topics map[string][][]fakeBatch
+	// sequences holds the next expected sequence number per producer and partition
+	sequences  map[int64]map[topicPartition]int32
+	producerID int64
+	// dropProduceResponses is the number of produce requests whose records are appended
+	// before the connection is closed without a response.
+	dropProduceResponses int
+}
+
+type fakeBatch struct {
+	baseOffset int64
+	data       []byte
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &fakeBroker{
+		t:         t,
+		listener:  listener,
+		topics:    make(map[string][][]fakeBatch),
+		sequences: make(map[int64]map[topicPartition]int32),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+
+	return b
+}
+
+func (b *fakeBroker) addr() string {
+	return b.listener.Addr().String()
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+
+		key := int16(binary.BigEndian.Uint16(body))
+		version := int16(binary.BigEndian.Uint16(body[2:]))
+		corrID := binary.BigEndian.Uint32(body[4:])
+		clientIDLength := int(int16(binary.BigEndian.Uint16(body[8:])))
+		if clientIDLength < 0 {
+			clientIDLength = 0
+		}
+
+		req := kmsg.RequestForKey(key)
+		req.SetVersion(version)
+		offset := 10 + clientIDLength
+		if req.IsFlexible() {
+			// Skip the tagged fields of the request header, the client sends none
+			offset++
+		}
+		if err := req.ReadFrom(body[offset:]); err != nil {
+			b.t.Errorf("failed to decode %s request: %v", kmsg.NameForKey(key), err)
+			return
+		}
+
+		resp, ok := b.handle(req)
+		if !ok {
+			return
+		}
+		resp.SetVersion(version)
+
+		out := binary.BigEndian.AppendUint32(make([]byte, 4), corrID)
+		out = resp.AppendTo(out)
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+// handle returns the response to the request, or false to close the connection without responding.
+func (b *fakeBroker) handle(req kmsg.Request) (kmsg.Response, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch req := req.(type) {
+	case *kmsg.ApiVersionsRequest:
+		resp := kmsg.NewPtrApiVersionsResponse()
+		for key, version := range fakeAPIVersions {
+			apiKey := kmsg.NewApiVersionsResponseApiKey()
+			apiKey.ApiKey = key
+			apiKey.MaxVersion = version
+			resp.ApiKeys = append(resp.ApiKeys, apiKey)
+		}
+		return resp, true
+	case *kmsg.MetadataRequest:
+		return b.metadata(req), true
+	case *kmsg.CreateTopicsRequest:
+		return b.createTopics(req), true
+	case *kmsg.InitProducerIDRequest:
+		b.producerID++
+		resp := kmsg.NewPtrInitProducerIDResponse()
+		resp.ProducerID = b.producerID
+		return resp, true
+	case *kmsg.ProduceRequest:
+		resp := b.produce(req)
+		if b.dropProduceResponses > 0 {
+			b.dropProduceResponses--
+			return nil, false
+		}
+		return resp, true
+	case *kmsg.ListOffsetsRequest:
+		return b.listOffsets(req), true
+	case *kmsg.FetchRequest:
+		return b.fetch(req), true
+	default:
+		b.t.Errorf("unexpected %s request", kmsg.NameForKey(req.Key()))
+		return nil, false
+	}
+}
+
+func (b *fakeBroker) metadata(req *kmsg.MetadataRequest) kmsg.Response {
+	host, port, _ := net.SplitHostPort(b.addr())
+	portNum, _ := strconv.Atoi(port)
+
+	resp := kmsg.NewPtrMetadataResponse()
+	resp.ControllerID = 0
+	broker := kmsg.NewMetadataResponseBroker()
+	broker.Host = host
+	broker.Port = int32(portNum)
+	resp.Brokers = append(resp.Brokers, broker)
+
+	for _, t := range req.Topics {
+		topic := kmsg.NewMetadataResponseTopic()
+		topic.Topic = t.Topic
+		partitions, ok := b.topics[*t.Topic]
+		if !ok {
+			topic.ErrorCode = kerr.UnknownTopicOrPartition.Code
+		}
+		for i := range partitions {
+			partition := kmsg.NewMetadataResponseTopicPartition()
+			partition.Partition = int32(i)
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		resp.Topics = append(resp.Topics, topic)
+	}
+
+	return resp
+}
+
+func (b *fakeBroker) createTopics(req *kmsg.CreateTopicsRequest) kmsg.Response {
+	resp := kmsg.NewPtrCreateTopicsResponse()
+	for _, t := range req.Topics {
+		topic := kmsg.NewCreateTopicsResponseTopic()
+		topic.Topic = t.Topic
+		if _, ok := b.topics[t.Topic]; ok {
+			topic.ErrorCode = kerr.TopicAlreadyExists.Code
+		} else {
+			n := t.NumPartitions
+			if n < 0 {
+				n = fakeDefaultPartitions
+			}
+			b.topics[t.Topic] = make([][]fakeBatch, n)
+		}
+		resp.Topics = append(resp.Topics, topic)
+	}
+	return resp
+}
+
+func (b *fakeBroker) produce(req *kmsg.ProduceRequest) kmsg.Response {
+	resp := kmsg.NewPtrProduceResponse()
+	for _, t := range req.Topics {
+		topic := kmsg.NewProduceResponseTopic()
+		topic.Topic = t.Topic
+		for _, p := range t.Partitions {
+			partition := kmsg.NewProduceResponseTopicPartition()
+			partition.Partition = p.Partition
+			partition.ErrorCode = b.append(topicPartition{t.Topic, p.Partition}, p.Records)
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		resp.Topics = append(resp.Topics, topic)
+	}
+	return resp
+}
+
+func (b *fakeBroker) append(tp topicPartition, data []byte) int16 {
+	partitions, ok := b.topics[tp.topic]
+	if !ok || int(tp.partition) >= len(partitions) {
+		return kerr.UnknownTopicOrPartition.Code
+	}
+
+	var batch kmsg.RecordBatch
+	require.NoError(b.t, batch.ReadFrom(data))
+
+	sequences, ok := b.sequences[batch.ProducerID]
+	if !ok {
+		sequences = make(map[topicPartition]int32)
+		b.sequences[batch.ProducerID] = sequences
+	}
+	switch expected := sequences[tp]; {
+	case batch.FirstSequence < expected:
+		return kerr.DuplicateSequenceNumber.Code
+	case batch.FirstSequence > expected:
+		return kerr.OutOfOrderSequenceNumber.Code
+	}
+	sequences[tp] += batch.NumRecords
+
+	log := partitions[tp.partition]
+	var next int64
+	if len(log) > 0 {
+		last := log[len(log)-1]
+		var lastBatch kmsg.RecordBatch
+		require.NoError(b.t, lastBatch.ReadFrom(last.data))
+		next = last.baseOffset + int64(lastBatch.LastOffsetDelta) + 1
+	}
+
+	stored := append([]byte(nil), data...)
+	binary.BigEndian.PutUint64(stored, uint64(next))
+	partitions[tp.partition] = append(log, fakeBatch{baseOffset: next, data: stored})
+
+	return 0
+}
+
+func (b *fakeBroker) endOffset(tp topicPartition) int64 {
+	var records int64
+	for _, batch := range b.topics[tp.topic][tp.partition] {
+		var decoded kmsg.RecordBatch
+		require.NoError(b.t, decoded.ReadFrom(batch.data))
+		records = batch.baseOffset + int64(decoded.LastOffsetDelta) + 1
+	}
+	return records
+}
+
+func (b *fakeBroker) listOffsets(req *kmsg.ListOffsetsRequest) kmsg.Response {
+	resp := kmsg.NewPtrListOffsetsResponse()
+	for _, t := range req.Topics {
+		topic := kmsg.NewListOffsetsResponseTopic()
+		topic.Topic = t.Topic
+		for _, p := range t.Partitions {
+			partition := kmsg.NewListOffsetsResponseTopicPartition()
+			partition.Partition = p.Partition
+			if p.Timestamp == -1 {
+				// Latest offset
+				partition.Offset = b.endOffset(topicPartition{t.Topic, p.Partition})
+			}
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		resp.Topics = append(resp.Topics, topic)
+	}
+	return resp
+}
+
+func (b *fakeBroker) fetch(req *kmsg.FetchRequest) kmsg.Response {
+	resp := kmsg.NewPtrFetchResponse()
+	for _, t := range req.Topics {
+		topic := kmsg.NewFetchResponseTopic()
+		topic.Topic = t.Topic
+		for _, p := range t.Partitions {
+			partition := kmsg.NewFetchResponseTopicPartition()
+			partition.Partition = p.Partition
+			partition.HighWatermark = b.endOffset(topicPartition{t.Topic, p.Partition})
+			partition.LastStableOffset = partition.HighWatermark
+			for _, batch := range b.topics[t.Topic][p.Partition] {
+				if batch.baseOffset >= p.FetchOffset {
+					partition.RecordBatches = append(partition.RecordBatches, batch.data...)
+				}
+			}
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+		resp.Topics = append(resp.Topics, topic)
+	}
+	return resp
+}
@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"github.com/manifest-network/yaci/internal/client"
+	"github.com/manifest-network/yaci/internal/config"
+)
+
+const (
+	clientID           = "yaci"
+	maxProduceAttempts = 5
+	retryBackoff       = 250 * time.Millisecond
+)
+
+// clientOptions returns the options of the Kafka clients: the brokers, the timeouts, and the TLS and SASL settings.
+// The producer is idempotent and waits for all the in-sync replicas, which are the franz-go defaults.
+func clientOptions(cfg config.KafkaConfig) ([]kgo.Opt, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ClientID(clientID),
+		kgo.DialTimeout(cfg.Timeout),
+		kgo.ProduceRequestTimeout(cfg.Timeout),
+		kgo.RecordRetries(maxProduceAttempts - 1),
+		kgo.RetryBackoffFn(func(int) time.Duration { return retryBackoff }),
+	}
+
+	if cfg.TLS {
+		tlsConfig, err := client.NewTLSConfig(cfg.TLSConfig())
+		if err != nil {
+			return nil, err
+		}
+		// The server name defaults to the host of each broker
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+
+	switch cfg.SASLMechanism {
+	case "":
+	case config.KafkaSASLPlain:
+		opts = append(opts, kgo.SASL(plain.Auth{User: cfg.SASLUsername, Pass: cfg.SASLPassword}.AsMechanism()))
+	case config.KafkaSASLScramSHA256:
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.SASLUsername, Pass: cfg.SASLPassword}.AsSha256Mechanism()))
+	case config.KafkaSASLScramSHA512:
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.SASLUsername, Pass: cfg.SASLPassword}.AsSha512Mechanism()))
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism: %s", cfg.SASLMechanism)
+	}
+
+	return opts, nil
+}
+
+// readTopic calls fn with the records of all the partitions of the topic, up to the end offsets of the partitions
+// when it is called.
+func readTopic(ctx context.Context, opts []kgo.Opt, topic string, fn func(*kgo.Record)) error {
+	consumer, err := kgo.NewClient(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	defer consumer.Close()
+
+	ends, err := kadm.NewClient(consumer).ListEndOffsets(ctx, topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list the end offsets of topic %s: %w", topic, err)
+	}
+
+	remaining := make(map[int32]int64)
+	partitions := make(map[int32]kgo.Offset)
+	ends.Each(func(o kadm.ListedOffset) {
+		if o.Offset > 0 {
+			remaining[o.Partition] = o.Offset
+			partitions[o.Partition] = kgo.NewOffset().AtStart()
+		}
+	})
+	if len(remaining) == 0 {
+		return nil
+	}
+	consumer.AddConsumePartitions(map[string]map[int32]kgo.Offset{topic: partitions})
+
+	for len(remaining) > 0 {
+		fetches := consumer.PollFetches(ctx)
+		if err := fetches.Err(); err != nil {
+			return fmt.Errorf("failed to fetch topic %s: %w", topic, err)
+		}
+		fetches.EachRecord(func(record *kgo.Record) {
+			if end, ok := remaining[record.Partition]; !ok || record.Offset >= end {
+				return
+			}
+			fn(record)
+			if record.Offset+1 >= remaining[record.Partition] {
+				delete(remaining, record.Partition)
+			}
+		})
+	}
+
+	return nil
+}
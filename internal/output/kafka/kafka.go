@@ -0,0 +1,299 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+// checkpoint is the value of the checkpoint record. It lists the block heights published so far.
+type checkpoint struct {
+	Earliest uint64               `json:"earliest"`
+	Latest   uint64               `json:"latest"`
+	Ranges   []output.HeightRange `json:"ranges"`
+}
+
+// KafkaOutputHandler publishes blocks and transactions to Kafka topics using an idempotent producer.
+// Blocks are keyed by height and transactions by hash. The published block heights are tracked in a compacted
+// checkpoint topic, under a configurable key, so that the extraction can resume.
+type KafkaOutputHandler struct {
+	cfg    config.KafkaConfig
+	opts   []kgo.Opt
+	client *kgo.Client
+
+	// checkpointMu serializes the checkpoint writes, so that a checkpoint is never superseded by an older one
+	checkpointMu sync.Mutex
+
+	// mu protects the published block heights. It is not held while producing.
+	mu             sync.Mutex
+	ranges         output.HeightRanges
+	dirty          bool
+	lastCheckpoint time.Time
+}
+
+// NewKafkaOutputHandler connects to the Kafka cluster, creates the topics if configured to,
+// and loads the last checkpoint.
+func NewKafkaOutputHandler(cfg config.KafkaConfig) (*KafkaOutputHandler, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*cfg.Timeout)
+	defer cancel()
+
+	opts, err := clientOptions(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kafka client options: %w", err)
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+
+	handler := &KafkaOutputHandler{
+		cfg:            cfg,
+		opts:           opts,
+		client:         client,
+		lastCheckpoint: time.Now(),
+	}
+
+	if cfg.CreateTopics {
+		if err := handler.createTopics(ctx); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to create topics: %w", err)
+		}
+	}
+
+	if err := handler.loadCheckpoint(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	return handler, nil
+}
+
+func (h *KafkaOutputHandler) GetLatestBlock(_ context.Context) (*models.Block, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	latest, ok := h.ranges.Latest()
+	if !ok {
+		return nil, nil
+	}
+	return &models.Block{ID: latest}, nil
+}
+
+func (h *KafkaOutputHandler) GetEarliestBlock(_ context.Context) (*models.Block, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	earliest, ok := h.ranges.Earliest()
+	if !ok {
+		return nil, nil
+	}
+	return &models.Block{ID: earliest}, nil
+}
+
+func (h *KafkaOutputHandler) GetMissingBlockIds(_ context.Context) ([]uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.ranges.Missing(), nil
+}
+
+func (h *KafkaOutputHandler) WriteBlockWithTransactions(ctx context.Context, block *models.Block, transactions []*models.Transaction) error {
+	height := []byte(strconv.FormatUint(block.ID, 10))
+
+	var blockHeaders []kgo.RecordHeader
+	if block.Hash != "" {
+		blockHeaders = append(blockHeaders, kgo.RecordHeader{Key: "hash", Value: []byte(block.Hash)})
+	}
+	if block.LastBlockHash != "" {
+		blockHeaders = append(blockHeaders, kgo.RecordHeader{Key: "last_block_hash", Value: []byte(block.LastBlockHash)})
+	}
+
+	records := []*kgo.Record{{Topic: h.cfg.BlocksTopic, Key: height, Value: block.Data, Headers: blockHeaders}}
+	if block.Results != nil {
+		records = append(records, &kgo.Record{Topic: h.cfg.BlockResultsTopic, Key: height, Value: block.Results})
+	}
+	for _, tx := range transactions {
+		headers := []kgo.RecordHeader{{Key: "height", Value: height}}
+		if tx.Signers != nil {
+			// The signers of each message, as a JSON array of arrays of addresses
+			signers, err := json.Marshal(tx.Signers)
+			if err != nil {
+				return fmt.Errorf("failed to marshal the signers of transaction %s: %w", tx.Hash, err)
+			}
+			headers = append(headers, kgo.RecordHeader{Key: "signers", Value: signers})
+		}
+		records = append(records, &kgo.Record{
+			Topic:   h.cfg.TransactionsTopic,
+			Key:     []byte(tx.Hash),
+			Value:   tx.Data,
+			Headers: headers,
+		})
+	}
+
+	if err := h.client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		return fmt.Errorf("failed to publish block %d: %w", block.ID, err)
+	}
+
+	h.mu.Lock()
+	h.ranges.Add(block.ID)
+	h.dirty = true
+	due := time.Since(h.lastCheckpoint) >= h.cfg.CheckpointInterval
+	h.mu.Unlock()
+
+	if due {
+		return h.writeCheckpoint(ctx, false)
+	}
+
+	return nil
+}
+
+// Rollback removes the blocks at and above the given height from the checkpoint, which is written right away,
+// so that they are extracted again. The published records are kept: the blocks topic is keyed by height,
+// so the records of the blocks extracted again supersede them once the topic is compacted.
+func (h *KafkaOutputHandler) Rollback(ctx context.Context, height uint64) error {
+	h.mu.Lock()
+	h.ranges.Truncate(height)
+	h.dirty = true
+	h.mu.Unlock()
+
+	return h.writeCheckpoint(ctx, true)
+}
+
+func (h *KafkaOutputHandler) Close() error {
+	slog.Info("Closing Kafka producer")
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Timeout)
+	defer cancel()
+
+	err := h.writeCheckpoint(ctx, true)
+	h.client.Close()
+
+	slog.Info("Kafka producer closed")
+	return err
+}
+
+func (h *KafkaOutputHandler) createTopics(ctx context.Context) error {
+	admin := kadm.NewClient(h.client)
+	admin.SetTimeoutMillis(int32(h.cfg.Timeout.Milliseconds()))
+
+	// Use the broker defaults for the partitions and the replication factor
+	resps, err := admin.CreateTopics(ctx, -1, -1, nil, h.cfg.BlocksTopic, h.cfg.TransactionsTopic, h.cfg.BlockResultsTopic)
+	if err != nil {
+		return err
+	}
+
+	checkpointConfigs := map[string]*string{"cleanup.policy": kadm.StringPtr("compact"), "segment.ms": kadm.StringPtr("3600000")}
+	checkpointResps, err := admin.CreateTopics(ctx, 1, -1, checkpointConfigs, h.cfg.CheckpointTopic)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, resp := range append(resps.Sorted(), checkpointResps.Sorted()...) {
+		switch {
+		case resp.Err == nil:
+			slog.Info("Created Kafka topic", "topic", resp.Topic)
+		case errors.Is(resp.Err, kerr.TopicAlreadyExists):
+		default:
+			errs = errors.Join(errs, fmt.Errorf("failed to create topic %s: %w", resp.Topic, resp.Err))
+		}
+	}
+
+	return errs
+}
+
+// writeCheckpoint publishes the published block heights to the checkpoint topic, if they changed.
+// Unless wait is set, it returns right away while another checkpoint is written: the heights published meanwhile
+// are written by the next checkpoint.
+func (h *KafkaOutputHandler) writeCheckpoint(ctx context.Context, wait bool) error {
+	if wait {
+		h.checkpointMu.Lock()
+	} else if !h.checkpointMu.TryLock() {
+		return nil
+	}
+	defer h.checkpointMu.Unlock()
+
+	h.mu.Lock()
+	if !h.dirty {
+		h.mu.Unlock()
+		return nil
+	}
+	earliest, _ := h.ranges.Earliest()
+	latest, _ := h.ranges.Latest()
+	cp := checkpoint{Earliest: earliest, Latest: latest, Ranges: h.ranges.Ranges()}
+	h.dirty = false
+	h.mu.Unlock()
+
+	err := h.produceCheckpoint(ctx, cp)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.dirty = true
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	h.lastCheckpoint = time.Now()
+	slog.Debug("Wrote Kafka checkpoint", "earliest", earliest, "latest", latest)
+
+	return nil
+}
+
+func (h *KafkaOutputHandler) produceCheckpoint(ctx context.Context, cp checkpoint) error {
+	value, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	record := &kgo.Record{Topic: h.cfg.CheckpointTopic, Key: []byte(h.cfg.CheckpointKey), Value: value}
+	return h.client.ProduceSync(ctx, record).FirstErr()
+}
+
+// loadCheckpoint reads the checkpoint topic and restores the last checkpoint written under the configured key.
+func (h *KafkaOutputHandler) loadCheckpoint(ctx context.Context) error {
+	key := []byte(h.cfg.CheckpointKey)
+
+	var value []byte
+	err := readTopic(ctx, h.opts, h.cfg.CheckpointTopic, func(record *kgo.Record) {
+		if bytes.Equal(record.Key, key) {
+			value = record.Value
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		slog.Info("No Kafka checkpoint found", "topic", h.cfg.CheckpointTopic, "key", h.cfg.CheckpointKey)
+		return nil
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(value, &cp); err != nil {
+		return fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+	}
+	if len(cp.Ranges) == 0 && cp.Latest > 0 {
+		cp.Ranges = []output.HeightRange{{Start: cp.Earliest, End: cp.Latest}}
+	}
+	for _, r := range cp.Ranges {
+		h.ranges.AddRange(r.Start, r.End)
+	}
+
+	slog.Info("Loaded Kafka checkpoint", "earliest", cp.Earliest, "latest", cp.Latest, "ranges", len(cp.Ranges))
+
+	return nil
+}
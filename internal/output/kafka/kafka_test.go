@@ -0,0 +1,275 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/models"
+)
+
+func testConfig(brokers []string, prefix string) config.KafkaConfig {
+	return config.KafkaConfig{
+		Brokers:            brokers,
+		BlocksTopic:        prefix + "blocks",
+		TransactionsTopic:  prefix + "transactions",
+		BlockResultsTopic:  prefix + "block_results",
+		CheckpointTopic:    prefix + "checkpoints",
+		CheckpointKey:      "test",
+		CheckpointInterval: time.Hour,
+		CreateTopics:       true,
+		Timeout:            5 * time.Second,
+	}
+}
+
+func writeBlock(t *testing.T, h *KafkaOutputHandler, height uint64, txHashes ...string) {
+	t.Helper()
+
+	block := &models.Block{
+		ID:      height,
+		Data:    []byte(fmt.Sprintf(`{"block": {"header": {"height": "%d"}}}`, height)),
+		Results: []byte(fmt.Sprintf(`{"height": "%d"}`, height)),
+	}
+	var txs []*models.Transaction
+	for _, hash := range txHashes {
+		txs = append(txs, &models.Transaction{Hash: hash, Data: []byte(`{"tx": {}, "txResponse": {}}`)})
+	}
+	require.NoError(t, h.WriteBlockWithTransactions(context.Background(), block, txs))
+}
+
+// readRecords returns the records of all the partitions of the topic.
+func readRecords(t *testing.T, cfg config.KafkaConfig, topic string) []*kgo.Record {
+	t.Helper()
+
+	opts, err := clientOptions(cfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	var records []*kgo.Record
+	require.NoError(t, readTopic(ctx, opts, topic, func(record *kgo.Record) {
+		records = append(records, record)
+	}))
+	return records
+}
+
+func keys(records []*kgo.Record) []string {
+	var keys []string
+	for _, record := range records {
+		keys = append(keys, string(record.Key))
+	}
+	return keys
+}
+
+func TestKafkaOutputHandler(t *testing.T) {
+	ctx := context.Background()
+	broker := newFakeBroker(t)
+	cfg := testConfig([]string{broker.addr()}, "")
+
+	h, err := NewKafkaOutputHandler(cfg)
+	require.NoError(t, err)
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, latest)
+
+	writeBlock(t, h, 1, "AAAA")
+	writeBlock(t, h, 2)
+	writeBlock(t, h, 3, "BBBB", "CCCC")
+	require.NoError(t, h.Close())
+
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, keys(readRecords(t, cfg, cfg.BlocksTopic)))
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, keys(readRecords(t, cfg, cfg.BlockResultsTopic)))
+	assert.ElementsMatch(t, []string{"AAAA", "BBBB", "CCCC"}, keys(readRecords(t, cfg, cfg.TransactionsTopic)))
+	// The checkpoint interval is not elapsed, so only the final checkpoint is written
+	assert.Len(t, readRecords(t, cfg, cfg.CheckpointTopic), 1)
+
+	// Resume from the checkpoint
+	h, err = NewKafkaOutputHandler(cfg)
+	require.NoError(t, err)
+	defer h.Close()
+
+	earliest, err := h.GetEarliestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), earliest.ID)
+
+	latest, err = h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), latest.ID)
+
+	writeBlock(t, h, 6)
+	missing, err := h.GetMissingBlockIds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{4, 5}, missing)
+}
+
+func TestKafkaOutputHandlerCheckpointInterval(t *testing.T) {
+	broker := newFakeBroker(t)
+	cfg := testConfig([]string{broker.addr()}, "")
+	cfg.CheckpointInterval = 0
+
+	h, err := NewKafkaOutputHandler(cfg)
+	require.NoError(t, err)
+
+	writeBlock(t, h, 1)
+	writeBlock(t, h, 2)
+	require.NoError(t, h.Close())
+
+	// One checkpoint per block, and none on close since nothing changed
+	records := readRecords(t, cfg, cfg.CheckpointTopic)
+	require.Len(t, records, 2)
+	assert.JSONEq(t, `{"earliest": 1, "latest": 2, "ranges": [{"start": 1, "end": 2}]}`, string(records[1].Value))
+}
+
+func TestKafkaOutputHandlerRollback(t *testing.T) {
+	ctx := context.Background()
+	broker := newFakeBroker(t)
+	cfg := testConfig([]string{broker.addr()}, "")
+
+	h, err := NewKafkaOutputHandler(cfg)
+	require.NoError(t, err)
+	defer h.Close()
+
+	writeBlock(t, h, 1)
+	writeBlock(t, h, 2)
+	writeBlock(t, h, 3)
+	require.NoError(t, h.Rollback(ctx, 2))
+
+	// The checkpoint is written right away
+	records := readRecords(t, cfg, cfg.CheckpointTopic)
+	require.Len(t, records, 1)
+	assert.JSONEq(t, `{"earliest": 1, "latest": 1, "ranges": [{"start": 1, "end": 1}]}`, string(records[0].Value))
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), latest.ID)
+}
+
+func TestKafkaOutputHandlerRetriesWithoutDuplicates(t *testing.T) {
+	broker := newFakeBroker(t)
+	cfg := testConfig([]string{broker.addr()}, "")
+
+	h, err := NewKafkaOutputHandler(cfg)
+	require.NoError(t, err)
+
+	// The records are appended, but the response is lost, so the batches are sent again
+	broker.mu.Lock()
+	broker.dropProduceResponses = 2
+	broker.mu.Unlock()
+
+	writeBlock(t, h, 1, "AAAA")
+	writeBlock(t, h, 2, "BBBB")
+	require.NoError(t, h.Close())
+
+	assert.ElementsMatch(t, []string{"1", "2"}, keys(readRecords(t, cfg, cfg.BlocksTopic)))
+	assert.ElementsMatch(t, []string{"AAAA", "BBBB"}, keys(readRecords(t, cfg, cfg.TransactionsTopic)))
+}
+
+func TestKafkaOutputHandlerConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	broker := newFakeBroker(t)
+	cfg := testConfig([]string{broker.addr()}, "")
+	cfg.CheckpointInterval = 0
+
+	h, err := NewKafkaOutputHandler(cfg)
+	require.NoError(t, err)
+
+	// The blocks are produced concurrently, the checkpoints are written one at a time
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for height := uint64(worker*25 + 1); height <= uint64(worker*25+25); height++ {
+				writeBlock(t, h, height)
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, h.Close())
+
+	assert.Len(t, readRecords(t, cfg, cfg.BlocksTopic), 200)
+	records := readRecords(t, cfg, cfg.CheckpointTopic)
+	require.NotEmpty(t, records)
+	assert.JSONEq(t, `{"earliest": 1, "latest": 200, "ranges": [{"start": 1, "end": 200}]}`, string(records[len(records)-1].Value))
+
+	h, err = NewKafkaOutputHandler(cfg)
+	require.NoError(t, err)
+	defer h.Close()
+
+	missing, err := h.GetMissingBlockIds(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+}
+
+func TestClientOptions(t *testing.T) {
+	cfg := testConfig([]string{"localhost:9092"}, "")
+	opts, err := clientOptions(cfg)
+	require.NoError(t, err)
+
+	cfg.TLS = true
+	cfg.SASLMechanism = config.KafkaSASLScramSHA512
+	cfg.SASLUsername = "user"
+	cfg.SASLPassword = "password"
+	tlsOpts, err := clientOptions(cfg)
+	require.NoError(t, err)
+	assert.Len(t, tlsOpts, len(opts)+2)
+
+	cfg.TLSCACert = filepath.Join(t.TempDir(), "missing.pem")
+	_, err = clientOptions(cfg)
+	assert.ErrorContains(t, err, "failed to read CA certificate")
+
+	cfg.TLSCACert = ""
+	cfg.SASLMechanism = "GSSAPI"
+	_, err = clientOptions(cfg)
+	assert.ErrorContains(t, err, "unsupported SASL mechanism")
+}
+
+func TestKafkaOutputHandlerMissingTopic(t *testing.T) {
+	broker := newFakeBroker(t)
+	cfg := testConfig([]string{broker.addr()}, "")
+	cfg.CreateTopics = false
+
+	_, err := NewKafkaOutputHandler(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "UNKNOWN_TOPIC_OR_PARTITION")
+}
+
+// TestKafkaIntegration runs against the brokers listed in YACI_KAFKA_BROKERS, e.g. started with docker/kafka.
+func TestKafkaIntegration(t *testing.T) {
+	brokers := os.Getenv("YACI_KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("YACI_KAFKA_BROKERS not set")
+	}
+
+	ctx := context.Background()
+	cfg := testConfig(strings.Split(brokers, ","), fmt.Sprintf("yaci-test-%d.", time.Now().UnixNano()))
+
+	h, err := NewKafkaOutputHandler(cfg)
+	require.NoError(t, err)
+
+	for height := uint64(1); height <= 10; height++ {
+		writeBlock(t, h, height, fmt.Sprintf("HASH%d", height))
+	}
+	require.NoError(t, h.Close())
+
+	h, err = NewKafkaOutputHandler(cfg)
+	require.NoError(t, err)
+	defer h.Close()
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, uint64(10), latest.ID)
+}
@@ -0,0 +1,224 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+// Output is a named output handler.
+type Output struct {
+	Name    string
+	Handler output.OutputHandler
+}
+
+// MultiOutputHandler writes every block to several output handlers.
+// The progress of the outputs is reconciled so that the laggiest output drives the resume of the extraction.
+// Outputs ahead of the laggiest one receive the re-extracted blocks again.
+type MultiOutputHandler struct {
+	outputs  []Output
+	mode     string
+	failures []atomic.Uint64
+}
+
+// NewMultiOutputHandler returns a handler writing to the outputs, handling their failures according to the output mode,
+// config.OutputModeAllOrNothing or config.OutputModeBestEffort.
+func NewMultiOutputHandler(outputs []Output, mode string) (*MultiOutputHandler, error) {
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("at least one output is required")
+	}
+	if err := config.ValidateOutputMode(mode); err != nil {
+		return nil, err
+	}
+
+	return &MultiOutputHandler{
+		outputs:  outputs,
+		mode:     mode,
+		failures: make([]atomic.Uint64, len(outputs)),
+	}, nil
+}
+
+// WriteBlockWithTransactions writes the block to all the outputs concurrently.
+func (h *MultiOutputHandler) WriteBlockWithTransactions(ctx context.Context, block *models.Block, transactions []*models.Transaction) error {
+	errs := make([]error, len(h.outputs))
+
+	var wg sync.WaitGroup
+	for i, out := range h.outputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = out.Handler.WriteBlockWithTransactions(ctx, block, transactions)
+		}()
+	}
+	wg.Wait()
+
+	var (
+		joined error
+		failed int
+	)
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed++
+		h.failures[i].Add(1)
+		joined = errors.Join(joined, fmt.Errorf("output %s: %w", h.outputs[i].Name, err))
+
+		if h.mode == config.OutputModeBestEffort {
+			slog.Error("Failed to write block to output, continuing with the other outputs", "output", h.outputs[i].Name, "height", block.ID, "error", err)
+		}
+	}
+
+	if failed == 0 || (h.mode == config.OutputModeBestEffort && failed < len(h.outputs)) {
+		return nil
+	}
+
+	return fmt.Errorf("failed to write block %d to %d of %d outputs: %w", block.ID, failed, len(h.outputs), joined)
+}
+
+// GetLatestBlock returns the lowest latest block of the outputs, or nil if any output is empty.
+func (h *MultiOutputHandler) GetLatestBlock(ctx context.Context) (*models.Block, error) {
+	var latest *models.Block
+	for _, out := range h.outputs {
+		block, err := out.Handler.GetLatestBlock(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the latest block of output %s: %w", out.Name, err)
+		}
+		if block == nil {
+			slog.Info("Output is empty, resuming from the earliest block", "output", out.Name)
+			return nil, nil
+		}
+
+		slog.Debug("Latest block of output", "output", out.Name, "height", block.ID)
+		if latest == nil || block.ID < latest.ID {
+			latest = block
+		}
+	}
+
+	return latest, nil
+}
+
+// GetEarliestBlock returns the lowest earliest block of the outputs, or nil if all the outputs are empty.
+func (h *MultiOutputHandler) GetEarliestBlock(ctx context.Context) (*models.Block, error) {
+	var earliest *models.Block
+	for _, out := range h.outputs {
+		block, err := out.Handler.GetEarliestBlock(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the earliest block of output %s: %w", out.Name, err)
+		}
+		if block != nil && (earliest == nil || block.ID < earliest.ID) {
+			earliest = block
+		}
+	}
+
+	return earliest, nil
+}
+
+// GetMissingBlockIds returns the sorted union of the missing block IDs of the outputs.
+func (h *MultiOutputHandler) GetMissingBlockIds(ctx context.Context) ([]uint64, error) {
+	var missing []uint64
+	for _, out := range h.outputs {
+		ids, err := out.Handler.GetMissingBlockIds(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the missing block IDs of output %s: %w", out.Name, err)
+		}
+		if len(ids) > 0 {
+			slog.Debug("Missing blocks in output", "output", out.Name, "count", len(ids))
+		}
+		missing = append(missing, ids...)
+	}
+
+	slices.Sort(missing)
+	return slices.Compact(missing), nil
+}
+
+// Flush flushes the outputs buffering the written blocks. The failures are handled according to the output mode.
+func (h *MultiOutputHandler) Flush(ctx context.Context) error {
+	var (
+		joined           error
+		flushers, failed int
+	)
+	for _, out := range h.outputs {
+		flusher, ok := out.Handler.(output.Flusher)
+		if !ok {
+			continue
+		}
+		flushers++
+
+		if err := flusher.Flush(ctx); err != nil {
+			failed++
+			joined = errors.Join(joined, fmt.Errorf("output %s: %w", out.Name, err))
+
+			if h.mode == config.OutputModeBestEffort {
+				slog.Error("Failed to flush output, continuing with the other outputs", "output", out.Name, "error", err)
+			}
+		}
+	}
+
+	if failed == 0 || (h.mode == config.OutputModeBestEffort && failed < flushers) {
+		return nil
+	}
+
+	return fmt.Errorf("failed to flush %d of %d outputs: %w", failed, flushers, joined)
+}
+
+// CheckChainReset checks the outputs recording the chain they were built from, whatever the output mode,
+// as a chain reset would otherwise be silently mixed with the previous chain.
+func (h *MultiOutputHandler) CheckChainReset(ctx context.Context, node output.ChainNode, policy string) error {
+	supported := false
+	for _, out := range h.outputs {
+		checker, ok := out.Handler.(output.ChainResetChecker)
+		if !ok {
+			continue
+		}
+
+		err := checker.CheckChainReset(ctx, node, policy)
+		if errors.Is(err, output.ErrChainResetUnsupported) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("output %s: %w", out.Name, err)
+		}
+		supported = true
+	}
+
+	if !supported {
+		return output.ErrChainResetUnsupported
+	}
+	return nil
+}
+
+// Rollback rolls back all the outputs, whatever the output mode, so that they stay consistent with the chain.
+func (h *MultiOutputHandler) Rollback(ctx context.Context, height uint64) error {
+	var errs error
+	for _, out := range h.outputs {
+		if err := out.Handler.Rollback(ctx, height); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to roll back output %s: %w", out.Name, err))
+		}
+	}
+
+	return errs
+}
+
+// Close closes all the outputs.
+func (h *MultiOutputHandler) Close() error {
+	var errs error
+	for i, out := range h.outputs {
+		if failures := h.failures[i].Load(); failures > 0 {
+			slog.Warn("Output failed to write blocks", "output", out.Name, "failures", failures)
+		}
+		if err := out.Handler.Close(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to close output %s: %w", out.Name, err))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,208 @@
+package multi_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output"
+	"github.com/manifest-network/yaci/internal/output/multi"
+)
+
+// memoryOutputHandler is an in-memory output handler, failing the writes of the given heights.
+type memoryOutputHandler struct {
+	mu     sync.Mutex
+	ranges output.HeightRanges
+	fail   map[uint64]bool
+	closed bool
+}
+
+func newMemoryOutputHandler(heights ...uint64) *memoryOutputHandler {
+	h := &memoryOutputHandler{fail: make(map[uint64]bool)}
+	for _, height := range heights {
+		h.ranges.Add(height)
+	}
+	return h
+}
+
+func (h *memoryOutputHandler) WriteBlockWithTransactions(_ context.Context, block *models.Block, _ []*models.Transaction) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.fail[block.ID] {
+		return errors.New("write failed")
+	}
+	h.ranges.Add(block.ID)
+	return nil
+}
+
+func (h *memoryOutputHandler) GetLatestBlock(_ context.Context) (*models.Block, error) {
+	latest, ok := h.ranges.Latest()
+	if !ok {
+		return nil, nil
+	}
+	return &models.Block{ID: latest}, nil
+}
+
+func (h *memoryOutputHandler) GetEarliestBlock(_ context.Context) (*models.Block, error) {
+	earliest, ok := h.ranges.Earliest()
+	if !ok {
+		return nil, nil
+	}
+	return &models.Block{ID: earliest}, nil
+}
+
+func (h *memoryOutputHandler) GetMissingBlockIds(_ context.Context) ([]uint64, error) {
+	return h.ranges.Missing(), nil
+}
+
+func (h *memoryOutputHandler) Rollback(_ context.Context, height uint64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.ranges.Truncate(height)
+	return nil
+}
+
+func (h *memoryOutputHandler) Close() error {
+	h.closed = true
+	return nil
+}
+
+func TestNewMultiOutputHandler(t *testing.T) {
+	_, err := multi.NewMultiOutputHandler(nil, config.OutputModeAllOrNothing)
+	assert.Error(t, err)
+
+	_, err = multi.NewMultiOutputHandler([]multi.Output{{Name: "a", Handler: newMemoryOutputHandler()}}, "foobar")
+	assert.ErrorContains(t, err, "unsupported output mode")
+}
+
+func TestAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	a, b := newMemoryOutputHandler(), newMemoryOutputHandler()
+	b.fail[2] = true
+
+	h, err := multi.NewMultiOutputHandler([]multi.Output{{Name: "a", Handler: a}, {Name: "b", Handler: b}}, config.OutputModeAllOrNothing)
+	require.NoError(t, err)
+
+	require.NoError(t, h.WriteBlockWithTransactions(ctx, &models.Block{ID: 1}, nil))
+
+	err = h.WriteBlockWithTransactions(ctx, &models.Block{ID: 2}, nil)
+	assert.ErrorContains(t, err, "failed to write block 2 to 1 of 2 outputs")
+	assert.ErrorContains(t, err, "output b: write failed")
+
+	// The laggiest output drives the resume
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), latest.ID)
+
+	require.NoError(t, h.Close())
+	assert.True(t, a.closed)
+	assert.True(t, b.closed)
+}
+
+func TestBestEffort(t *testing.T) {
+	ctx := context.Background()
+	a, b := newMemoryOutputHandler(), newMemoryOutputHandler()
+	b.fail[2] = true
+
+	h, err := multi.NewMultiOutputHandler([]multi.Output{{Name: "a", Handler: a}, {Name: "b", Handler: b}}, config.OutputModeBestEffort)
+	require.NoError(t, err)
+
+	for height := uint64(1); height <= 3; height++ {
+		require.NoError(t, h.WriteBlockWithTransactions(ctx, &models.Block{ID: height}, nil))
+	}
+
+	// The block the output failed to write is reported as missing
+	missing, err := h.GetMissingBlockIds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2}, missing)
+
+	// All the outputs failed
+	a.fail[4] = true
+	b.fail[4] = true
+	assert.ErrorContains(t, h.WriteBlockWithTransactions(ctx, &models.Block{ID: 4}, nil), "failed to write block 4 to 2 of 2 outputs")
+}
+
+func TestReconciliation(t *testing.T) {
+	ctx := context.Background()
+
+	ahead := newMemoryOutputHandler(1, 2, 3, 5, 6, 10)
+	behind := newMemoryOutputHandler(2, 4, 5, 6)
+	h, err := multi.NewMultiOutputHandler([]multi.Output{{Name: "ahead", Handler: ahead}, {Name: "behind", Handler: behind}}, config.OutputModeAllOrNothing)
+	require.NoError(t, err)
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), latest.ID)
+
+	earliest, err := h.GetEarliestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), earliest.ID)
+
+	missing, err := h.GetMissingBlockIds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{3, 4, 7, 8, 9}, missing)
+
+	// An empty output restarts the extraction from the earliest block
+	h, err = multi.NewMultiOutputHandler([]multi.Output{{Name: "ahead", Handler: ahead}, {Name: "empty", Handler: newMemoryOutputHandler()}}, config.OutputModeAllOrNothing)
+	require.NoError(t, err)
+
+	latest, err = h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, latest)
+
+	earliest, err = h.GetEarliestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), earliest.ID)
+}
+
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	a, b := newMemoryOutputHandler(1, 2, 3), newMemoryOutputHandler(1, 2)
+
+	h, err := multi.NewMultiOutputHandler([]multi.Output{{Name: "a", Handler: a}, {Name: "b", Handler: b}}, config.OutputModeBestEffort)
+	require.NoError(t, err)
+
+	require.NoError(t, h.Rollback(ctx, 2))
+	assert.Equal(t, []output.HeightRange{{Start: 1, End: 1}}, a.ranges.Ranges())
+	assert.Equal(t, []output.HeightRange{{Start: 1, End: 1}}, b.ranges.Ranges())
+}
+
+// chainResetOutputHandler records the policies it is checked with.
+type chainResetOutputHandler struct {
+	*memoryOutputHandler
+	policies []string
+	err      error
+}
+
+func (h *chainResetOutputHandler) CheckChainReset(_ context.Context, _ output.ChainNode, policy string) error {
+	h.policies = append(h.policies, policy)
+	return h.err
+}
+
+func TestCheckChainReset(t *testing.T) {
+	ctx := context.Background()
+	plain := newMemoryOutputHandler()
+
+	// None of the outputs detects chain resets
+	h, err := multi.NewMultiOutputHandler([]multi.Output{{Name: "a", Handler: plain}}, config.OutputModeBestEffort)
+	require.NoError(t, err)
+	assert.ErrorIs(t, h.CheckChainReset(ctx, nil, config.OnChainResetWipe), output.ErrChainResetUnsupported)
+
+	// The outputs detecting chain resets are checked, whatever the output mode
+	checker := &chainResetOutputHandler{memoryOutputHandler: newMemoryOutputHandler()}
+	h, err = multi.NewMultiOutputHandler([]multi.Output{{Name: "a", Handler: plain}, {Name: "b", Handler: checker}}, config.OutputModeBestEffort)
+	require.NoError(t, err)
+	require.NoError(t, h.CheckChainReset(ctx, nil, config.OnChainResetWipe))
+	assert.Equal(t, []string{config.OnChainResetWipe}, checker.policies)
+
+	checker.err = errors.New("chain reset detected")
+	assert.ErrorContains(t, h.CheckChainReset(ctx, nil, config.OnChainResetHalt), "output b: chain reset detected")
+}
@@ -2,6 +2,7 @@ package output
 
 import (
 	"context"
+	"errors"
 
 	"github.com/manifest-network/yaci/internal/models"
 )
@@ -19,6 +20,36 @@ type OutputHandler interface {
 	// GetMissingBlockIds returns the missing block IDs from the output.
 	GetMissingBlockIds(ctx context.Context) ([]uint64, error)
 
+	// Rollback removes the blocks at and above the given height, along with their transactions,
+	// so that they are extracted again, e.g., after a chain reorganization.
+	Rollback(ctx context.Context, height uint64) error
+
 	// Close closes the output handler.
 	Close() error
 }
+
+// Flusher is implemented by the output handlers buffering the written blocks.
+// Flush writes the buffered blocks, so that they are durable and visible to readers.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// ErrChainResetUnsupported is returned by CheckChainReset when the output does not record the chain it was built from.
+var ErrChainResetUnsupported = errors.New("chain reset detection not supported by the output")
+
+// ChainNode queries the chain served by the node.
+type ChainNode interface {
+	// LatestHeight returns the latest block height of the node.
+	LatestHeight() (uint64, error)
+	// EarliestHeight returns the earliest block height available on the node.
+	EarliestHeight() (uint64, error)
+	// BlockIdentity returns the chain-id of the block at the given height and its uppercase hex-encoded hash.
+	BlockIdentity(height uint64) (chainID string, hash string, err error)
+}
+
+// ChainResetChecker is implemented by the output handlers recording the chain they were built from.
+// CheckChainReset detects that the node serves a different chain, e.g., after a devnet genesis reset,
+// and handles it according to the policy, one of the config.OnChainReset* policies.
+type ChainResetChecker interface {
+	CheckChainReset(ctx context.Context, node ChainNode, policy string) error
+}
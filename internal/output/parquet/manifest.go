@@ -0,0 +1,168 @@
+package parquet
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+// manifestFileName is the name of the manifest, a log of JSON lines appended as files are written and removed.
+const manifestFileName = "manifest.jsonl"
+
+// Manifest records the Parquet files written to the output directory and the block heights they cover.
+// Files that are not listed in the manifest are incomplete and are removed when the handler starts.
+type Manifest struct {
+	Entries []ManifestEntry
+	// LastSeq is the sequence number of the last written files, including the removed ones.
+	LastSeq int
+}
+
+// ManifestEntry is a set of files, one per non-empty table, holding the data of the same block heights.
+type ManifestEntry struct {
+	// Seq is the sequence number of the files, unique in the output directory.
+	Seq int `json:"seq"`
+	// Partition is the height range of the partition the files belong to.
+	Partition output.HeightRange `json:"partition"`
+	// Heights are the block heights covered by the files.
+	Heights   []output.HeightRange    `json:"heights"`
+	Files     map[string]ManifestFile `json:"files"`
+	CreatedAt time.Time               `json:"created_at"`
+}
+
+// ManifestFile is a single Parquet file.
+type ManifestFile struct {
+	// Path is relative to the output directory.
+	Path string `json:"path"`
+	Rows int64  `json:"rows"`
+}
+
+// manifestRecord is a line of the manifest. It adds an entry, removes entries by sequence number, or both at once
+// when the files of a partition are compacted. The first line of a rewritten manifest records the last sequence
+// number, so that the sequence numbers of the removed entries are not reused.
+type manifestRecord struct {
+	Add     *ManifestEntry `json:"add,omitempty"`
+	Remove  []int          `json:"remove,omitempty"`
+	LastSeq int            `json:"last_seq,omitempty"`
+}
+
+// loadManifest replays the manifest of the given directory. A truncated last line, e.g., after a crash, is ignored:
+// the files it records are removed as orphans. The manifest is rewritten without the removed entries and the invalid
+// lines, if any, so that it does not grow with the compactions and the next lines are appended to a complete line.
+func loadManifest(dir string) (*Manifest, error) {
+	manifest := &Manifest{}
+
+	file, err := os.Open(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return manifest, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	removed, invalid := 0, 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		var record manifestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			slog.Warn("Skipping invalid Parquet manifest line", "error", err)
+			invalid++
+			continue
+		}
+		removed += manifest.apply(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if removed > 0 || invalid > 0 {
+		if err := manifest.rewrite(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// apply applies a record to the entries, and returns the number of removed entries.
+func (m *Manifest) apply(record manifestRecord) int {
+	count := len(m.Entries)
+	m.Entries = slices.DeleteFunc(m.Entries, func(entry ManifestEntry) bool { return slices.Contains(record.Remove, entry.Seq) })
+	removed := count - len(m.Entries)
+
+	if record.Add != nil {
+		m.Entries = append(m.Entries, *record.Add)
+		m.LastSeq = max(m.LastSeq, record.Add.Seq)
+	}
+	m.LastSeq = max(m.LastSeq, record.LastSeq)
+	return removed
+}
+
+// append appends a record to the manifest in the given directory, then applies it to the entries.
+func (m *Manifest) append(dir string, record manifestRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest record: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, manifestFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	m.apply(record)
+	return nil
+}
+
+// rewrite atomically replaces the manifest in the given directory with one line per entry.
+func (m *Manifest) rewrite(dir string) error {
+	data, err := json.Marshal(manifestRecord{LastSeq: m.LastSeq})
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest record: %w", err)
+	}
+	data = append(data, '\n')
+	for _, entry := range m.Entries {
+		line, err := json.Marshal(manifestRecord{Add: &entry})
+		if err != nil {
+			return fmt.Errorf("failed to marshal manifest record: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	tmp := filepath.Join(dir, manifestFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, manifestFileName)); err != nil {
+		return fmt.Errorf("failed to replace manifest: %w", err)
+	}
+
+	return nil
+}
+
+// paths returns the set of the files listed in the manifest.
+func (m *Manifest) paths() map[string]struct{} {
+	paths := make(map[string]struct{})
+	for _, entry := range m.Entries {
+		for _, file := range entry.Files {
+			paths[filepath.Clean(file.Path)] = struct{}{}
+		}
+	}
+	return paths
+}
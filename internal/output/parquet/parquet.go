@@ -0,0 +1,540 @@
+package parquet
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output"
+	"github.com/manifest-network/yaci/internal/output/flatten"
+)
+
+// partition buffers the rows of the blocks of a height range until they are written.
+type partition struct {
+	start        uint64
+	end          uint64
+	heights      output.HeightRanges
+	blocks       []blockRow
+	transactions []*flatten.Transaction
+	messages     []flatten.Message
+	events       []flatten.Event
+}
+
+type ParquetOutputHandler struct {
+	dir           string
+	compression   string
+	partitionSize uint64
+
+	mu       sync.Mutex
+	manifest *Manifest
+	// ranges are the heights written to the files listed in the manifest
+	ranges     output.HeightRanges
+	partitions map[uint64]*partition
+}
+
+// NewParquetOutputHandler creates a handler writing Parquet files to the given directory.
+// Blocks are buffered per partition of partitionSize heights, and a partition is written once all its heights,
+// from the lowest extracted one, have been received. Remaining partitions are written when the handler is flushed
+// or closed, and the files of a partition written by several flushes are compacted once it is complete.
+func NewParquetOutputHandler(dir, compression string, partitionSize uint64) (*ParquetOutputHandler, error) {
+	if err := ValidateCompression(compression); err != nil {
+		return nil, err
+	}
+	if partitionSize == 0 {
+		return nil, errors.New("partition size must be greater than 0")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	manifest, err := loadManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+
+	handler := &ParquetOutputHandler{
+		dir:           dir,
+		compression:   compression,
+		partitionSize: partitionSize,
+		manifest:      manifest,
+		partitions:    make(map[uint64]*partition),
+	}
+
+	for _, entry := range manifest.Entries {
+		for _, r := range entry.Heights {
+			handler.ranges.AddRange(r.Start, r.End)
+		}
+	}
+	slog.Info("Loaded Parquet manifest", "entries", len(manifest.Entries), "ranges", len(handler.ranges.Ranges()))
+
+	if err := handler.removeOrphans(); err != nil {
+		return nil, fmt.Errorf("failed to remove incomplete files: %w", err)
+	}
+
+	return handler, nil
+}
+
+// ValidateCompression returns an error if the compression codec is not supported.
+func ValidateCompression(compression string) error {
+	switch compression {
+	case CompressionNone, CompressionSnappy, CompressionGzip, CompressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression: %s, expected %s, %s, %s or %s", compression, CompressionNone, CompressionSnappy, CompressionGzip, CompressionZstd)
+	}
+}
+
+func (h *ParquetOutputHandler) GetLatestBlock(_ context.Context) (*models.Block, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	latest, ok := h.ranges.Latest()
+	if !ok {
+		return nil, nil
+	}
+	return &models.Block{ID: latest}, nil
+}
+
+func (h *ParquetOutputHandler) GetEarliestBlock(_ context.Context) (*models.Block, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	earliest, ok := h.ranges.Earliest()
+	if !ok {
+		return nil, nil
+	}
+	return &models.Block{ID: earliest}, nil
+}
+
+func (h *ParquetOutputHandler) GetMissingBlockIds(_ context.Context) ([]uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.ranges.Missing(), nil
+}
+
+func (h *ParquetOutputHandler) WriteBlockWithTransactions(_ context.Context, block *models.Block, transactions []*models.Transaction) error {
+	// Flatten the block before taking the lock
+	parsedBlock, err := flatten.ParseBlock(block.ID, block.Data)
+	if err != nil {
+		return err
+	}
+
+	var (
+		txs      = make([]*flatten.Transaction, 0, len(transactions))
+		messages []flatten.Message
+		events   []flatten.Event
+	)
+	for _, transaction := range transactions {
+		tx, txMessages, txEvents, err := flatten.ParseTransaction(block.ID, transaction.Hash, transaction.Data, transaction.Signers)
+		if err != nil {
+			return err
+		}
+		txs = append(txs, tx)
+		messages = append(messages, txMessages...)
+		events = append(events, txEvents...)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := (block.ID-1)/h.partitionSize*h.partitionSize + 1
+	p, ok := h.partitions[start]
+	if h.ranges.Contains(block.ID) || (ok && p.heights.Contains(block.ID)) {
+		slog.Warn("Block already written to Parquet files, skipping", "height", block.ID)
+		return nil
+	}
+	if !ok {
+		p = &partition{start: start, end: start + h.partitionSize - 1}
+		h.partitions[start] = p
+	}
+
+	p.heights.Add(block.ID)
+	p.blocks = append(p.blocks, blockRow{Block: parsedBlock, Results: block.Results})
+	p.transactions = append(p.transactions, txs...)
+	p.messages = append(p.messages, messages...)
+	p.events = append(p.events, events...)
+
+	if h.complete(p) {
+		if err := h.flushPartition(p); err != nil {
+			return err
+		}
+		// The files of the partition are valid even if not compacted, which is only reported
+		if err := h.compact(output.HeightRange{Start: p.start, End: p.end}); err != nil {
+			slog.Warn("Failed to compact Parquet partition", "start", p.start, "end", p.end, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// complete returns true if the heights of the partition form a contiguous run up to its end,
+// taking into account the heights already written to the files.
+func (h *ParquetOutputHandler) complete(p *partition) bool {
+	earliest, _ := p.heights.Earliest()
+	height := p.end
+	for height >= earliest {
+		r, ok := p.heights.Range(height)
+		if !ok {
+			if r, ok = h.ranges.Range(height); !ok {
+				return false
+			}
+		}
+		height = r.Start - 1
+	}
+	return true
+}
+
+// Rollback removes the blocks at and above the given height. The buffered rows of these blocks are dropped,
+// and the files holding any of them are removed along with their manifest entry. The blocks below the given height
+// held by the removed files are extracted again, as missing blocks or as the latest blocks.
+func (h *ParquetOutputHandler) Rollback(_ context.Context, height uint64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for start, p := range h.partitions {
+		if p.end < height {
+			continue
+		}
+		p.heights.Truncate(height)
+		if _, ok := p.heights.Earliest(); !ok {
+			delete(h.partitions, start)
+			continue
+		}
+		p.blocks = slices.DeleteFunc(p.blocks, func(b blockRow) bool { return b.Height >= height })
+		p.transactions = slices.DeleteFunc(p.transactions, func(tx *flatten.Transaction) bool { return tx.Height >= height })
+		p.messages = slices.DeleteFunc(p.messages, func(msg flatten.Message) bool { return msg.Height >= height })
+		p.events = slices.DeleteFunc(p.events, func(event flatten.Event) bool { return event.Height >= height })
+	}
+
+	var removed []ManifestEntry
+	for _, entry := range h.manifest.Entries {
+		if n := len(entry.Heights); n > 0 && entry.Heights[n-1].End >= height {
+			removed = append(removed, entry)
+		}
+	}
+
+	if len(removed) > 0 {
+		seqs := make([]int, 0, len(removed))
+		for _, entry := range removed {
+			seqs = append(seqs, entry.Seq)
+		}
+		if err := h.manifest.append(h.dir, manifestRecord{Remove: seqs}); err != nil {
+			return err
+		}
+
+		h.removeFiles(removed)
+		slog.Info("Removed rolled back Parquet files", "entries", len(removed))
+	}
+
+	h.ranges = output.HeightRanges{}
+	for _, entry := range h.manifest.Entries {
+		for _, r := range entry.Heights {
+			h.ranges.AddRange(r.Start, r.End)
+		}
+	}
+
+	return nil
+}
+
+// Flush writes the buffered partitions, complete or not. The heights missing from a written partition
+// are written to other files of the partition, which are compacted once the partition is complete.
+func (h *ParquetOutputHandler) Flush(_ context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flushPartitions()
+}
+
+func (h *ParquetOutputHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	slog.Info("Closing Parquet output", "dir", h.dir, "partitions", len(h.partitions))
+	err := h.flushPartitions()
+	slog.Info("Parquet output closed")
+	return err
+}
+
+// flushPartitions writes the buffered partitions in height order. The caller must hold the lock.
+func (h *ParquetOutputHandler) flushPartitions() error {
+	starts := make([]uint64, 0, len(h.partitions))
+	for start := range h.partitions {
+		starts = append(starts, start)
+	}
+	slices.Sort(starts)
+
+	var err error
+	for _, start := range starts {
+		err = errors.Join(err, h.flushPartition(h.partitions[start]))
+	}
+	return err
+}
+
+// flushPartition writes the buffered rows of the partition to one file per table and records them in the manifest.
+// The heights of the partition are only reported as written once the files and the manifest are written.
+func (h *ParquetOutputHandler) flushPartition(p *partition) error {
+	// Entries removed by a rollback or a compaction do not free their sequence number
+	seq := h.manifest.LastSeq + 1
+	entry := ManifestEntry{
+		Seq:       seq,
+		Partition: output.HeightRange{Start: p.start, End: p.end},
+		Heights:   p.heights.Ranges(),
+		Files:     make(map[string]ManifestFile),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	// Sort the rows by height so that the statistics of the files are useful
+	slices.SortFunc(p.blocks, func(a, b blockRow) int { return cmp.Compare(a.Height, b.Height) })
+	slices.SortStableFunc(p.transactions, func(a, b *flatten.Transaction) int { return cmp.Compare(a.Height, b.Height) })
+	slices.SortStableFunc(p.messages, func(a, b flatten.Message) int { return cmp.Compare(a.Height, b.Height) })
+	slices.SortStableFunc(p.events, func(a, b flatten.Event) int { return cmp.Compare(a.Height, b.Height) })
+
+	for _, table := range tables {
+		var rows [][]any
+		switch table {
+		case TableBlocks:
+			for _, block := range p.blocks {
+				rows = append(rows, block.values())
+			}
+		case TableTransactions:
+			for _, tx := range p.transactions {
+				rows = append(rows, transactionValues(tx))
+			}
+		case TableMessages:
+			for _, msg := range p.messages {
+				rows = append(rows, messageValues(msg))
+			}
+		case TableEvents:
+			for _, event := range p.events {
+				rows = append(rows, eventValues(event))
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		path := partitionFilePath(table, entry.Partition, seq)
+		err := h.writeFile(path, tableColumns[table], func(w *Writer) error {
+			for _, row := range rows {
+				if err := w.Write(row...); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		entry.Files[table] = ManifestFile{Path: path, Rows: int64(len(rows))}
+	}
+
+	if err := h.manifest.append(h.dir, manifestRecord{Add: &entry}); err != nil {
+		return err
+	}
+
+	delete(h.partitions, p.start)
+	for _, r := range entry.Heights {
+		h.ranges.AddRange(r.Start, r.End)
+	}
+
+	slog.Debug("Wrote Parquet partition", "start", p.start, "end", p.end, "blocks", len(p.blocks), "seq", seq)
+
+	return nil
+}
+
+// compact merges the files of a complete partition, written by several flushes or runs, into one file per table,
+// so that the number of files does not grow with the number of flushes. The caller must hold the lock.
+func (h *ParquetOutputHandler) compact(partition output.HeightRange) error {
+	var entries []ManifestEntry
+	for _, entry := range h.manifest.Entries {
+		if entry.Partition == partition {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) < 2 {
+		return nil
+	}
+
+	seq := h.manifest.LastSeq + 1
+	merged := ManifestEntry{
+		Seq:       seq,
+		Partition: partition,
+		Files:     make(map[string]ManifestFile),
+		CreatedAt: time.Now().UTC(),
+	}
+	var heights output.HeightRanges
+	remove := make([]int, 0, len(entries))
+	for _, entry := range entries {
+		for _, r := range entry.Heights {
+			heights.AddRange(r.Start, r.End)
+		}
+		remove = append(remove, entry.Seq)
+	}
+	merged.Heights = heights.Ranges()
+
+	for _, table := range tables {
+		var rows []parquet.Row
+		for _, entry := range entries {
+			file, ok := entry.Files[table]
+			if !ok {
+				continue
+			}
+			fileRows, err := readRows(filepath.Join(h.dir, file.Path))
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", file.Path, err)
+			}
+			rows = append(rows, fileRows...)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		// Sort the rows by height, as the heights of the files may interleave
+		height := slices.IndexFunc(tableColumns[table], func(c Column) bool { return c.Name == "height" })
+		slices.SortStableFunc(rows, func(a, b parquet.Row) int { return cmp.Compare(a[height].Int64(), b[height].Int64()) })
+
+		path := partitionFilePath(table, partition, seq)
+		if err := h.writeFile(path, tableColumns[table], func(w *Writer) error { return w.WriteRows(rows) }); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		merged.Files[table] = ManifestFile{Path: path, Rows: int64(len(rows))}
+	}
+
+	if err := h.manifest.append(h.dir, manifestRecord{Add: &merged, Remove: remove}); err != nil {
+		return err
+	}
+	h.removeFiles(entries)
+
+	slog.Debug("Compacted Parquet partition", "start", partition.Start, "end", partition.End, "files", len(entries), "seq", seq)
+
+	return nil
+}
+
+// removeFiles removes the files of the entries, removed from the manifest.
+func (h *ParquetOutputHandler) removeFiles(entries []ManifestEntry) {
+	for _, entry := range entries {
+		for _, file := range entry.Files {
+			if err := os.Remove(filepath.Join(h.dir, file.Path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				slog.Warn("Failed to remove Parquet file", "file", file.Path, "error", err)
+			}
+		}
+	}
+}
+
+// partitionFilePath returns the path of a file of a partition, relative to the output directory.
+func partitionFilePath(table string, partition output.HeightRange, seq int) string {
+	return filepath.Join(table, fmt.Sprintf("heights=%012d-%012d", partition.Start, partition.End), fmt.Sprintf("part-%06d.parquet", seq))
+}
+
+// readRows reads all the rows of a Parquet file.
+func readRows(path string) ([]parquet.Row, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	rows := make([]parquet.Row, 0, reader.NumRows())
+	buf := make([]parquet.Row, 64)
+	for {
+		n, err := reader.ReadRows(buf)
+		for _, row := range buf[:n] {
+			rows = append(rows, row.Clone())
+		}
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// writeFile writes a file to a temporary file, renamed once it is complete.
+func (h *ParquetOutputHandler) writeFile(path string, columns []Column, write func(*Writer) error) error {
+	fullPath := filepath.Join(h.dir, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return err
+	}
+
+	tmp := fullPath + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	w, err := NewWriter(file, columns, h.compression)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err := write(w); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, fullPath)
+}
+
+// removeOrphans removes the Parquet files that are not listed in the manifest,
+// i.e., files written by a previous run that stopped before updating the manifest.
+func (h *ParquetOutputHandler) removeOrphans() error {
+	known := h.manifest.paths()
+
+	for _, table := range tables {
+		root := filepath.Join(h.dir, table)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || !(strings.HasSuffix(path, ".parquet") || strings.HasSuffix(path, ".parquet.tmp")) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(h.dir, path)
+			if err != nil {
+				return err
+			}
+			if _, ok := known[rel]; ok {
+				return nil
+			}
+
+			slog.Warn("Removing Parquet file missing from the manifest", "file", rel)
+			return os.Remove(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
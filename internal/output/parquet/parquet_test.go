@@ -0,0 +1,247 @@
+package parquet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+const testTxJSON = `{
+  "tx": {"body": {"messages": [{"@type": "/cosmos.bank.v1beta1.MsgSend", "fromAddress": "a"}]}},
+  "txResponse": {"gasWanted": "10", "gasUsed": "5", "timestamp": "2024-05-01T12:00:00Z",
+    "events": [{"type": "message", "attributes": [{"key": "action", "value": "send"}, {"key": "msg_index", "value": "0"}]}]}
+}`
+
+func writeTestBlock(t *testing.T, h *ParquetOutputHandler, height uint64, numTxs int) {
+	t.Helper()
+
+	var (
+		txs    []*models.Transaction
+		rawTxs []string
+	)
+	for i := range numTxs {
+		txs = append(txs, &models.Transaction{Hash: fmt.Sprintf("%d-%d", height, i), Data: []byte(testTxJSON), Signers: [][]string{{"a"}}})
+		rawTxs = append(rawTxs, `"YQ=="`)
+	}
+	block := &models.Block{
+		ID: height,
+		Data: []byte(fmt.Sprintf(`{"blockId": {"hash": "3q2+7w=="}, "block": {"header": {"chainId": "test-1", "height": "%d", "time": "2024-05-01T12:00:00Z"}, "data": {"txs": [%s]}}}`,
+			height, strings.Join(rawTxs, ","))),
+	}
+	require.NoError(t, h.WriteBlockWithTransactions(context.Background(), block, txs))
+}
+
+func TestParquetOutputHandler(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	h, err := NewParquetOutputHandler(dir, CompressionSnappy, 5)
+	require.NoError(t, err)
+
+	// Partition [1, 5] is complete once block 5 is written, in any order
+	for _, height := range []uint64{2, 1, 4, 3} {
+		writeTestBlock(t, h, height, 1)
+	}
+	assert.NoFileExists(t, filepath.Join(dir, manifestFileName))
+	writeTestBlock(t, h, 5, 2)
+	assert.FileExists(t, filepath.Join(dir, manifestFileName))
+
+	// Partition [6, 10] is incomplete and written on close
+	writeTestBlock(t, h, 6, 0)
+	writeTestBlock(t, h, 8, 1)
+	require.NoError(t, h.Close())
+
+	manifest, err := loadManifest(dir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Entries, 2)
+	assert.Equal(t, []output.HeightRange{{Start: 1, End: 5}}, manifest.Entries[0].Heights)
+	assert.Equal(t, []output.HeightRange{{Start: 6, End: 6}, {Start: 8, End: 8}}, manifest.Entries[1].Heights)
+	assert.Equal(t, ManifestFile{Path: "transactions/heights=000000000001-000000000005/part-000001.parquet", Rows: 6}, manifest.Entries[0].Files[TableTransactions])
+
+	blocks := readParquet(t, filepath.Join(dir, manifest.Entries[0].Files[TableBlocks].Path))
+	assert.Equal(t, []any{int64(1), int64(2), int64(3), int64(4), int64(5)}, blocks.rows[0])
+	assert.Equal(t, "DEADBEEF", blocks.rows[1][0])
+	assert.Equal(t, "test-1", blocks.rows[3][0])
+	assert.Equal(t, int64(2), blocks.rows[6][4])
+
+	events := readParquet(t, filepath.Join(dir, manifest.Entries[1].Files[TableEvents].Path))
+	assert.Equal(t, []any{"8-0", "8-0"}, events.rows[0])
+	assert.Equal(t, []any{"action", "msg_index"}, events.rows[5])
+	assert.Equal(t, []any{int64(0), int64(0)}, events.rows[7])
+
+	messages := readParquet(t, filepath.Join(dir, manifest.Entries[1].Files[TableMessages].Path))
+	assert.Equal(t, []any{"a"}, messages.rows[5])
+	assert.Equal(t, []any{`["a"]`}, messages.rows[6])
+
+	// Resume from the manifest
+	h, err = NewParquetOutputHandler(dir, CompressionSnappy, 5)
+	require.NoError(t, err)
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(8), latest.ID)
+
+	earliest, err := h.GetEarliestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), earliest.ID)
+
+	missing, err := h.GetMissingBlockIds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{7}, missing)
+
+	// Filling the gap completes the partition once block 10 is written
+	writeTestBlock(t, h, 7, 0)
+	writeTestBlock(t, h, 9, 0)
+	writeTestBlock(t, h, 10, 0)
+	h.mu.Lock()
+	assert.Empty(t, h.partitions)
+	h.mu.Unlock()
+	require.NoError(t, h.Close())
+
+	// The files of the two runs are compacted, with the rows sorted by height
+	previous := manifest.Entries[1]
+	manifest, err = loadManifest(dir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Entries, 2)
+	assert.Equal(t, []output.HeightRange{{Start: 6, End: 10}}, manifest.Entries[1].Heights)
+	assert.Equal(t, ManifestFile{Path: "transactions/heights=000000000006-000000000010/part-000004.parquet", Rows: 1}, manifest.Entries[1].Files[TableTransactions])
+	for _, file := range previous.Files {
+		assert.NoFileExists(t, filepath.Join(dir, file.Path))
+	}
+
+	blocks = readParquet(t, filepath.Join(dir, manifest.Entries[1].Files[TableBlocks].Path))
+	assert.Equal(t, []any{int64(6), int64(7), int64(8), int64(9), int64(10)}, blocks.rows[0])
+	events = readParquet(t, filepath.Join(dir, manifest.Entries[1].Files[TableEvents].Path))
+	assert.Equal(t, []any{"8-0", "8-0"}, events.rows[0])
+}
+
+func TestParquetOutputHandlerRemovesOrphans(t *testing.T) {
+	dir := t.TempDir()
+
+	h, err := NewParquetOutputHandler(dir, CompressionNone, 10)
+	require.NoError(t, err)
+	writeTestBlock(t, h, 1, 1)
+	require.NoError(t, h.Close())
+
+	orphan := filepath.Join(dir, TableBlocks, "heights=000000000001-000000000010", "part-000002.parquet")
+	require.NoError(t, os.WriteFile(orphan, []byte("incomplete"), 0o644))
+
+	_, err = NewParquetOutputHandler(dir, CompressionNone, 10)
+	require.NoError(t, err)
+	assert.NoFileExists(t, orphan)
+	assert.FileExists(t, filepath.Join(dir, TableBlocks, "heights=000000000001-000000000010", "part-000001.parquet"))
+}
+
+func TestParquetOutputHandlerRollback(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	h, err := NewParquetOutputHandler(dir, CompressionNone, 5)
+	require.NoError(t, err)
+
+	// Partition [1, 5] is written, partition [6, 10] is buffered
+	for height := uint64(1); height <= 7; height++ {
+		writeTestBlock(t, h, height, 1)
+	}
+	written, err := loadManifest(dir)
+	require.NoError(t, err)
+	require.Len(t, written.Entries, 1)
+
+	require.NoError(t, h.Rollback(ctx, 4))
+
+	// The files of partition [1, 5] are removed, including blocks 1 to 3
+	manifest, err := loadManifest(dir)
+	require.NoError(t, err)
+	assert.Empty(t, manifest.Entries)
+	assert.NoFileExists(t, filepath.Join(dir, written.Entries[0].Files[TableBlocks].Path))
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, latest)
+	h.mu.Lock()
+	assert.Empty(t, h.partitions)
+	h.mu.Unlock()
+
+	// The blocks are written again, without reusing the sequence number of the removed files
+	for height := uint64(1); height <= 5; height++ {
+		writeTestBlock(t, h, height, 1)
+	}
+	require.NoError(t, h.Close())
+
+	manifest, err = loadManifest(dir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Entries, 1)
+	assert.Equal(t, "blocks/heights=000000000001-000000000005/part-000002.parquet", manifest.Entries[0].Files[TableBlocks].Path)
+}
+
+func TestParquetOutputHandlerFlush(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	h, err := NewParquetOutputHandler(dir, CompressionNone, 5)
+	require.NoError(t, err)
+
+	// The buffered blocks are not reported as written
+	writeTestBlock(t, h, 1, 1)
+	writeTestBlock(t, h, 2, 1)
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, latest)
+
+	require.NoError(t, h.Flush(ctx))
+	latest, err = h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), latest.ID)
+
+	// The partition is complete once the heights following the flushed ones are written
+	writeTestBlock(t, h, 2, 1)
+	for height := uint64(3); height <= 5; height++ {
+		writeTestBlock(t, h, height, 1)
+	}
+	h.mu.Lock()
+	assert.Empty(t, h.partitions)
+	h.mu.Unlock()
+
+	// The files of the flushes are compacted, and the manifest is appended to
+	lines := strings.Split(strings.TrimSpace(string(mustReadFile(t, filepath.Join(dir, manifestFileName)))), "\n")
+	assert.Len(t, lines, 3)
+	manifest, err := loadManifest(dir)
+	require.NoError(t, err)
+	require.Len(t, manifest.Entries, 1)
+	assert.Equal(t, []output.HeightRange{{Start: 1, End: 5}}, manifest.Entries[0].Heights)
+	assert.Equal(t, ManifestFile{Path: "blocks/heights=000000000001-000000000005/part-000003.parquet", Rows: 5}, manifest.Entries[0].Files[TableBlocks])
+	assert.NoFileExists(t, filepath.Join(dir, "blocks/heights=000000000001-000000000005/part-000001.parquet"))
+	assert.NoFileExists(t, filepath.Join(dir, "blocks/heights=000000000001-000000000005/part-000002.parquet"))
+
+	blocks := readParquet(t, filepath.Join(dir, manifest.Entries[0].Files[TableBlocks].Path))
+	assert.Equal(t, []any{int64(1), int64(2), int64(3), int64(4), int64(5)}, blocks.rows[0])
+	require.NoError(t, h.Close())
+
+	// The manifest is rewritten without the removed entries when loaded, keeping the last sequence number
+	h, err = NewParquetOutputHandler(dir, CompressionNone, 5)
+	require.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(string(mustReadFile(t, filepath.Join(dir, manifestFileName)))), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, 3, h.manifest.LastSeq)
+	latest, err = h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), latest.ID)
+	require.NoError(t, h.Close())
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return content
+}
@@ -0,0 +1,151 @@
+package parquet
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/manifest-network/yaci/internal/output/flatten"
+)
+
+const (
+	TableBlocks       = "blocks"
+	TableTransactions = "transactions"
+	TableMessages     = "messages"
+	TableEvents       = "events"
+)
+
+// tables lists the tables in the order they are written.
+var tables = []string{TableBlocks, TableTransactions, TableMessages, TableEvents}
+
+var tableColumns = map[string][]Column{
+	TableBlocks: {
+		{Name: "height", Kind: KindInt64},
+		{Name: "hash", Kind: KindString},
+		{Name: "last_block_hash", Kind: KindString, Optional: true},
+		{Name: "chain_id", Kind: KindString},
+		{Name: "time", Kind: KindTimestamp, Optional: true},
+		{Name: "proposer_address", Kind: KindString, Optional: true},
+		{Name: "num_txs", Kind: KindInt64},
+		{Name: "results", Kind: KindJSON, Optional: true},
+	},
+	TableTransactions: {
+		{Name: "hash", Kind: KindString},
+		{Name: "height", Kind: KindInt64},
+		{Name: "timestamp", Kind: KindTimestamp, Optional: true},
+		{Name: "code", Kind: KindInt64},
+		{Name: "codespace", Kind: KindString, Optional: true},
+		{Name: "gas_wanted", Kind: KindInt64},
+		{Name: "gas_used", Kind: KindInt64},
+		{Name: "memo", Kind: KindString, Optional: true},
+		{Name: "fee", Kind: KindJSON, Optional: true},
+		{Name: "error", Kind: KindString, Optional: true},
+	},
+	TableMessages: {
+		{Name: "tx_hash", Kind: KindString},
+		{Name: "height", Kind: KindInt64},
+		{Name: "message_index", Kind: KindInt64},
+		{Name: "type", Kind: KindString},
+		{Name: "data", Kind: KindJSON},
+		{Name: "sender", Kind: KindString, Optional: true},
+		{Name: "signers", Kind: KindJSON, Optional: true},
+	},
+	TableEvents: {
+		{Name: "tx_hash", Kind: KindString},
+		{Name: "height", Kind: KindInt64},
+		{Name: "event_index", Kind: KindInt64},
+		{Name: "attr_index", Kind: KindInt64},
+		{Name: "event_type", Kind: KindString},
+		{Name: "attr_key", Kind: KindString},
+		{Name: "attr_value", Kind: KindString},
+		{Name: "msg_index", Kind: KindInt64, Optional: true},
+	},
+}
+
+// blockRow is a flattened block along with its raw block results.
+type blockRow struct {
+	*flatten.Block
+	Results []byte
+}
+
+func (b blockRow) values() []any {
+	return []any{
+		int64(b.Height),
+		b.Hash,
+		nullString(b.LastBlockHash),
+		b.ChainID,
+		nullTime(b.Time),
+		nullString(b.ProposerAddress),
+		b.NumTxs,
+		nullBytes(b.Results),
+	}
+}
+
+func transactionValues(tx *flatten.Transaction) []any {
+	return []any{
+		tx.Hash,
+		int64(tx.Height),
+		nullTime(tx.Timestamp),
+		int64(tx.Code),
+		nullString(tx.Codespace),
+		tx.GasWanted,
+		tx.GasUsed,
+		nullString(tx.Memo),
+		nullString(tx.Fee),
+		nullString(tx.Error),
+	}
+}
+
+func messageValues(msg flatten.Message) []any {
+	var signers any
+	if msg.Signers != nil {
+		// Marshaling strings cannot fail
+		signers, _ = json.Marshal(msg.Signers)
+	}
+	return []any{
+		msg.TxHash,
+		int64(msg.Height),
+		msg.MessageIndex,
+		msg.Type,
+		msg.Data,
+		nullString(msg.Sender),
+		signers,
+	}
+}
+
+func eventValues(event flatten.Event) []any {
+	var msgIndex any
+	if event.MsgIndex >= 0 {
+		msgIndex = event.MsgIndex
+	}
+	return []any{
+		event.TxHash,
+		int64(event.Height),
+		event.EventIndex,
+		event.AttrIndex,
+		event.EventType,
+		event.AttrKey,
+		event.AttrValue,
+		msgIndex,
+	}
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullBytes(b []byte) any {
+	if b == nil {
+		return nil
+	}
+	return b
+}
+
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
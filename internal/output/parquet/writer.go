@@ -0,0 +1,220 @@
+package parquet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+	CompressionGzip   = "gzip"
+	CompressionZstd   = "zstd"
+)
+
+const createdBy = "yaci"
+
+// Kind is the type of a column.
+type Kind int
+
+const (
+	// KindInt64 is a signed 64-bit integer. Values are int64 or int.
+	KindInt64 Kind = iota
+	// KindString is a UTF-8 string. Values are string or []byte.
+	KindString
+	// KindJSON is a JSON document stored as a UTF-8 string. Values are string or []byte.
+	KindJSON
+	// KindTimestamp is a UTC timestamp with a microsecond precision. Values are time.Time or int64 microseconds.
+	KindTimestamp
+)
+
+// Column describes a column of a Parquet file.
+type Column struct {
+	Name string
+	Kind Kind
+	// Optional columns accept nil values.
+	Optional bool
+}
+
+func (c Column) node() parquet.Node {
+	var node parquet.Node
+	switch c.Kind {
+	case KindString:
+		node = parquet.String()
+	case KindJSON:
+		node = parquet.JSON()
+	case KindTimestamp:
+		node = parquet.Timestamp(parquet.Microsecond)
+	default:
+		node = parquet.Int(64)
+	}
+	if c.Optional {
+		node = parquet.Optional(node)
+	}
+	return node
+}
+
+// columnField is a column of a schema.
+type columnField struct {
+	parquet.Node
+	name string
+}
+
+func (f columnField) Name() string { return f.name }
+
+// Value is only used to write Go values, the writer writes rows.
+func (f columnField) Value(base reflect.Value) reflect.Value { return base }
+
+// orderedGroup is a group keeping its fields in the order of the columns, as parquet.Group sorts them by name.
+type orderedGroup struct {
+	parquet.Group
+	fields []parquet.Field
+}
+
+func (g orderedGroup) Fields() []parquet.Field { return g.fields }
+
+// newSchema returns the schema of a file with the given columns, in the same order.
+func newSchema(name string, columns []Column) *parquet.Schema {
+	group := orderedGroup{Group: parquet.Group{}}
+	for _, column := range columns {
+		group.fields = append(group.fields, columnField{Node: column.node(), name: column.Name})
+	}
+	return parquet.NewSchema(name, group)
+}
+
+// compressionCodec returns the codec of the compression.
+func compressionCodec(compression string) (compress.Codec, error) {
+	switch compression {
+	case CompressionNone:
+		return &parquet.Uncompressed, nil
+	case CompressionSnappy:
+		return &parquet.Snappy, nil
+	case CompressionGzip:
+		return &parquet.Gzip, nil
+	case CompressionZstd:
+		return &parquet.Zstd, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+// Writer writes rows to a Parquet file.
+// Rows are buffered in memory until Flush is called, which writes them as a row group.
+type Writer struct {
+	w       *parquet.Writer
+	columns []Column
+	row     parquet.Row
+}
+
+// NewWriter creates a Parquet writer with the given columns and compression.
+func NewWriter(w io.Writer, columns []Column, compression string) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("at least one column is required")
+	}
+
+	codec, err := compressionCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		w: parquet.NewWriter(w,
+			newSchema("schema", columns),
+			parquet.Compression(codec),
+			parquet.CreatedBy(createdBy, "", ""),
+		),
+		columns: columns,
+	}, nil
+}
+
+// Write appends a row. There must be one value per column, in the order of the columns.
+func (w *Writer) Write(values ...any) error {
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("expected %d values, got %d", len(w.columns), len(values))
+	}
+
+	// Convert all the values first so that a row is never partially written
+	w.row = w.row[:0]
+	for i, value := range values {
+		v, err := columnValue(w.columns[i], value)
+		if err != nil {
+			return fmt.Errorf("invalid value for column %s: %w", w.columns[i].Name, err)
+		}
+		w.row = append(w.row, v.Level(0, definitionLevel(w.columns[i], value), i))
+	}
+
+	if _, err := w.w.WriteRows([]parquet.Row{w.row}); err != nil {
+		return fmt.Errorf("failed to write parquet row: %w", err)
+	}
+	return nil
+}
+
+// WriteRows appends rows read from a file with the same columns, e.g., to compact several files.
+func (w *Writer) WriteRows(rows []parquet.Row) error {
+	if _, err := w.w.WriteRows(rows); err != nil {
+		return fmt.Errorf("failed to write parquet rows: %w", err)
+	}
+	return nil
+}
+
+// Flush writes the buffered rows as a row group.
+func (w *Writer) Flush() error {
+	if err := w.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write parquet row group: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the buffered rows and writes the file footer. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.w.Close(); err != nil {
+		return fmt.Errorf("failed to write parquet footer: %w", err)
+	}
+	return nil
+}
+
+// definitionLevel returns the definition level of a value: 1 for the non-null values of the optional columns.
+func definitionLevel(column Column, value any) int {
+	if column.Optional && value != nil {
+		return 1
+	}
+	return 0
+}
+
+// columnValue converts a value to the physical type of the column.
+func columnValue(column Column, value any) (parquet.Value, error) {
+	switch typed := value.(type) {
+	case nil:
+		if !column.Optional {
+			return parquet.Value{}, errors.New("null value in a required column")
+		}
+		return parquet.NullValue(), nil
+	case string:
+		if column.Kind == KindString || column.Kind == KindJSON {
+			return parquet.ByteArrayValue([]byte(typed)), nil
+		}
+	case []byte:
+		if column.Kind == KindString || column.Kind == KindJSON {
+			return parquet.ByteArrayValue(typed), nil
+		}
+	case int64:
+		if column.Kind == KindInt64 || column.Kind == KindTimestamp {
+			return parquet.Int64Value(typed), nil
+		}
+	case int:
+		if column.Kind == KindInt64 || column.Kind == KindTimestamp {
+			return parquet.Int64Value(int64(typed)), nil
+		}
+	case time.Time:
+		if column.Kind == KindTimestamp {
+			return parquet.Int64Value(typed.UnixMicro()), nil
+		}
+	}
+	return parquet.Value{}, fmt.Errorf("unexpected type %T", value)
+}
@@ -0,0 +1,164 @@
+package parquet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testColumns = []Column{
+	{Name: "height", Kind: KindInt64},
+	{Name: "hash", Kind: KindString},
+	{Name: "time", Kind: KindTimestamp, Optional: true},
+	{Name: "data", Kind: KindJSON, Optional: true},
+}
+
+// readFile is a Parquet file read back with the parquet-go reader.
+type readFile struct {
+	file *parquet.File
+	// rows holds the values of every column: int64 for the integers, string for the byte arrays, nil for the nulls
+	rows [][]any
+}
+
+func readParquet(t *testing.T, path string) readFile {
+	t.Helper()
+
+	osFile, err := os.Open(path)
+	require.NoError(t, err)
+	defer osFile.Close()
+	info, err := osFile.Stat()
+	require.NoError(t, err)
+
+	file, err := parquet.OpenFile(osFile, info.Size())
+	require.NoError(t, err)
+
+	result := readFile{file: file, rows: make([][]any, len(file.Schema().Fields()))}
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	rows := make([]parquet.Row, 16)
+	for {
+		n, err := reader.ReadRows(rows)
+		for _, row := range rows[:n] {
+			for _, value := range row {
+				var v any
+				switch {
+				case value.IsNull():
+				case value.Kind() == parquet.Int64:
+					v = value.Int64()
+				default:
+					v = string(value.ByteArray())
+				}
+				result.rows[value.Column()] = append(result.rows[value.Column()], v)
+			}
+		}
+		if n == 0 || err != nil {
+			break
+		}
+	}
+
+	return result
+}
+
+func writeTestFile(t *testing.T, compression string, rows [][]any, rowGroupSize int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.parquet")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	w, err := NewWriter(file, testColumns, compression)
+	require.NoError(t, err)
+	for i, row := range rows {
+		require.NoError(t, w.Write(row...))
+		if rowGroupSize > 0 && (i+1)%rowGroupSize == 0 {
+			require.NoError(t, w.Flush())
+		}
+	}
+	require.NoError(t, w.Close())
+
+	return path
+}
+
+func TestWriter(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC)
+	rows := [][]any{
+		{int64(1), "AA", ts, `{"a": 1}`},
+		{2, []byte("BB"), nil, nil},
+		{int64(-3), "", ts.UnixMicro(), []byte(`{}`)},
+	}
+
+	for _, compression := range []string{CompressionNone, CompressionSnappy, CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			file := readParquet(t, writeTestFile(t, compression, rows, 2))
+
+			assert.Equal(t, int64(3), file.file.NumRows())
+			assert.Equal(t, strings.Join([]string{
+				"message schema {",
+				"\trequired int64 height (INT(64,true));",
+				"\trequired binary hash (STRING);",
+				"\toptional int64 time (TIMESTAMP(isAdjustedToUTC=true,unit=MICROS));",
+				"\toptional binary data (JSON);",
+				"}",
+			}, "\n"), file.file.Schema().String())
+			assert.Equal(t, [][]any{
+				{int64(1), int64(2), int64(-3)},
+				{"AA", "BB", ""},
+				{ts.UnixMicro(), nil, ts.UnixMicro()},
+				{`{"a": 1}`, nil, `{}`},
+			}, file.rows)
+
+			metadata := file.file.Metadata()
+			assert.Equal(t, createdBy, strings.Fields(metadata.CreatedBy)[0])
+			require.Len(t, metadata.RowGroups, 2)
+			assert.Equal(t, int64(2), metadata.RowGroups[0].NumRows)
+			assert.Equal(t, int64(1), metadata.RowGroups[1].NumRows)
+
+			// Statistics of the height column of the first row group
+			stats := metadata.RowGroups[0].Columns[0].MetaData.Statistics
+			assert.Equal(t, []byte{2, 0, 0, 0, 0, 0, 0, 0}, stats.MaxValue)
+			assert.Equal(t, []byte{1, 0, 0, 0, 0, 0, 0, 0}, stats.MinValue)
+			assert.Equal(t, int64(0), stats.NullCount)
+		})
+	}
+}
+
+func TestWriterMultiplePages(t *testing.T) {
+	large := strings.Repeat("x", 1<<18)
+	var rows [][]any
+	for i := range 10 {
+		rows = append(rows, []any{i, large, nil, nil})
+	}
+
+	file := readParquet(t, writeTestFile(t, CompressionSnappy, rows, 0))
+	assert.Equal(t, int64(10), file.file.NumRows())
+	require.Len(t, file.rows[1], 10)
+	assert.Equal(t, large, file.rows[1][9])
+	assert.Equal(t, int64(9), file.rows[0][9])
+}
+
+func TestWriterEmpty(t *testing.T) {
+	file := readParquet(t, writeTestFile(t, CompressionNone, nil, 0))
+	assert.Equal(t, int64(0), file.file.NumRows())
+	assert.Empty(t, file.file.Metadata().RowGroups)
+}
+
+func TestWriterInvalidValues(t *testing.T) {
+	w, err := NewWriter(&strings.Builder{}, testColumns, CompressionNone)
+	require.NoError(t, err)
+
+	assert.ErrorContains(t, w.Write(int64(1), "AA"), "expected 4 values")
+	assert.ErrorContains(t, w.Write(nil, "AA", nil, nil), "null value in a required column")
+	assert.ErrorContains(t, w.Write("1", "AA", nil, nil), "unexpected type string")
+	assert.ErrorContains(t, w.Write(int64(1), "AA", "now", nil), "unexpected type string")
+
+	_, err = NewWriter(&strings.Builder{}, testColumns, "lz4")
+	assert.ErrorContains(t, err, "unsupported compression")
+}
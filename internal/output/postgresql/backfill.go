@@ -0,0 +1,52 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// backfillBatchSize is the number of blocks whose hashes are backfilled per transaction.
+const backfillBatchSize = 1000
+
+// The block JSON holds the base64-encoded hashes, the columns hold the uppercase hex-encoded hashes.
+const (
+	blockHashExpr     = `NULLIF(upper(encode(decode(data->'blockId'->>'hash', 'base64'), 'hex')), '')`
+	lastBlockHashExpr = `NULLIF(upper(encode(decode(data->'block'->'header'->'lastBlockId'->>'hash', 'base64'), 'hex')), '')`
+)
+
+// backfillBlockHashes sets the hash columns of the blocks written before they existed, in batches of the given
+// size, each in its own transaction. It resumes from the first block without hash when interrupted.
+// It returns the number of blocks backfilled.
+func backfillBlockHashes(ctx context.Context, db *sql.DB, batchSize int) (int64, error) {
+	query := fmt.Sprintf(`
+		WITH batch AS (
+			SELECT id FROM api.blocks_raw
+			WHERE id > $1 AND hash IS NULL
+			ORDER BY id
+			LIMIT $2
+		), updated AS (
+			UPDATE api.blocks_raw SET hash = %s, last_block_hash = %s
+			FROM batch
+			WHERE api.blocks_raw.id = batch.id
+			RETURNING api.blocks_raw.id
+		)
+		SELECT COUNT(*), COALESCE(MAX(id), 0) FROM updated
+	`, blockHashExpr, lastBlockHashExpr)
+
+	var total int64
+	var cursor uint64
+	for {
+		var count int64
+		// Blocks without hash in their JSON keep a null hash, the cursor skips them
+		if err := db.QueryRowContext(ctx, query, cursor, batchSize).Scan(&count, &cursor); err != nil {
+			return total, fmt.Errorf("failed to backfill the block hashes: %w", err)
+		}
+		if count == 0 {
+			return total, nil
+		}
+		total += count
+		slog.Debug("Backfilled block hashes", "count", total, "height", cursor)
+	}
+}
@@ -0,0 +1,29 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfillBlockHashes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Every batch resumes after the last block of the previous one
+	mock.ExpectQuery("UPDATE api.blocks_raw").WithArgs(uint64(0), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(2, 5))
+	mock.ExpectQuery("UPDATE api.blocks_raw").WithArgs(uint64(5), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(1, 9))
+	mock.ExpectQuery("UPDATE api.blocks_raw").WithArgs(uint64(9), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(0, 0))
+
+	count, err := backfillBlockHashes(context.Background(), db, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
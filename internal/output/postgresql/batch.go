@@ -0,0 +1,184 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/manifest-network/yaci/internal/models"
+)
+
+// pendingBlock is a block waiting to be written by the next batch.
+type pendingBlock struct {
+	block        *models.Block
+	transactions []*models.Transaction
+}
+
+// stagingTable is a temporary table the rows of a batch are copied to, before being upserted into the target table.
+// The first column is the primary key of the target table.
+type stagingTable struct {
+	name    string
+	target  string
+	columns []string
+	// create is the column definitions of the staging table
+	create string
+}
+
+var (
+	blocksStaging = stagingTable{
+		name:    "blocks_staging",
+		target:  "api.blocks_raw",
+		columns: []string{"id", "data", "hash", "last_block_hash"},
+		create:  "id BIGINT NOT NULL, data JSONB NOT NULL, hash TEXT, last_block_hash TEXT",
+	}
+	blockResultsStaging = stagingTable{
+		name:    "block_results_staging",
+		target:  "api.block_results_raw",
+		columns: []string{"id", "data"},
+		create:  "id BIGINT NOT NULL, data JSONB NOT NULL",
+	}
+	transactionsStaging = stagingTable{
+		name:    "transactions_staging",
+		target:  "api.transactions_raw",
+		columns: []string{"id", "data", "signers"},
+		create:  "id TEXT NOT NULL, data JSONB NOT NULL, signers JSONB",
+	}
+)
+
+// batchRows returns the rows of the pending blocks, block results and transactions.
+// A block or transaction written several times is only kept once, with its last data,
+// as an upsert cannot update the same row twice.
+func batchRows(pending []pendingBlock) (blocks, results, transactions [][]any) {
+	blockIndex := make(map[uint64]int)
+	resultIndex := make(map[uint64]int)
+	txIndex := make(map[string]int)
+
+	for _, p := range pending {
+		blocks = upsertRow(blocks, blockIndex, p.block.ID, []any{p.block.ID, p.block.Data, nullString(p.block.Hash), nullString(p.block.LastBlockHash)})
+		if p.block.Results != nil {
+			results = upsertRow(results, resultIndex, p.block.ID, []any{p.block.ID, p.block.Results})
+		}
+		for _, tx := range p.transactions {
+			transactions = upsertRow(transactions, txIndex, tx.Hash, []any{tx.Hash, tx.Data, nullSigners(tx.Signers)})
+		}
+	}
+
+	return blocks, results, transactions
+}
+
+func upsertRow[K comparable](rows [][]any, index map[K]int, key K, row []any) [][]any {
+	if i, ok := index[key]; ok {
+		rows[i] = row
+		return rows
+	}
+	index[key] = len(rows)
+	return append(rows, row)
+}
+
+// Flush writes the pending blocks to the database.
+func (h *PostgresOutputHandler) Flush(ctx context.Context) error {
+	if h.batchSize <= 1 {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flushLocked(ctx)
+}
+
+func (h *PostgresOutputHandler) flushLoop(interval time.Duration) {
+	defer close(h.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.mu.Lock()
+			if err := h.flushLocked(context.Background()); err != nil {
+				slog.Error("Failed to write blocks to PostgreSQL", "error", err)
+				h.flushErr = err
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// flushLocked writes the pending blocks in a single transaction. The caller must hold the lock.
+// The rows are copied into staging tables with COPY, then upserted into the raw tables with one statement per table,
+// so that the triggers populate the parsed tables as with the per-block writes.
+func (h *PostgresOutputHandler) flushLocked(ctx context.Context) error {
+	if len(h.pending) == 0 {
+		return nil
+	}
+
+	blocks, results, transactions := batchRows(h.pending)
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // Ensure rollback if commit is not reached
+
+	for _, batch := range []struct {
+		table stagingTable
+		rows  [][]any
+	}{
+		{blocksStaging, blocks},
+		{blockResultsStaging, results},
+		{transactionsStaging, transactions},
+	} {
+		if len(batch.rows) == 0 {
+			continue
+		}
+		if err := copyAndUpsert(ctx, tx, batch.table, batch.rows); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	slog.Debug("Wrote blocks to PostgreSQL", "count", len(h.pending), "transactions", len(transactions))
+	h.pending = nil
+	h.flushErr = nil
+
+	return nil
+}
+
+// copyAndUpsert copies the rows into the staging table, then upserts them into the target table.
+func copyAndUpsert(ctx context.Context, tx pgx.Tx, table stagingTable, rows [][]any) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TEMP TABLE %s (%s) ON COMMIT DROP`, table.name, table.create))
+	if err != nil {
+		return fmt.Errorf("failed to create staging table %s: %w", table.name, err)
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{table.name}, table.columns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("failed to copy rows to %s: %w", table.name, err)
+	}
+
+	updates := make([]string, 0, len(table.columns)-1)
+	for _, column := range table.columns[1:] {
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+	}
+	columns := strings.Join(table.columns, ", ")
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (%s) SELECT %s FROM %s
+		ON CONFLICT (%s) DO UPDATE SET %s
+	`, table.target, columns, columns, table.name, table.columns[0], strings.Join(updates, ", ")))
+	if err != nil {
+		return fmt.Errorf("failed to upsert rows into %s: %w", table.target, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/manifest-network/yaci/internal/models"
+)
+
+func TestBatchRows(t *testing.T) {
+	pending := []pendingBlock{
+		{
+			block:        &models.Block{ID: 1, Data: []byte(`{"v":1}`), Results: []byte(`{}`)},
+			transactions: []*models.Transaction{{Hash: "A", Data: []byte(`{"v":1}`)}, {Hash: "B", Data: []byte(`{}`)}},
+		},
+		{
+			block: &models.Block{ID: 2, Data: []byte(`{}`)},
+		},
+		// Block 1 is written again, e.g., when re-extracting a missing block
+		{
+			block:        &models.Block{ID: 1, Data: []byte(`{"v":2}`), Hash: "AB", Results: []byte(`{}`)},
+			transactions: []*models.Transaction{{Hash: "A", Data: []byte(`{"v":2}`), Signers: [][]string{{"manifest1a"}, nil}}},
+		},
+	}
+
+	blocks, results, transactions := batchRows(pending)
+
+	assert.Equal(t, [][]any{{uint64(1), []byte(`{"v":2}`), "AB", nil}, {uint64(2), []byte(`{}`), nil, nil}}, blocks)
+	assert.Equal(t, [][]any{{uint64(1), []byte(`{}`)}}, results)
+	assert.Equal(t, [][]any{{"A", []byte(`{"v":2}`), []byte(`[["manifest1a"],null]`)}, {"B", []byte(`{}`), nil}}, transactions)
+}
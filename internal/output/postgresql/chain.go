@@ -0,0 +1,228 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/manifest-network/yaci/internal/config"
+	"github.com/manifest-network/yaci/internal/output"
+)
+
+// ChainIdentity identifies the chain the database was built from.
+type ChainIdentity struct {
+	ChainID string
+	// InitialHeight is the height of a block of the chain, the earliest block of the database when recorded,
+	// and InitialBlockHash its uppercase hex-encoded hash.
+	InitialHeight    uint64
+	InitialBlockHash string
+}
+
+// ChainResetError reports that the node serves a different chain than the one the database was built from,
+// e.g., after a devnet genesis reset.
+type ChainResetError struct {
+	Reason string
+}
+
+func (e *ChainResetError) Error() string {
+	return fmt.Sprintf("chain reset detected: %s; restart with --on-chain-reset=wipe to clear the database, or --on-chain-reset=new-schema to keep its data in a separate schema", e.Reason)
+}
+
+// CheckChainReset compares the chain the database was built from with the chain served by the node,
+// and handles a chain reset according to the given policy. The identity of the chain is recorded on first run.
+func (h *PostgresOutputHandler) CheckChainReset(ctx context.Context, node output.ChainNode, policy string) error {
+	stored, err := h.chainIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	latestHeight, err := node.LatestHeight()
+	if err != nil {
+		return fmt.Errorf("failed to get the latest block height: %w", err)
+	}
+	chainID, _, err := node.BlockIdentity(latestHeight)
+	if err != nil {
+		return fmt.Errorf("failed to get the chain-id: %w", err)
+	}
+
+	if stored == nil {
+		return h.recordChainIdentity(ctx, node, chainID)
+	}
+
+	reason, err := chainResetReason(*stored, node, chainID, latestHeight)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		slog.Debug("Chain identity verified", "chain_id", chainID, "initial_height", stored.InitialHeight)
+		return nil
+	}
+
+	attrs := []any{"reason", reason, "chain_id", stored.ChainID, "initial_height", stored.InitialHeight, "action", policy}
+	switch policy {
+	case config.OnChainResetWipe:
+		slog.Warn("Chain reset detected, clearing the database", attrs...)
+		if err := h.wipe(ctx); err != nil {
+			return err
+		}
+	case config.OnChainResetNewSchema:
+		name := archiveSchemaName(stored.ChainID, time.Now())
+		slog.Warn("Chain reset detected, moving the data to a separate schema", append(attrs, "schema", name)...)
+		if err := h.archiveSchema(ctx, name); err != nil {
+			return err
+		}
+	default:
+		slog.Error("Chain reset detected, halting", attrs...)
+		return &ChainResetError{Reason: reason}
+	}
+
+	return h.recordChainIdentity(ctx, node, chainID)
+}
+
+// chainResetReason returns why the chain served by the node differs from the stored chain, or an empty string.
+// The hash of the initial block is only verified when the node still serves it, as pruned nodes drop old blocks.
+func chainResetReason(stored ChainIdentity, node output.ChainNode, chainID string, latestHeight uint64) (string, error) {
+	if chainID != stored.ChainID {
+		return fmt.Sprintf("the chain-id changed from %s to %s", stored.ChainID, chainID), nil
+	}
+
+	if latestHeight < stored.InitialHeight {
+		return fmt.Sprintf("the latest block height of the node %d is below the initial height %d", latestHeight, stored.InitialHeight), nil
+	}
+
+	earliestHeight, err := node.EarliestHeight()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the earliest block height: %w", err)
+	}
+	if earliestHeight > stored.InitialHeight {
+		slog.Debug("The initial block is pruned from the node, skipping the verification of its hash",
+			"initial_height", stored.InitialHeight, "earliest_height", earliestHeight)
+		return "", nil
+	}
+
+	_, hash, err := node.BlockIdentity(stored.InitialHeight)
+	if err != nil {
+		return "", fmt.Errorf("failed to get block %d: %w", stored.InitialHeight, err)
+	}
+	if hash != stored.InitialBlockHash {
+		return fmt.Sprintf("block %d has hash %s, but the database was built from a block with hash %s", stored.InitialHeight, hash, stored.InitialBlockHash), nil
+	}
+
+	return "", nil
+}
+
+// chainIdentity returns the stored identity of the chain, or nil if none is recorded yet.
+func (h *PostgresOutputHandler) chainIdentity(ctx context.Context) (*ChainIdentity, error) {
+	var identity ChainIdentity
+	err := h.pool.QueryRow(ctx, `
+		SELECT chain_id, initial_height, initial_block_hash
+		FROM api.chain_metadata
+	`).Scan(&identity.ChainID, &identity.InitialHeight, &identity.InitialBlockHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get the chain metadata: %w", err)
+	}
+	return &identity, nil
+}
+
+// recordChainIdentity records the identity of the chain. The initial block is the earliest block of the database,
+// or the earliest block available on the node when the database is empty.
+func (h *PostgresOutputHandler) recordChainIdentity(ctx context.Context, node output.ChainNode, chainID string) error {
+	identity := ChainIdentity{ChainID: chainID}
+
+	earliest, err := h.GetEarliestBlock(ctx)
+	if err != nil {
+		return err
+	}
+	if earliest != nil && earliest.Hash != "" {
+		identity.InitialHeight = earliest.ID
+		identity.InitialBlockHash = earliest.Hash
+	} else {
+		if earliest != nil {
+			identity.InitialHeight = earliest.ID
+		} else if identity.InitialHeight, err = node.EarliestHeight(); err != nil {
+			return fmt.Errorf("failed to get the earliest block height: %w", err)
+		}
+		if _, identity.InitialBlockHash, err = node.BlockIdentity(identity.InitialHeight); err != nil {
+			return fmt.Errorf("failed to get block %d: %w", identity.InitialHeight, err)
+		}
+	}
+
+	_, err = h.pool.Exec(ctx, `
+		INSERT INTO api.chain_metadata (chain_id, initial_height, initial_block_hash) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET
+			chain_id = EXCLUDED.chain_id,
+			initial_height = EXCLUDED.initial_height,
+			initial_block_hash = EXCLUDED.initial_block_hash,
+			created_at = now();
+	`, identity.ChainID, identity.InitialHeight, identity.InitialBlockHash)
+	if err != nil {
+		return fmt.Errorf("failed to record the chain metadata: %w", err)
+	}
+
+	slog.Info("Chain identity recorded", "chain_id", identity.ChainID, "initial_height", identity.InitialHeight, "initial_block_hash", identity.InitialBlockHash)
+	return nil
+}
+
+// wipe truncates all the tables of the api schema, including the tables created outside of yaci,
+// e.g., by the explorer migrations.
+func (h *PostgresOutputHandler) wipe(ctx context.Context) error {
+	rows, err := h.pool.Query(ctx, `SELECT format('%I.%I', schemaname, tablename) FROM pg_tables WHERE schemaname = 'api' ORDER BY tablename`)
+	if err != nil {
+		return fmt.Errorf("failed to list the tables: %w", err)
+	}
+	tables, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("failed to list the tables: %w", err)
+	}
+
+	if _, err := h.pool.Exec(ctx, "TRUNCATE "+strings.Join(tables, ", ")+" CASCADE"); err != nil {
+		return fmt.Errorf("failed to truncate the tables: %w", err)
+	}
+
+	return nil
+}
+
+// archiveSchema renames the api schema, then applies the migrations again to create a fresh api schema,
+// so that the data of the previous chain stays available under the new name.
+func (h *PostgresOutputHandler) archiveSchema(ctx context.Context, name string) error {
+	if _, err := h.pool.Exec(ctx, "ALTER SCHEMA api RENAME TO "+pgx.Identifier{name}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to rename the api schema to %s: %w", name, err)
+	}
+
+	migrator, err := newMigrator(h.pool)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	// The migrations table is outside of the api schema, and still records the migrations of the renamed schema
+	if err := migrator.Force(-1); err != nil {
+		return err
+	}
+	if err := migrator.Up(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var schemaNameInvalidChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// archiveSchemaName returns the name of the schema holding the data of a previous chain.
+// PostgreSQL identifiers are limited to 63 bytes, so long chain-ids are truncated.
+func archiveSchemaName(chainID string, now time.Time) string {
+	sanitized := strings.Trim(schemaNameInvalidChars.ReplaceAllString(strings.ToLower(chainID), "_"), "_")
+	if len(sanitized) > 40 {
+		sanitized = sanitized[:40]
+	}
+	return fmt.Sprintf("api_%s_%s", sanitized, now.UTC().Format("20060102150405"))
+}
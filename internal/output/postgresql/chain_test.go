@@ -0,0 +1,78 @@
+package postgresql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChainNode serves a chain whose blocks all have the same chain-id.
+type fakeChainNode struct {
+	chainID  string
+	earliest uint64
+	latest   uint64
+	hashes   map[uint64]string
+}
+
+func (n fakeChainNode) LatestHeight() (uint64, error) {
+	return n.latest, nil
+}
+
+func (n fakeChainNode) EarliestHeight() (uint64, error) {
+	return n.earliest, nil
+}
+
+func (n fakeChainNode) BlockIdentity(height uint64) (string, string, error) {
+	return n.chainID, n.hashes[height], nil
+}
+
+func TestChainResetReason(t *testing.T) {
+	stored := ChainIdentity{ChainID: "devnet-1", InitialHeight: 1, InitialBlockHash: "AA"}
+
+	tests := []struct {
+		name   string
+		node   fakeChainNode
+		reason string
+	}{
+		{
+			name: "same chain",
+			node: fakeChainNode{chainID: "devnet-1", earliest: 1, latest: 100, hashes: map[uint64]string{1: "AA"}},
+		},
+		{
+			name: "initial block pruned",
+			node: fakeChainNode{chainID: "devnet-1", earliest: 50, latest: 100},
+		},
+		{
+			name:   "chain-id changed",
+			node:   fakeChainNode{chainID: "devnet-2", earliest: 1, latest: 100, hashes: map[uint64]string{1: "AA"}},
+			reason: "the chain-id changed from devnet-1 to devnet-2",
+		},
+		{
+			name:   "genesis reset with the same chain-id",
+			node:   fakeChainNode{chainID: "devnet-1", earliest: 1, latest: 100, hashes: map[uint64]string{1: "BB"}},
+			reason: "block 1 has hash BB, but the database was built from a block with hash AA",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := chainResetReason(stored, tt.node, tt.node.chainID, tt.node.latest)
+			require.NoError(t, err)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+
+	stored.InitialHeight = 500
+	reason, err := chainResetReason(stored, fakeChainNode{chainID: "devnet-1", latest: 100}, "devnet-1", 100)
+	require.NoError(t, err)
+	assert.Equal(t, "the latest block height of the node 100 is below the initial height 500", reason)
+}
+
+func TestArchiveSchemaName(t *testing.T) {
+	now := time.Date(2024, 5, 17, 12, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, "api_manifest_devnet_1_20240517123000", archiveSchemaName("Manifest-Devnet-1", now))
+	assert.Len(t, archiveSchemaName("a-very-long-chain-identifier-exceeding-the-identifier-limit", now), 59)
+}
@@ -0,0 +1,188 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratepgx "github.com/golang-migrate/migrate/v4/database/pgx"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// MigrationStatus is the state of the migrations of a database.
+type MigrationStatus struct {
+	// Version is the version of the last applied migration, 0 if none.
+	Version uint
+	// Dirty is true if the last migration failed, and the database must be fixed manually then forced to a version.
+	Dirty bool
+	// Available lists the versions of the embedded migrations, in order.
+	Available []uint
+}
+
+// Pending returns the versions of the embedded migrations that are not applied yet.
+func (s MigrationStatus) Pending() []uint {
+	var pending []uint
+	for _, version := range s.Available {
+		if version > s.Version {
+			pending = append(pending, version)
+		}
+	}
+	return pending
+}
+
+// Latest returns the version of the last embedded migration, 0 if none.
+func (s MigrationStatus) Latest() uint {
+	if len(s.Available) == 0 {
+		return 0
+	}
+	return s.Available[len(s.Available)-1]
+}
+
+// Check returns an error if the migrations cannot be applied: the last migration failed, or the database was
+// migrated by a newer version of yaci.
+func (s MigrationStatus) Check() error {
+	if s.Dirty {
+		return fmt.Errorf("migration %d failed, fix it then run `yaci migrate force %d`", s.Version, s.Version)
+	}
+	if s.Version > s.Latest() {
+		return fmt.Errorf("the database schema version %d is newer than the latest migration %d, upgrade yaci", s.Version, s.Latest())
+	}
+	return nil
+}
+
+// Migrator applies the embedded schema migrations to a PostgreSQL database.
+type Migrator struct {
+	source source.Driver
+	m      *migrate.Migrate
+	// pool is only set when the migrator owns the connection pool
+	pool *pgxpool.Pool
+}
+
+// NewMigrator connects to the PostgreSQL database and prepares the embedded migrations.
+func NewMigrator(connString string) (*Migrator, error) {
+	pool, err := pgxpool.New(context.Background(), connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+
+	migrator, err := newMigrator(pool)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	migrator.pool = pool
+
+	return migrator, nil
+}
+
+func newMigrator(pool *pgxpool.Pool) (*Migrator, error) {
+	d, err := iofs.New(migrationsFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration source: %w", err)
+	}
+
+	driver, err := migratepgx.WithInstance(stdlib.OpenDBFromPool(pool), &migratepgx.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", d, "postgres", driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration instance: %w", err)
+	}
+
+	return &Migrator{source: d, m: m}, nil
+}
+
+// Up applies all the pending migrations. It fails without applying any migration if the status of the migrations
+// does not pass Check.
+func (m *Migrator) Up() error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	if err := status.Check(); err != nil {
+		return err
+	}
+
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	return nil
+}
+
+// Down rolls back the given number of migrations.
+func (m *Migrator) Down(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("the number of migrations to roll back must be greater than 0")
+	}
+	if err := m.m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to roll back migrations: %w", err)
+	}
+	return nil
+}
+
+// Force sets the migration version without running any migration, and clears the dirty state.
+// A version of -1 marks the database as having no migration applied.
+func (m *Migrator) Force(version int) error {
+	if err := m.m.Force(version); err != nil {
+		return fmt.Errorf("failed to force migration version %d: %w", version, err)
+	}
+	return nil
+}
+
+// Status returns the state of the migrations of the database.
+func (m *Migrator) Status() (MigrationStatus, error) {
+	var status MigrationStatus
+
+	version, dirty, err := m.m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return status, fmt.Errorf("failed to get migration version: %w", err)
+	}
+	status.Version = version
+	status.Dirty = dirty
+
+	status.Available, err = availableMigrations(m.source)
+	if err != nil {
+		return status, err
+	}
+
+	return status, nil
+}
+
+// Close releases the migration resources, and closes the connection pool if the migrator owns it.
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	if m.pool != nil {
+		m.pool.Close()
+	}
+	return errors.Join(srcErr, dbErr)
+}
+
+// availableMigrations returns the versions of the migrations of the source, in order.
+func availableMigrations(d source.Driver) ([]uint, error) {
+	version, err := d.First()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	versions := []uint{version}
+	for {
+		version, err = d.Next(version)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return versions, nil
+			}
+			return nil, fmt.Errorf("failed to list migrations: %w", err)
+		}
+		versions = append(versions, version)
+	}
+}
@@ -0,0 +1,65 @@
+package postgresql
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsArePaired(t *testing.T) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	require.NoError(t, err)
+
+	pattern := regexp.MustCompile(`^(\d+)_\w+\.(up|down)\.sql$`)
+	directions := make(map[string][]string)
+	for _, entry := range entries {
+		match := pattern.FindStringSubmatch(entry.Name())
+		require.NotNil(t, match, "invalid migration file name %s", entry.Name())
+		directions[match[1]] = append(directions[match[1]], match[2])
+	}
+
+	for version, dirs := range directions {
+		assert.ElementsMatch(t, []string{"up", "down"}, dirs, "migration %s", version)
+	}
+}
+
+func TestAvailableMigrations(t *testing.T) {
+	d, err := iofs.New(migrationsFS, "migrations")
+	require.NoError(t, err)
+
+	versions, err := availableMigrations(d)
+	require.NoError(t, err)
+	require.NotEmpty(t, versions)
+
+	// The versions are contiguous from 1, and each one has an up and a down migration
+	for i, version := range versions {
+		assert.Equal(t, uint(i+1), version)
+		for _, direction := range []string{"up", "down"} {
+			matches, err := fs.Glob(migrationsFS, fmt.Sprintf("migrations/%03d_*.%s.sql", version, direction))
+			require.NoError(t, err)
+			assert.Len(t, matches, 1, "migration %d %s", version, direction)
+		}
+	}
+
+	status := MigrationStatus{Version: 1, Available: versions}
+	assert.Equal(t, versions[1:], status.Pending())
+}
+
+func TestMigrationStatusCheck(t *testing.T) {
+	available := []uint{1, 2, 3}
+
+	assert.NoError(t, MigrationStatus{Available: available}.Check())
+	assert.NoError(t, MigrationStatus{Version: 2, Available: available}.Check())
+	assert.NoError(t, MigrationStatus{Version: 3, Available: available}.Check())
+
+	err := MigrationStatus{Version: 2, Dirty: true, Available: available}.Check()
+	assert.ErrorContains(t, err, "migration 2 failed, fix it then run `yaci migrate force 2`")
+
+	err = MigrationStatus{Version: 4, Available: available}.Check()
+	assert.ErrorContains(t, err, "the database schema version 4 is newer than the latest migration 3")
+}
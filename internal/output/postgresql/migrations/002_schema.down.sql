@@ -0,0 +1,3 @@
+-- The base schema may predate the migrations, e.g., when created by the yaci-explorer-apis migrations, and is shared
+-- with the explorer: rolling back keeps it and its data. Drop the api schema manually to remove it.
+SELECT 1;
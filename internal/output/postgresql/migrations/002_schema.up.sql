@@ -0,0 +1,348 @@
+-- Base schema. yaci writes the raw tables, and the triggers populate the parsed tables.
+-- The schema may already exist, e.g., when created by the yaci-explorer-apis migrations: the tables, columns and
+-- indexes are created if missing, and the functions and triggers are only created when no object of the same name
+-- exists, so that the existing ones are kept.
+CREATE SCHEMA IF NOT EXISTS api;
+
+-- Raw data
+
+CREATE TABLE IF NOT EXISTS api.blocks_raw (
+  id BIGINT PRIMARY KEY,
+  data JSONB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api.transactions_raw (
+  id TEXT PRIMARY KEY,
+  data JSONB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api.messages_raw (
+  id TEXT NOT NULL,
+  message_index BIGINT NOT NULL,
+  data JSONB NOT NULL,
+  PRIMARY KEY (id, message_index)
+);
+
+-- Parsed data
+
+CREATE TABLE IF NOT EXISTS api.transactions_main (
+  id TEXT PRIMARY KEY,
+  fee JSONB,
+  memo TEXT,
+  error TEXT,
+  height BIGINT,
+  timestamp TIMESTAMPTZ,
+  proposal_ids TEXT[]
+);
+
+ALTER TABLE api.transactions_main
+  ADD COLUMN IF NOT EXISTS fee JSONB,
+  ADD COLUMN IF NOT EXISTS memo TEXT,
+  ADD COLUMN IF NOT EXISTS error TEXT,
+  ADD COLUMN IF NOT EXISTS height BIGINT,
+  ADD COLUMN IF NOT EXISTS timestamp TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS proposal_ids TEXT[];
+
+CREATE INDEX IF NOT EXISTS transactions_main_height_idx ON api.transactions_main (height DESC);
+CREATE INDEX IF NOT EXISTS transactions_main_proposal_ids_idx ON api.transactions_main USING GIN (proposal_ids);
+
+-- Messages nested in a proposal (e.g., MsgSubmitProposal) have a message index of
+-- 10000 * (index of the proposal message + 1) + index in the proposal.
+CREATE TABLE IF NOT EXISTS api.messages_main (
+  id TEXT NOT NULL,
+  message_index BIGINT NOT NULL,
+  height BIGINT,
+  type TEXT,
+  sender TEXT,
+  mentions TEXT[],
+  metadata JSONB,
+  PRIMARY KEY (id, message_index)
+);
+
+ALTER TABLE api.messages_main
+  ADD COLUMN IF NOT EXISTS height BIGINT,
+  ADD COLUMN IF NOT EXISTS type TEXT,
+  ADD COLUMN IF NOT EXISTS sender TEXT,
+  ADD COLUMN IF NOT EXISTS mentions TEXT[],
+  ADD COLUMN IF NOT EXISTS metadata JSONB;
+
+CREATE INDEX IF NOT EXISTS messages_main_type_idx ON api.messages_main (type);
+CREATE INDEX IF NOT EXISTS messages_main_sender_idx ON api.messages_main (sender, height DESC);
+CREATE INDEX IF NOT EXISTS messages_main_mentions_idx ON api.messages_main USING GIN (mentions);
+
+-- One row per event attribute. msg_index is NULL when the event is not related to a message.
+CREATE TABLE IF NOT EXISTS api.events_main (
+  id TEXT NOT NULL,
+  event_index BIGINT NOT NULL,
+  attr_index BIGINT NOT NULL,
+  event_type TEXT NOT NULL,
+  attr_key TEXT,
+  attr_value TEXT,
+  msg_index BIGINT,
+  PRIMARY KEY (id, event_index, attr_index)
+);
+
+ALTER TABLE api.events_main
+  ADD COLUMN IF NOT EXISTS attr_key TEXT,
+  ADD COLUMN IF NOT EXISTS attr_value TEXT,
+  ADD COLUMN IF NOT EXISTS msg_index BIGINT;
+
+CREATE INDEX IF NOT EXISTS events_main_event_type_idx ON api.events_main (event_type);
+
+-- Parsing functions
+
+-- extract_proposal_ids returns the distinct proposal IDs of the transaction events.
+DO $$
+BEGIN
+  IF to_regprocedure('api.extract_proposal_ids(jsonb)') IS NULL THEN
+    CREATE FUNCTION api.extract_proposal_ids(events JSONB)
+    RETURNS TEXT[]
+    LANGUAGE SQL IMMUTABLE
+    AS $fn$
+      SELECT NULLIF(ARRAY(
+        SELECT DISTINCT btrim(attr->>'value', '"')
+        FROM jsonb_array_elements(COALESCE(events, '[]'::jsonb)) AS event
+        CROSS JOIN LATERAL jsonb_array_elements(COALESCE(event->'attributes', '[]'::jsonb)) AS attr
+        WHERE attr->>'key' = 'proposal_id'
+        ORDER BY 1
+      ), '{}');
+    $fn$;
+  END IF;
+END;
+$$;
+
+-- extract_addresses returns the distinct Bech32 addresses found in the values of a JSON document.
+DO $$
+BEGIN
+  IF to_regprocedure('api.extract_addresses(jsonb)') IS NULL THEN
+    CREATE FUNCTION api.extract_addresses(doc JSONB)
+    RETURNS TEXT[]
+    LANGUAGE SQL IMMUTABLE
+    AS $fn$
+      SELECT ARRAY(
+        SELECT DISTINCT m[1]
+        FROM regexp_matches(doc::text, '"([a-z][a-z0-9]*1[02-9ac-hj-np-z]{38,})"', 'g') AS m
+        ORDER BY 1
+      );
+    $fn$;
+  END IF;
+END;
+$$;
+
+-- extract_sender returns the address of the signer of a message, based on the common field names.
+DO $$
+BEGIN
+  IF to_regprocedure('api.extract_sender(jsonb)') IS NULL THEN
+    CREATE FUNCTION api.extract_sender(msg JSONB)
+    RETURNS TEXT
+    LANGUAGE SQL IMMUTABLE
+    AS $fn$
+      SELECT COALESCE(
+        msg->>'sender',
+        msg->>'fromAddress',
+        msg->>'signer',
+        msg->>'authority',
+        msg->>'admin',
+        msg->>'proposer',
+        msg->>'voter',
+        msg->>'executor',
+        msg->>'delegatorAddress',
+        msg->>'granter',
+        msg->>'grantee',
+        msg->>'creator',
+        msg->>'owner',
+        msg->'proposers'->>0,
+        msg->'signers'->>0
+      );
+    $fn$;
+  END IF;
+END;
+$$;
+
+-- Triggers
+
+DO $$
+BEGIN
+  IF to_regprocedure('api.update_transaction_main()') IS NULL THEN
+    CREATE FUNCTION api.update_transaction_main()
+    RETURNS TRIGGER
+    LANGUAGE plpgsql
+    AS $fn$
+    DECLARE
+      tx_error TEXT;
+    BEGIN
+      IF NEW.data ? 'error' THEN
+        tx_error := concat_ws(': ', NEW.data->>'error', NULLIF(NEW.data->>'reason', ''));
+      ELSIF COALESCE((NEW.data->'txResponse'->>'code')::BIGINT, 0) <> 0 THEN
+        tx_error := NEW.data->'txResponse'->>'rawLog';
+      END IF;
+
+      INSERT INTO api.transactions_main (id, fee, memo, error, height, timestamp, proposal_ids)
+      VALUES (
+        NEW.id,
+        NEW.data->'tx'->'authInfo'->'fee',
+        NEW.data->'tx'->'body'->>'memo',
+        tx_error,
+        (NEW.data->'txResponse'->>'height')::BIGINT,
+        (NEW.data->'txResponse'->>'timestamp')::TIMESTAMPTZ,
+        api.extract_proposal_ids(NEW.data->'txResponse'->'events')
+      )
+      ON CONFLICT (id) DO UPDATE SET
+        fee = EXCLUDED.fee,
+        memo = EXCLUDED.memo,
+        error = EXCLUDED.error,
+        height = EXCLUDED.height,
+        timestamp = EXCLUDED.timestamp,
+        proposal_ids = EXCLUDED.proposal_ids;
+
+      -- Messages, including the messages nested in proposals
+      DELETE FROM api.messages_raw WHERE id = NEW.id;
+      DELETE FROM api.messages_main WHERE id = NEW.id;
+
+      INSERT INTO api.messages_raw (id, message_index, data)
+      SELECT NEW.id, msg.ordinality - 1, msg.value
+      FROM jsonb_array_elements(COALESCE(NEW.data->'tx'->'body'->'messages', '[]'::jsonb)) WITH ORDINALITY AS msg
+      UNION ALL
+      SELECT NEW.id, 10000 * msg.ordinality + nested.ordinality - 1, nested.value
+      FROM jsonb_array_elements(COALESCE(NEW.data->'tx'->'body'->'messages', '[]'::jsonb)) WITH ORDINALITY AS msg
+      CROSS JOIN LATERAL jsonb_array_elements(
+        CASE WHEN jsonb_typeof(msg.value->'messages') = 'array' THEN msg.value->'messages' ELSE '[]'::jsonb END
+      ) WITH ORDINALITY AS nested;
+
+      -- Events
+      DELETE FROM api.events_main WHERE id = NEW.id;
+
+      INSERT INTO api.events_main (id, event_index, attr_index, event_type, attr_key, attr_value, msg_index)
+      SELECT
+        NEW.id,
+        event.ordinality - 1,
+        COALESCE(attr.ordinality - 1, 0),
+        event.value->>'type',
+        attr.value->>'key',
+        attr.value->>'value',
+        (
+          SELECT (msg_attr->>'value')::BIGINT
+          FROM jsonb_array_elements(COALESCE(event.value->'attributes', '[]'::jsonb)) AS msg_attr
+          WHERE msg_attr->>'key' = 'msg_index' AND msg_attr->>'value' ~ '^[0-9]+$'
+          LIMIT 1
+        )
+      FROM jsonb_array_elements(COALESCE(NEW.data->'txResponse'->'events', '[]'::jsonb)) WITH ORDINALITY AS event
+      LEFT JOIN LATERAL jsonb_array_elements(COALESCE(event.value->'attributes', '[]'::jsonb)) WITH ORDINALITY AS attr ON TRUE;
+
+      RETURN NEW;
+    END;
+    $fn$;
+  END IF;
+END;
+$$;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT FROM pg_trigger WHERE tgname = 'update_transaction_main' AND tgrelid = 'api.transactions_raw'::regclass) THEN
+    CREATE TRIGGER update_transaction_main
+    AFTER INSERT OR UPDATE ON api.transactions_raw
+    FOR EACH ROW EXECUTE FUNCTION api.update_transaction_main();
+  END IF;
+END;
+$$;
+
+DO $$
+BEGIN
+  IF to_regprocedure('api.update_message_main()') IS NULL THEN
+    CREATE FUNCTION api.update_message_main()
+    RETURNS TRIGGER
+    LANGUAGE plpgsql
+    AS $fn$
+    DECLARE
+      msg_sender TEXT;
+    BEGIN
+      msg_sender := api.extract_sender(NEW.data);
+
+      INSERT INTO api.messages_main (id, message_index, height, type, sender, mentions, metadata)
+      VALUES (
+        NEW.id,
+        NEW.message_index,
+        (SELECT height FROM api.transactions_main WHERE id = NEW.id),
+        NEW.data->>'@type',
+        msg_sender,
+        array_remove(api.extract_addresses(NEW.data), msg_sender),
+        NEW.data - '@type'
+      )
+      ON CONFLICT (id, message_index) DO UPDATE SET
+        height = EXCLUDED.height,
+        type = EXCLUDED.type,
+        sender = EXCLUDED.sender,
+        mentions = EXCLUDED.mentions,
+        metadata = EXCLUDED.metadata;
+
+      RETURN NEW;
+    END;
+    $fn$;
+  END IF;
+END;
+$$;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT FROM pg_trigger WHERE tgname = 'update_message_main' AND tgrelid = 'api.messages_raw'::regclass) THEN
+    CREATE TRIGGER update_message_main
+    AFTER INSERT OR UPDATE ON api.messages_raw
+    FOR EACH ROW EXECUTE FUNCTION api.update_message_main();
+  END IF;
+END;
+$$;
+
+-- API functions
+
+-- get_messages_for_address returns the messages sent by or mentioning the address, with their transaction.
+DO $$
+BEGIN
+  IF to_regprocedure('api.get_messages_for_address(text)') IS NULL THEN
+    CREATE FUNCTION api.get_messages_for_address(_address TEXT)
+    RETURNS TABLE (
+      id TEXT,
+      message_index BIGINT,
+      type TEXT,
+      sender TEXT,
+      mentions TEXT[],
+      metadata JSONB,
+      fee JSONB,
+      memo TEXT,
+      error TEXT,
+      height BIGINT,
+      "timestamp" TIMESTAMPTZ,
+      proposal_ids TEXT[]
+    )
+    LANGUAGE SQL STABLE
+    AS $fn$
+      SELECT m.id, m.message_index, m.type, m.sender, m.mentions, m.metadata,
+             t.fee, t.memo, t.error, t.height, t.timestamp, t.proposal_ids
+      FROM api.messages_main m
+      JOIN api.transactions_main t ON t.id = m.id
+      WHERE m.sender = _address OR m.mentions @> ARRAY[_address]
+      ORDER BY t.height DESC, m.id, m.message_index;
+    $fn$;
+  END IF;
+END;
+$$;
+
+-- Anonymous read-only role used by PostgREST. Creating it requires the CREATEROLE privilege.
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'web_anon') THEN
+    CREATE ROLE web_anon NOLOGIN;
+  END IF;
+EXCEPTION WHEN insufficient_privilege THEN
+  RAISE NOTICE 'Skipping the creation of the web_anon role: insufficient privilege';
+END;
+$$;
+
+DO $$
+BEGIN
+  IF EXISTS (SELECT FROM pg_roles WHERE rolname = 'web_anon') THEN
+    GRANT USAGE ON SCHEMA api TO web_anon;
+    GRANT SELECT ON ALL TABLES IN SCHEMA api TO web_anon;
+    GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA api TO web_anon;
+  END IF;
+END;
+$$;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS api.block_results_raw;
@@ -0,0 +1,7 @@
+-- Raw CometBFT block results (FinalizeBlock / BeginBlock / EndBlock events)
+CREATE SCHEMA IF NOT EXISTS api;
+
+CREATE TABLE IF NOT EXISTS api.block_results_raw (
+  id BIGINT PRIMARY KEY,
+  data JSONB NOT NULL
+);
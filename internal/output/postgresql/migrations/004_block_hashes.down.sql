@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS api.blocks_raw_hash_idx;
+ALTER TABLE api.blocks_raw DROP COLUMN IF EXISTS last_block_hash;
+ALTER TABLE api.blocks_raw DROP COLUMN IF EXISTS hash;
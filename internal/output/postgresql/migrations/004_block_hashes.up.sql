@@ -0,0 +1,7 @@
+-- Hashes of the blocks, used to verify that the stored blocks form a chain of parent hashes.
+-- The hashes of the blocks written before this migration are backfilled by yaci in batches, in the background,
+-- so that the migration does not rewrite the whole table in a single transaction.
+ALTER TABLE api.blocks_raw ADD COLUMN IF NOT EXISTS hash TEXT;
+ALTER TABLE api.blocks_raw ADD COLUMN IF NOT EXISTS last_block_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS blocks_raw_hash_idx ON api.blocks_raw (hash);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS api.chain_metadata;
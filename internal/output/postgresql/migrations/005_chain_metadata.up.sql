@@ -0,0 +1,10 @@
+-- Identity of the chain the database was built from, recorded on first run and used to detect chain resets.
+-- The table holds a single row.
+CREATE TABLE IF NOT EXISTS api.chain_metadata (
+  id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+  chain_id TEXT NOT NULL,
+  -- A block of the chain, the earliest block of the database when recorded, and its uppercase hex-encoded hash
+  initial_height BIGINT NOT NULL,
+  initial_block_hash TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,10 @@
+-- The triggers of 002_schema are not modified by the migration, only the signers triggers are dropped.
+DROP TRIGGER IF EXISTS update_message_signers ON api.messages_raw;
+DROP TRIGGER IF EXISTS set_message_signers ON api.messages_raw;
+DROP FUNCTION IF EXISTS api.update_message_signers();
+DROP FUNCTION IF EXISTS api.set_message_signers();
+DROP FUNCTION IF EXISTS api.jsonb_to_text_array(JSONB);
+
+ALTER TABLE api.messages_main DROP COLUMN IF EXISTS signers;
+ALTER TABLE api.messages_raw DROP COLUMN IF EXISTS signers;
+ALTER TABLE api.transactions_raw DROP COLUMN IF EXISTS signers;
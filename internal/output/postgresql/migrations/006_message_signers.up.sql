@@ -0,0 +1,73 @@
+-- Signers of the messages, computed by yaci from the cosmos.msg.v1.signer option of the messages.
+-- transactions_raw.signers holds a JSON array with the array of the signers of each message, by message index.
+ALTER TABLE api.transactions_raw ADD COLUMN IF NOT EXISTS signers JSONB;
+ALTER TABLE api.messages_raw ADD COLUMN IF NOT EXISTS signers TEXT[];
+ALTER TABLE api.messages_main ADD COLUMN IF NOT EXISTS signers TEXT[];
+
+-- The signers are copied by triggers of their own, so that the functions of the triggers of 002_schema, which may be
+-- managed by the yaci-explorer-apis migrations, are kept.
+
+-- jsonb_to_text_array returns the elements of a JSON array of strings, or NULL if the value is not a non-empty array.
+CREATE OR REPLACE FUNCTION api.jsonb_to_text_array(doc JSONB)
+RETURNS TEXT[]
+LANGUAGE SQL IMMUTABLE
+AS $$
+  SELECT CASE WHEN jsonb_typeof(doc) = 'array' THEN NULLIF(ARRAY(SELECT jsonb_array_elements_text(doc)), '{}') END;
+$$;
+
+-- set_message_signers sets the signers of a message from the signers of its transaction.
+-- The messages nested in proposals have no signers.
+CREATE OR REPLACE FUNCTION api.set_message_signers()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NEW.signers IS NULL AND NEW.message_index < 10000 THEN
+    NEW.signers := api.jsonb_to_text_array(
+      (SELECT signers->(NEW.message_index::INT) FROM api.transactions_raw WHERE id = NEW.id)
+    );
+  END IF;
+
+  RETURN NEW;
+END;
+$$;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT FROM pg_trigger WHERE tgname = 'set_message_signers' AND tgrelid = 'api.messages_raw'::regclass) THEN
+    CREATE TRIGGER set_message_signers
+    BEFORE INSERT OR UPDATE ON api.messages_raw
+    FOR EACH ROW EXECUTE FUNCTION api.set_message_signers();
+  END IF;
+END;
+$$;
+
+-- update_message_signers copies the signers of a message to messages_main, once populated by update_message_main:
+-- the triggers of the same event fire in alphabetical order. The signers take precedence over the field name
+-- heuristics for the sender.
+CREATE OR REPLACE FUNCTION api.update_message_signers()
+RETURNS TRIGGER
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NEW.signers IS NOT NULL THEN
+    UPDATE api.messages_main SET
+      sender = NEW.signers[1],
+      signers = NEW.signers,
+      mentions = array_remove(api.extract_addresses(NEW.data), NEW.signers[1])
+    WHERE id = NEW.id AND message_index = NEW.message_index;
+  END IF;
+
+  RETURN NEW;
+END;
+$$;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT FROM pg_trigger WHERE tgname = 'update_message_signers' AND tgrelid = 'api.messages_raw'::regclass) THEN
+    CREATE TRIGGER update_message_signers
+    AFTER INSERT OR UPDATE ON api.messages_raw
+    FOR EACH ROW EXECUTE FUNCTION api.update_message_signers();
+  END IF;
+END;
+$$;
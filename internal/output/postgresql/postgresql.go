@@ -2,19 +2,23 @@ package postgresql
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
 	"embed"
 	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 
-	"github.com/golang-migrate/migrate/v4"
-	migratepgx "github.com/golang-migrate/migrate/v4/database/pgx"
-	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 
+	"github.com/manifest-network/yaci/internal/config"
 	"github.com/manifest-network/yaci/internal/models"
 )
 
@@ -23,43 +27,107 @@ var migrationsFS embed.FS
 
 type PostgresOutputHandler struct {
 	pool *pgxpool.Pool
+	// batchSize is the number of blocks written per batch. Blocks are written one transaction per block when lower than 2.
+	batchSize int
+
+	mu      sync.Mutex
+	pending []pendingBlock
+	// flushErr is the error of the last failed background flush, returned by the writes until a flush succeeds.
+	flushErr error
+
+	stop chan struct{}
+	done chan struct{}
+
+	// backfillCancel stops the backfill of the block hashes, and backfillDone is closed once it returned
+	backfillCancel context.CancelFunc
+	backfillDone   chan struct{}
 }
 
 func (h *PostgresOutputHandler) GetPool() *pgxpool.Pool {
 	return h.pool
 }
 
-func NewPostgresOutputHandler(connString string) (*PostgresOutputHandler, error) {
-	config, err := pgxpool.ParseConfig(connString)
+// NewPostgresOutputHandler connects to the PostgreSQL database, applies the pending migrations, and verifies
+// that the schema has the tables, columns, functions and triggers yaci relies on, unless the check is skipped.
+// When the batch size is greater than 1, blocks are buffered and written in batches with COPY,
+// and pending blocks are written at least every flush interval.
+func NewPostgresOutputHandler(cfg config.PostgresConfig) (*PostgresOutputHandler, error) {
+	if cfg.BatchSize > 1 && cfg.FlushInterval <= 0 {
+		return nil, errors.New("flush interval must be greater than 0")
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.ConnString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse PostgreSQL connection string: %w", err)
 	}
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
 	}
 
 	handler := &PostgresOutputHandler{
-		pool: pool,
+		pool:      pool,
+		batchSize: int(cfg.BatchSize),
 	}
 
 	// Run migrations. This is idempotent.
 	if err = handler.runMigrations(); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	if cfg.SkipSchemaCheck {
+		slog.Warn("Skipping the database schema check")
+	} else if err = checkSchema(context.Background(), stdlib.OpenDBFromPool(pool)); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	if handler.batchSize > 1 {
+		handler.stop = make(chan struct{})
+		handler.done = make(chan struct{})
+		go handler.flushLoop(cfg.FlushInterval)
+	}
+
+	handler.startBackfill()
+
 	return handler, nil
 }
 
+// startBackfill backfills the hashes of the blocks written before the hash columns existed, in the background.
+// Until then, the hashes of these blocks are read from their JSON.
+func (h *PostgresOutputHandler) startBackfill() {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.backfillCancel = cancel
+	h.backfillDone = make(chan struct{})
+
+	go func() {
+		defer close(h.backfillDone)
+		count, err := backfillBlockHashes(ctx, stdlib.OpenDBFromPool(h.pool), backfillBatchSize)
+		switch {
+		case ctx.Err() != nil:
+			slog.Info("Block hashes backfill interrupted, it resumes at the next start", "count", count)
+		case err != nil:
+			slog.Error("Failed to backfill the block hashes", "count", count, "error", err)
+		case count > 0:
+			slog.Info("Block hashes backfilled", "count", count)
+		}
+	}()
+}
+
 func (h *PostgresOutputHandler) GetLatestBlock(ctx context.Context) (*models.Block, error) {
+	if err := h.Flush(ctx); err != nil {
+		return nil, err
+	}
+
 	var block models.Block
 	err := h.pool.QueryRow(ctx, `
-		SELECT id
+		SELECT id, COALESCE(hash, `+blockHashExpr+`, ''), COALESCE(last_block_hash, `+lastBlockHashExpr+`, '')
 		FROM api.blocks_raw
 		ORDER BY id DESC
 		LIMIT 1
-	`).Scan(&block.ID)
+	`).Scan(&block.ID, &block.Hash, &block.LastBlockHash)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil // No rows found
@@ -70,13 +138,17 @@ func (h *PostgresOutputHandler) GetLatestBlock(ctx context.Context) (*models.Blo
 }
 
 func (h *PostgresOutputHandler) GetEarliestBlock(ctx context.Context) (*models.Block, error) {
+	if err := h.Flush(ctx); err != nil {
+		return nil, err
+	}
+
 	var block models.Block
 	err := h.pool.QueryRow(ctx, `
-		SELECT id
+		SELECT id, COALESCE(hash, `+blockHashExpr+`, ''), COALESCE(last_block_hash, `+lastBlockHashExpr+`, '')
 		FROM api.blocks_raw
 		ORDER BY id ASC
 		LIMIT 1
-	`).Scan(&block.ID)
+	`).Scan(&block.ID, &block.Hash, &block.LastBlockHash)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil // No rows found
@@ -87,6 +159,10 @@ func (h *PostgresOutputHandler) GetEarliestBlock(ctx context.Context) (*models.B
 }
 
 func (h *PostgresOutputHandler) GetMissingBlockIds(ctx context.Context) ([]uint64, error) {
+	if err := h.Flush(ctx); err != nil {
+		return nil, err
+	}
+
 	rows, err := h.pool.Query(ctx, `
 		SELECT s.id
 		FROM generate_series(
@@ -114,6 +190,27 @@ func (h *PostgresOutputHandler) GetMissingBlockIds(ctx context.Context) ([]uint6
 }
 
 func (h *PostgresOutputHandler) WriteBlockWithTransactions(ctx context.Context, block *models.Block, transactions []*models.Transaction) error {
+	if h.batchSize <= 1 {
+		return h.writeBlock(ctx, block, transactions)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.flushErr != nil {
+		return h.flushErr
+	}
+
+	h.pending = append(h.pending, pendingBlock{block: block, transactions: transactions})
+	if len(h.pending) >= h.batchSize {
+		return h.flushLocked(ctx)
+	}
+
+	return nil
+}
+
+// writeBlock writes the block and its transactions in a single transaction.
+func (h *PostgresOutputHandler) writeBlock(ctx context.Context, block *models.Block, transactions []*models.Transaction) error {
 	tx, err := h.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -122,19 +219,30 @@ func (h *PostgresOutputHandler) WriteBlockWithTransactions(ctx context.Context,
 
 	// Write block
 	_, err = tx.Exec(ctx, `
-		INSERT INTO api.blocks_raw (id, data) VALUES ($1, $2)
-		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data;
-	`, block.ID, block.Data)
+		INSERT INTO api.blocks_raw (id, data, hash, last_block_hash) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, hash = EXCLUDED.hash, last_block_hash = EXCLUDED.last_block_hash;
+	`, block.ID, block.Data, nullString(block.Hash), nullString(block.LastBlockHash))
 	if err != nil {
 		return fmt.Errorf("failed to write blockchain block: %w", err)
 	}
 
+	// Write block results, if extracted
+	if block.Results != nil {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO api.block_results_raw (id, data) VALUES ($1, $2)
+			ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data;
+		`, block.ID, block.Results)
+		if err != nil {
+			return fmt.Errorf("failed to write blockchain block results: %w", err)
+		}
+	}
+
 	// Write transactions
 	for _, txData := range transactions {
 		_, err = tx.Exec(ctx, `
-			INSERT INTO api.transactions_raw (id, data) VALUES ($1, $2)
-			ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data;
-		`, txData.Hash, txData.Data)
+			INSERT INTO api.transactions_raw (id, data, signers) VALUES ($1, $2, $3)
+			ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, signers = EXCLUDED.signers;
+		`, txData.Hash, txData.Data, nullSigners(txData.Signers))
 		if err != nil {
 			return fmt.Errorf("failed to write blockchain transaction: %w", err)
 		}
@@ -148,37 +256,145 @@ func (h *PostgresOutputHandler) WriteBlockWithTransactions(ctx context.Context,
 	return nil
 }
 
-func (h *PostgresOutputHandler) runMigrations() error {
-	// Create tables if they don't exist
-	slog.Info("Running PostgreSQL migrations...")
+// Rollback deletes the blocks at and above the given height, their results and their transactions,
+// along with the parsed messages and events of the transactions.
+func (h *PostgresOutputHandler) Rollback(ctx context.Context, height uint64) error {
+	if err := h.Flush(ctx); err != nil {
+		return err
+	}
 
-	d, err := iofs.New(migrationsFS, "migrations")
+	return rollbackBlocks(ctx, stdlib.OpenDBFromPool(h.pool), height)
+}
+
+// rollbackBlocks deletes the blocks at and above the given height and their transactions, in a single transaction.
+// The transactions are found by their parsed height, and by the hashes of the transactions of the deleted blocks,
+// as the transactions stored with error metadata have no parsed height.
+func rollbackBlocks(ctx context.Context, db *sql.DB, height uint64) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create migration source: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback() // Ensure rollback if commit is not reached
 
-	driver, err := migratepgx.WithInstance(stdlib.OpenDBFromPool(h.pool), &migratepgx.Config{})
+	hashes, err := blockTransactionHashes(ctx, tx, height)
 	if err != nil {
-		return fmt.Errorf("failed to create migration driver: %w", err)
+		return err
 	}
 
-	m, err := migrate.NewWithInstance("iofs", d, "postgres", driver)
-	if err != nil {
-		return fmt.Errorf("failed to create migration instance: %w", err)
+	// The parsed tables are deleted last, as they hold the height of the transactions
+	const rolledBack = `SELECT id FROM api.transactions_main WHERE height >= $1 UNION SELECT unnest($2::text[])`
+	for _, query := range []string{
+		`DELETE FROM api.events_main WHERE id IN (` + rolledBack + `)`,
+		`DELETE FROM api.messages_main WHERE id IN (` + rolledBack + `)`,
+		`DELETE FROM api.messages_raw WHERE id IN (` + rolledBack + `)`,
+		`DELETE FROM api.transactions_raw WHERE id IN (` + rolledBack + `)`,
+		`DELETE FROM api.transactions_main WHERE id IN (` + rolledBack + `)`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, height, hashes); err != nil {
+			return fmt.Errorf("failed to roll back to block %d: %w", height, err)
+		}
+	}
+	for _, query := range []string{
+		`DELETE FROM api.block_results_raw WHERE id >= $1`,
+		`DELETE FROM api.blocks_raw WHERE id >= $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, height); err != nil {
+			return fmt.Errorf("failed to roll back to block %d: %w", height, err)
+		}
 	}
-	defer m.Close()
 
-	// Run migrations
-	if err = m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return fmt.Errorf("failed to run migrations: %w", err)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	return nil
 }
 
+// blockTransactionHashes returns the hashes of the transactions of the blocks at and above the given height,
+// as the lowercase hex-encoded SHA-256 of the transactions, like the transaction IDs.
+func blockTransactionHashes(ctx context.Context, tx *sql.Tx, height uint64) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, data->'block'->'data'->'txs' FROM api.blocks_raw WHERE id >= $1`, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the transactions of the blocks: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := []string{}
+	for rows.Next() {
+		var (
+			id  uint64
+			raw []byte
+		)
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, fmt.Errorf("failed to scan the transactions of the blocks: %w", err)
+		}
+		if raw == nil {
+			continue
+		}
+
+		var txs []string
+		if err := json.Unmarshal(raw, &txs); err != nil {
+			return nil, fmt.Errorf("failed to decode the transactions of block %d: %w", id, err)
+		}
+		for _, encoded := range txs {
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode a transaction of block %d: %w", id, err)
+			}
+			hash := sha256.Sum256(decoded)
+			hashes = append(hashes, hex.EncodeToString(hash[:]))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get the transactions of the blocks: %w", err)
+	}
+
+	return hashes, nil
+}
+
+func (h *PostgresOutputHandler) runMigrations() error {
+	// Create tables if they don't exist
+	slog.Info("Running PostgreSQL migrations...")
+
+	migrator, err := newMigrator(h.pool)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	return migrator.Up()
+}
+
 func (h *PostgresOutputHandler) Close() error {
+	var err error
+	if h.batchSize > 1 {
+		close(h.stop)
+		<-h.done
+		err = h.Flush(context.Background())
+	}
+
+	h.backfillCancel()
+	<-h.backfillDone
+
 	slog.Info("Closing PostgreSQL connection pool")
 	h.pool.Close()
 	slog.Info("PostgreSQL connection pool closed")
-	return nil
+	return err
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullSigners returns the JSON encoded signers of the messages of a transaction, or nil if unknown.
+func nullSigners(signers [][]string) any {
+	if signers == nil {
+		return nil
+	}
+	// Marshaling strings cannot fail
+	b, _ := json.Marshal(signers)
+	return b
 }
@@ -0,0 +1,67 @@
+package postgresql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// arrayConverter passes the string slices to the mock, like the pgx driver which encodes them as arrays.
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v any) (driver.Value, error) {
+	if s, ok := v.([]string); ok {
+		return s, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func TestRollbackBlocks(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Block 11 holds a transaction stored with error metadata, which has no parsed height
+	errorTx := []byte("error tx")
+	hash := sha256.Sum256(errorTx)
+	errorTxHash := hex.EncodeToString(hash[:])
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, data->'block'->'data'->'txs' FROM api.blocks_raw WHERE id >= $1`)).WithArgs(uint64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "txs"}).
+			AddRow(uint64(10), []byte(`[]`)).
+			AddRow(uint64(11), []byte(`["`+base64.StdEncoding.EncodeToString(errorTx)+`"]`)).
+			AddRow(uint64(12), nil))
+	for _, table := range []string{"events_main", "messages_main", "messages_raw", "transactions_raw", "transactions_main"} {
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM api.`+table+` WHERE id IN (SELECT id FROM api.transactions_main WHERE height >= $1 UNION SELECT unnest($2::text[]))`)).
+			WithArgs(uint64(10), []string{errorTxHash}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM api.block_results_raw WHERE id >= $1`)).WithArgs(uint64(10)).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM api.blocks_raw WHERE id >= $1`)).WithArgs(uint64(10)).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	require.NoError(t, rollbackBlocks(context.Background(), db, 10))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRollbackBlocksInvalidTransactions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id").WillReturnRows(sqlmock.NewRows([]string{"id", "txs"}).AddRow(uint64(10), []byte(`["not base64!"]`)))
+	mock.ExpectRollback()
+
+	assert.ErrorContains(t, rollbackBlocks(context.Background(), db, 10), "failed to decode a transaction of block 10")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,170 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// requiredColumns lists the tables and columns written by yaci or read by the metrics collectors.
+var requiredColumns = map[string][]string{
+	"api.blocks_raw":        {"id", "data", "hash", "last_block_hash"},
+	"api.block_results_raw": {"id", "data"},
+	"api.transactions_raw":  {"id", "data", "signers"},
+	"api.messages_raw":      {"id", "message_index", "data"},
+	"api.transactions_main": {"id", "fee", "memo", "error", "height", "timestamp", "proposal_ids"},
+	"api.messages_main":     {"id", "message_index", "type", "sender", "mentions", "metadata"},
+	"api.events_main":       {"id", "event_index", "attr_index", "event_type", "attr_key", "attr_value", "msg_index"},
+	"api.chain_metadata":    {"chain_id", "initial_height", "initial_block_hash"},
+}
+
+// requiredFunctions lists the functions read by the metrics collectors.
+var requiredFunctions = []string{"api.get_messages_for_address"}
+
+// requiredTriggers lists the tables that must have an enabled row-level INSERT trigger populating the parsed tables.
+var requiredTriggers = []string{"api.transactions_raw", "api.messages_raw"}
+
+// SchemaMismatchError lists the database objects missing from the schema.
+type SchemaMismatchError struct {
+	Missing []string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("incompatible database schema, run `yaci migrate status` to check the migrations or use --skip-schema-check to bypass this check:\n  - %s",
+		strings.Join(e.Missing, "\n  - "))
+}
+
+// schemaSnapshot holds the database objects of the schema.
+type schemaSnapshot struct {
+	// columns maps the qualified table names to their columns
+	columns   map[string][]string
+	functions []string
+	// triggers lists the qualified names of the tables having an enabled row-level INSERT trigger
+	triggers []string
+}
+
+// checkSchema verifies that the database has the tables, columns, functions and triggers yaci relies on.
+func checkSchema(ctx context.Context, db *sql.DB) error {
+	snapshot, err := loadSchemaSnapshot(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to inspect the database schema: %w", err)
+	}
+
+	if missing := diffSchema(snapshot); len(missing) > 0 {
+		return &SchemaMismatchError{Missing: missing}
+	}
+
+	return nil
+}
+
+func loadSchemaSnapshot(ctx context.Context, db *sql.DB) (schemaSnapshot, error) {
+	snapshot := schemaSnapshot{columns: make(map[string][]string)}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT table_schema || '.' || table_name, column_name
+		FROM information_schema.columns
+		WHERE table_schema = 'api'
+	`)
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to list columns: %w", err)
+	}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			rows.Close()
+			return snapshot, fmt.Errorf("failed to scan column: %w", err)
+		}
+		snapshot.columns[table] = append(snapshot.columns[table], column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return snapshot, fmt.Errorf("failed to list columns: %w", err)
+	}
+
+	snapshot.functions, err = queryStrings(ctx, db, `
+		SELECT n.nspname || '.' || p.proname
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = 'api'
+	`)
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to list functions: %w", err)
+	}
+
+	// tgtype bit 0 is set for row-level triggers, and bit 2 for INSERT triggers
+	snapshot.triggers, err = queryStrings(ctx, db, `
+		SELECT DISTINCT n.nspname || '.' || c.relname
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'api'
+		  AND NOT t.tgisinternal
+		  AND t.tgenabled <> 'D'
+		  AND t.tgtype & 1 = 1
+		  AND t.tgtype & 4 = 4
+	`)
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to list triggers: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// diffSchema returns the description of the required objects missing from the snapshot, in a stable order.
+func diffSchema(snapshot schemaSnapshot) []string {
+	var missing []string
+
+	tables := make([]string, 0, len(requiredColumns))
+	for table := range requiredColumns {
+		tables = append(tables, table)
+	}
+	slices.Sort(tables)
+
+	for _, table := range tables {
+		columns, ok := snapshot.columns[table]
+		if !ok {
+			missing = append(missing, "table "+table)
+			continue
+		}
+		for _, column := range requiredColumns[table] {
+			if !slices.Contains(columns, column) {
+				missing = append(missing, fmt.Sprintf("column %s.%s", table, column))
+			}
+		}
+	}
+
+	for _, function := range requiredFunctions {
+		if !slices.Contains(snapshot.functions, function) {
+			missing = append(missing, "function "+function)
+		}
+	}
+
+	for _, table := range requiredTriggers {
+		if !slices.Contains(snapshot.triggers, table) {
+			missing = append(missing, "row-level INSERT trigger on "+table)
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,70 @@
+package postgresql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// completeSnapshot returns a snapshot having all the required objects.
+func completeSnapshot() schemaSnapshot {
+	snapshot := schemaSnapshot{
+		columns:   make(map[string][]string),
+		functions: append([]string{"api.extract_sender"}, requiredFunctions...),
+		triggers:  requiredTriggers,
+	}
+	for table, columns := range requiredColumns {
+		snapshot.columns[table] = append([]string{"extra"}, columns...)
+	}
+	return snapshot
+}
+
+func TestDiffSchema(t *testing.T) {
+	assert.Empty(t, diffSchema(completeSnapshot()))
+
+	snapshot := completeSnapshot()
+	delete(snapshot.columns, "api.events_main")
+	snapshot.columns["api.messages_main"] = []string{"id", "message_index", "type", "mentions", "metadata"}
+	snapshot.columns["api.blocks_raw"] = []string{"id"}
+	snapshot.functions = nil
+	snapshot.triggers = []string{"api.transactions_raw"}
+
+	assert.Equal(t, []string{
+		"column api.blocks_raw.data",
+		"column api.blocks_raw.hash",
+		"column api.blocks_raw.last_block_hash",
+		"table api.events_main",
+		"column api.messages_main.sender",
+		"function api.get_messages_for_address",
+		"row-level INSERT trigger on api.messages_raw",
+	}, diffSchema(snapshot))
+}
+
+func TestCheckSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	columns := sqlmock.NewRows([]string{"table", "column"})
+	for table, names := range requiredColumns {
+		for _, name := range names {
+			if table == "api.transactions_main" && name == "proposal_ids" {
+				continue
+			}
+			columns.AddRow(table, name)
+		}
+	}
+	mock.ExpectQuery("FROM information_schema.columns").WillReturnRows(columns)
+	mock.ExpectQuery("FROM pg_proc").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("api.get_messages_for_address"))
+	mock.ExpectQuery("FROM pg_trigger").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("api.transactions_raw").AddRow("api.messages_raw"))
+
+	err = checkSchema(context.Background(), db)
+	var mismatch *SchemaMismatchError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, []string{"column api.transactions_main.proposal_ids"}, mismatch.Missing)
+	assert.ErrorContains(t, err, "--skip-schema-check")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
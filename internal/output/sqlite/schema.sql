@@ -0,0 +1,60 @@
+-- Schema of the SQLite output. Tables are populated by the handler, no triggers are involved.
+CREATE TABLE IF NOT EXISTS blocks (
+  height           INTEGER PRIMARY KEY,
+  hash             TEXT,
+  last_block_hash  TEXT,
+  chain_id         TEXT,
+  time             TEXT,
+  proposer_address TEXT,
+  num_txs          INTEGER NOT NULL DEFAULT 0,
+  data             TEXT NOT NULL,
+  results          TEXT
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+  hash       TEXT PRIMARY KEY,
+  height     INTEGER NOT NULL,
+  timestamp  TEXT,
+  code       INTEGER NOT NULL DEFAULT 0,
+  codespace  TEXT,
+  gas_wanted INTEGER NOT NULL DEFAULT 0,
+  gas_used   INTEGER NOT NULL DEFAULT 0,
+  memo       TEXT,
+  fee        TEXT,
+  error      TEXT,
+  data       TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS transactions_height_idx ON transactions (height);
+
+CREATE TABLE IF NOT EXISTS messages (
+  tx_hash       TEXT NOT NULL,
+  message_index INTEGER NOT NULL,
+  height        INTEGER NOT NULL,
+  type          TEXT NOT NULL,
+  data          TEXT NOT NULL,
+  -- The first signer of the message, or the sender derived from its field names if its signers are unknown,
+  -- and the JSON array of all its signers, if known
+  sender        TEXT,
+  signers       TEXT,
+  PRIMARY KEY (tx_hash, message_index)
+);
+
+CREATE INDEX IF NOT EXISTS messages_type_idx ON messages (type);
+CREATE INDEX IF NOT EXISTS messages_height_idx ON messages (height);
+CREATE INDEX IF NOT EXISTS messages_sender_idx ON messages (sender, height);
+
+CREATE TABLE IF NOT EXISTS events (
+  tx_hash     TEXT NOT NULL,
+  event_index INTEGER NOT NULL,
+  attr_index  INTEGER NOT NULL,
+  height      INTEGER NOT NULL,
+  event_type  TEXT NOT NULL,
+  attr_key    TEXT NOT NULL,
+  attr_value  TEXT NOT NULL,
+  msg_index   INTEGER,
+  PRIMARY KEY (tx_hash, event_index, attr_index)
+);
+
+CREATE INDEX IF NOT EXISTS events_type_key_idx ON events (event_type, attr_key);
+CREATE INDEX IF NOT EXISTS events_height_idx ON events (height);
@@ -0,0 +1,416 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output/flatten"
+)
+
+//go:embed schema.sql
+var schema string
+
+// pendingBlock is a block waiting to be written by the next batch.
+type pendingBlock struct {
+	block        *models.Block
+	parsed       *flatten.Block
+	transactions []pendingTransaction
+}
+
+type pendingTransaction struct {
+	raw      *models.Transaction
+	parsed   *flatten.Transaction
+	messages []flatten.Message
+	events   []flatten.Event
+}
+
+type SQLiteOutputHandler struct {
+	db        *sql.DB
+	batchSize int
+
+	mu      sync.Mutex
+	pending []pendingBlock
+	// flushErr is the error of the last failed background flush, returned by the writes until a flush succeeds.
+	flushErr error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSQLiteOutputHandler opens, or creates, the SQLite database at the given path and applies the embedded schema.
+// Blocks are written in batches of batchSize blocks, and pending blocks are written at least every flushInterval.
+func NewSQLiteOutputHandler(path string, batchSize int, flushInterval time.Duration) (*SQLiteOutputHandler, error) {
+	if batchSize <= 0 {
+		return nil, errors.New("batch size must be greater than 0")
+	}
+	if flushInterval <= 0 {
+		return nil, errors.New("flush interval must be greater than 0")
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?%s", path, params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	// SQLite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create SQLite schema: %w", err)
+	}
+
+	handler := &SQLiteOutputHandler{
+		db:        db,
+		batchSize: batchSize,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	go handler.flushLoop(flushInterval)
+
+	return handler, nil
+}
+
+func (h *SQLiteOutputHandler) GetLatestBlock(ctx context.Context) (*models.Block, error) {
+	if err := h.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	var block models.Block
+	err := h.db.QueryRowContext(ctx, `
+		SELECT height, COALESCE(hash, ''), COALESCE(last_block_hash, '') FROM blocks ORDER BY height DESC LIMIT 1
+	`).Scan(&block.ID, &block.Hash, &block.LastBlockHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No rows found
+		}
+		return nil, fmt.Errorf("failed to get the latest block: %w", err)
+	}
+	return &block, nil
+}
+
+func (h *SQLiteOutputHandler) GetEarliestBlock(ctx context.Context) (*models.Block, error) {
+	if err := h.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	var block models.Block
+	err := h.db.QueryRowContext(ctx, `
+		SELECT height, COALESCE(hash, ''), COALESCE(last_block_hash, '') FROM blocks ORDER BY height ASC LIMIT 1
+	`).Scan(&block.ID, &block.Hash, &block.LastBlockHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // No rows found
+		}
+		return nil, fmt.Errorf("failed to get the earliest block: %w", err)
+	}
+	return &block, nil
+}
+
+func (h *SQLiteOutputHandler) GetMissingBlockIds(ctx context.Context) ([]uint64, error) {
+	if err := h.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		WITH RECURSIVE
+			bounds(lo, hi) AS (SELECT MIN(height), MAX(height) FROM blocks),
+			heights(height) AS (
+				SELECT lo FROM bounds WHERE lo IS NOT NULL
+				UNION ALL
+				SELECT height + 1 FROM heights, bounds WHERE height < hi
+			)
+		SELECT h.height
+		FROM heights h
+		LEFT JOIN blocks b ON b.height = h.height
+		WHERE b.height IS NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get missing block IDs: %w", err)
+	}
+	defer rows.Close()
+
+	var missing []uint64
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan missing block ID: %w", err)
+		}
+		missing = append(missing, id)
+	}
+
+	return missing, rows.Err()
+}
+
+func (h *SQLiteOutputHandler) WriteBlockWithTransactions(ctx context.Context, block *models.Block, transactions []*models.Transaction) error {
+	// Flatten the block before taking the lock
+	pending := pendingBlock{block: block}
+
+	parsed, err := flatten.ParseBlock(block.ID, block.Data)
+	if err != nil {
+		return err
+	}
+	pending.parsed = parsed
+
+	for _, transaction := range transactions {
+		tx, messages, events, err := flatten.ParseTransaction(block.ID, transaction.Hash, transaction.Data, transaction.Signers)
+		if err != nil {
+			return err
+		}
+		pending.transactions = append(pending.transactions, pendingTransaction{raw: transaction, parsed: tx, messages: messages, events: events})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.flushErr != nil {
+		return h.flushErr
+	}
+
+	h.pending = append(h.pending, pending)
+	if len(h.pending) >= h.batchSize {
+		return h.flushLocked(ctx)
+	}
+
+	return nil
+}
+
+// Flush writes the pending blocks to the database.
+func (h *SQLiteOutputHandler) Flush(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flushLocked(ctx)
+}
+
+// Rollback deletes the blocks at and above the given height, along with their transactions, messages and events.
+func (h *SQLiteOutputHandler) Rollback(ctx context.Context, height uint64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.flushLocked(ctx); err != nil {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Ensure rollback if commit is not reached
+
+	for _, table := range []string{"events", "messages", "transactions", "blocks"} {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE height >= ?`, table), height); err != nil {
+			return fmt.Errorf("failed to roll back %s to block %d: %w", table, height, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (h *SQLiteOutputHandler) Close() error {
+	slog.Info("Closing SQLite database")
+
+	close(h.stop)
+	<-h.done
+
+	err := h.Flush(context.Background())
+	err = errors.Join(err, h.db.Close())
+
+	slog.Info("SQLite database closed")
+	return err
+}
+
+func (h *SQLiteOutputHandler) flushLoop(interval time.Duration) {
+	defer close(h.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.mu.Lock()
+			if err := h.flushLocked(context.Background()); err != nil {
+				slog.Error("Failed to write blocks to SQLite", "error", err)
+				h.flushErr = err
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// flushLocked writes the pending blocks in a single transaction. The caller must hold the lock.
+// Blocks and transactions are upserted, and the messages and events of a rewritten transaction are replaced.
+func (h *SQLiteOutputHandler) flushLocked(ctx context.Context) error {
+	if len(h.pending) == 0 {
+		return nil
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Ensure rollback if commit is not reached
+
+	insertBlock, err := tx.PrepareContext(ctx, `
+		INSERT OR REPLACE INTO blocks (height, hash, last_block_hash, chain_id, time, proposer_address, num_txs, data, results)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare block statement: %w", err)
+	}
+	defer insertBlock.Close()
+
+	insertTx, err := tx.PrepareContext(ctx, `
+		INSERT OR REPLACE INTO transactions (hash, height, timestamp, code, codespace, gas_wanted, gas_used, memo, fee, error, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare transaction statement: %w", err)
+	}
+	defer insertTx.Close()
+
+	deleteMessages, err := tx.PrepareContext(ctx, `DELETE FROM messages WHERE tx_hash = ?`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare message statement: %w", err)
+	}
+	defer deleteMessages.Close()
+
+	insertMessage, err := tx.PrepareContext(ctx, `
+		INSERT INTO messages (tx_hash, message_index, height, type, data, sender, signers) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare message statement: %w", err)
+	}
+	defer insertMessage.Close()
+
+	deleteEvents, err := tx.PrepareContext(ctx, `DELETE FROM events WHERE tx_hash = ?`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare event statement: %w", err)
+	}
+	defer deleteEvents.Close()
+
+	insertEvent, err := tx.PrepareContext(ctx, `
+		INSERT INTO events (tx_hash, event_index, attr_index, height, event_type, attr_key, attr_value, msg_index)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare event statement: %w", err)
+	}
+	defer insertEvent.Close()
+
+	for _, pending := range h.pending {
+		b := pending.parsed
+		_, err := insertBlock.ExecContext(ctx,
+			b.Height, nullString(b.Hash), nullString(b.LastBlockHash), nullString(b.ChainID), nullTime(b.Time),
+			nullString(b.ProposerAddress), b.NumTxs, string(pending.block.Data), nullBytes(pending.block.Results))
+		if err != nil {
+			return fmt.Errorf("failed to write block %d: %w", b.Height, err)
+		}
+
+		for _, t := range pending.transactions {
+			p := t.parsed
+			_, err := insertTx.ExecContext(ctx,
+				p.Hash, p.Height, nullTime(p.Timestamp), p.Code, nullString(p.Codespace), p.GasWanted, p.GasUsed,
+				nullString(p.Memo), nullString(p.Fee), nullString(p.Error), string(t.raw.Data))
+			if err != nil {
+				return fmt.Errorf("failed to write transaction %s: %w", p.Hash, err)
+			}
+
+			if _, err := deleteMessages.ExecContext(ctx, p.Hash); err != nil {
+				return fmt.Errorf("failed to delete messages of transaction %s: %w", p.Hash, err)
+			}
+			for _, msg := range t.messages {
+				signers, err := nullJSON(msg.Signers)
+				if err != nil {
+					return fmt.Errorf("failed to marshal the signers of message %d of transaction %s: %w", msg.MessageIndex, p.Hash, err)
+				}
+				_, err = insertMessage.ExecContext(ctx,
+					msg.TxHash, msg.MessageIndex, msg.Height, msg.Type, msg.Data, nullString(msg.Sender), signers)
+				if err != nil {
+					return fmt.Errorf("failed to write message %d of transaction %s: %w", msg.MessageIndex, p.Hash, err)
+				}
+			}
+
+			if _, err := deleteEvents.ExecContext(ctx, p.Hash); err != nil {
+				return fmt.Errorf("failed to delete events of transaction %s: %w", p.Hash, err)
+			}
+			for _, event := range t.events {
+				var msgIndex any
+				if event.MsgIndex >= 0 {
+					msgIndex = event.MsgIndex
+				}
+				_, err := insertEvent.ExecContext(ctx,
+					event.TxHash, event.EventIndex, event.AttrIndex, event.Height, event.EventType, event.AttrKey, event.AttrValue, msgIndex)
+				if err != nil {
+					return fmt.Errorf("failed to write event %d of transaction %s: %w", event.EventIndex, p.Hash, err)
+				}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	slog.Debug("Wrote blocks to SQLite", "count", len(h.pending))
+	h.pending = nil
+	h.flushErr = nil
+
+	return nil
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullBytes(b []byte) any {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
+
+func nullJSON(signers []string) (any, error) {
+	if signers == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(signers)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
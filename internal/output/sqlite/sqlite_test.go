@@ -0,0 +1,139 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/manifest-network/yaci/internal/models"
+	"github.com/manifest-network/yaci/internal/output/sqlite"
+)
+
+const testTxJSON = `{
+  "tx": {"body": {"messages": [{"@type": "/cosmos.bank.v1beta1.MsgSend", "fromAddress": "a"}], "memo": "hi"}},
+  "txResponse": {"gasWanted": "10", "gasUsed": "5", "timestamp": "2024-05-01T12:00:00Z",
+    "events": [{"type": "message", "attributes": [{"key": "action", "value": "send"}, {"key": "msg_index", "value": "0"}]}]}
+}`
+
+func writeBlock(t *testing.T, h *sqlite.SQLiteOutputHandler, height uint64, txHashes ...string) {
+	t.Helper()
+
+	block := &models.Block{
+		ID:      height,
+		Data:    []byte(fmt.Sprintf(`{"blockId": {"hash": "3q2+7w=="}, "block": {"header": {"chainId": "test-1", "height": "%d", "time": "2024-05-01T12:00:00Z"}}}`, height)),
+		Results: []byte(`{"height": "1"}`),
+	}
+	var txs []*models.Transaction
+	for _, hash := range txHashes {
+		txs = append(txs, &models.Transaction{Hash: hash, Data: []byte(testTxJSON), Signers: [][]string{{"a"}}})
+	}
+	require.NoError(t, h.WriteBlockWithTransactions(context.Background(), block, txs))
+}
+
+func count(t *testing.T, path, query string) int {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var n int
+	require.NoError(t, db.QueryRow(query).Scan(&n))
+	return n
+}
+
+func TestSQLiteOutputHandler(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "yaci.db")
+
+	h, err := sqlite.NewSQLiteOutputHandler(path, 2, time.Hour)
+	require.NoError(t, err)
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, latest)
+
+	missing, err := h.GetMissingBlockIds(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+
+	writeBlock(t, h, 1, "aa")
+	writeBlock(t, h, 2)
+	writeBlock(t, h, 5, "bb", "cc")
+	// Rewriting a transaction replaces its messages and events
+	writeBlock(t, h, 5, "bb", "cc")
+	require.NoError(t, h.Close())
+
+	assert.Equal(t, 3, count(t, path, `SELECT COUNT(*) FROM blocks`))
+	assert.Equal(t, 3, count(t, path, `SELECT COUNT(*) FROM transactions WHERE memo = 'hi' AND gas_used = 5`))
+	assert.Equal(t, 3, count(t, path, `SELECT COUNT(*) FROM messages WHERE type = '/cosmos.bank.v1beta1.MsgSend'`))
+	assert.Equal(t, 3, count(t, path, `SELECT COUNT(*) FROM messages WHERE sender = 'a' AND signers = '["a"]'`))
+	assert.Equal(t, 6, count(t, path, `SELECT COUNT(*) FROM events WHERE msg_index = 0`))
+	assert.Equal(t, 1, count(t, path, `SELECT COUNT(*) FROM blocks WHERE height = 5 AND hash = 'DEADBEEF' AND chain_id = 'test-1' AND results IS NOT NULL`))
+
+	h, err = sqlite.NewSQLiteOutputHandler(path, 100, time.Hour)
+	require.NoError(t, err)
+	defer h.Close()
+
+	latest, err = h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), latest.ID)
+	assert.Equal(t, "DEADBEEF", latest.Hash)
+
+	earliest, err := h.GetEarliestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), earliest.ID)
+
+	missing, err = h.GetMissingBlockIds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{3, 4}, missing)
+
+	// Pending blocks are written before reading
+	writeBlock(t, h, 3)
+	missing, err = h.GetMissingBlockIds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{4}, missing)
+}
+
+func TestSQLiteOutputHandlerFlushInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "yaci.db")
+
+	h, err := sqlite.NewSQLiteOutputHandler(path, 100, 10*time.Millisecond)
+	require.NoError(t, err)
+	defer h.Close()
+
+	writeBlock(t, h, 1)
+	assert.Eventually(t, func() bool {
+		return count(t, path, `SELECT COUNT(*) FROM blocks`) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSQLiteOutputHandlerRollback(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "yaci.db")
+
+	h, err := sqlite.NewSQLiteOutputHandler(path, 100, time.Hour)
+	require.NoError(t, err)
+	defer h.Close()
+
+	writeBlock(t, h, 1, "aa")
+	writeBlock(t, h, 2, "bb")
+	writeBlock(t, h, 3, "cc")
+
+	// Pending blocks are written before the rollback
+	require.NoError(t, h.Rollback(ctx, 2))
+
+	latest, err := h.GetLatestBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), latest.ID)
+
+	assert.Equal(t, 1, count(t, path, `SELECT COUNT(*) FROM transactions`))
+	assert.Equal(t, 1, count(t, path, `SELECT COUNT(*) FROM messages`))
+	assert.Equal(t, 0, count(t, path, `SELECT COUNT(*) FROM events WHERE height >= 2`))
+}
@@ -0,0 +1,132 @@
+package reflection
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// DescriptorCache persists the file descriptors of a node to a FileDescriptorSet file,
+// so that restarts do not fetch them all again, and the descriptors remain available during reflection outages.
+// It is safe for concurrent use.
+type DescriptorCache struct {
+	path string
+
+	mu    sync.Mutex
+	files map[string]*descriptorpb.FileDescriptorProto
+}
+
+// NewDescriptorCache returns the cache of the descriptors of the nodes with the given endpoints, chain ID and
+// application version, stored in the given directory. The descriptors of an upgraded node are cached in a new file.
+func NewDescriptorCache(dir string, endpoints []string, chainID, appVersion string) *DescriptorCache {
+	return &DescriptorCache{
+		path:  filepath.Join(dir, cacheFileName(endpoints, chainID, appVersion)+".binpb"),
+		files: make(map[string]*descriptorpb.FileDescriptorProto),
+	}
+}
+
+// cacheFileName returns the name of a cache file of the nodes with the given endpoints and chain ID, without extension.
+func cacheFileName(endpoints []string, chainID string, key ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(append(append(slices.Sorted(slices.Values(endpoints)), chainID), key...), "\n")))
+	return fmt.Sprintf("%s-%s", unsafeFileNameChars.ReplaceAllString(chainID, "_"), hex.EncodeToString(hash[:8]))
+}
+
+// Path returns the path of the cache file.
+func (c *DescriptorCache) Path() string {
+	return c.path
+}
+
+// Load reads the cached descriptors. It returns no descriptor if the cache file does not exist yet.
+func (c *DescriptorCache) Load() ([]*descriptorpb.FileDescriptorProto, error) {
+	content, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor cache: %w", err)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(content, set); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal descriptor cache: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, fdProto := range set.GetFile() {
+		c.files[fdProto.GetName()] = fdProto
+	}
+	return set.GetFile(), nil
+}
+
+// Add adds the descriptors to the cache, and writes the cache file if any descriptor is new.
+func (c *DescriptorCache) Add(fdProtos ...*descriptorpb.FileDescriptorProto) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	added := false
+	for _, fdProto := range fdProtos {
+		if _, exists := c.files[fdProto.GetName()]; !exists {
+			c.files[fdProto.GetName()] = fdProto
+			added = true
+		}
+	}
+	if !added {
+		return nil
+	}
+
+	return c.write()
+}
+
+// write replaces the cache file with the cached descriptors, sorted by name so that the file is deterministic.
+func (c *DescriptorCache) write() error {
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, name := range slices.Sorted(maps.Keys(c.files)) {
+		set.File = append(set.File, c.files[name])
+	}
+
+	content, err := proto.MarshalOptions{Deterministic: true}.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("failed to marshal descriptor cache: %w", err)
+	}
+
+	return writeFileAtomically(c.path, content)
+}
+
+// writeFileAtomically writes the content to a temporary file renamed over the file, so that the file is never
+// partially written. The directory of the file is created if needed.
+func writeFileAtomically(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(path), err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
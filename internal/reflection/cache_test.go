@@ -0,0 +1,64 @@
+package reflection_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/testutil"
+)
+
+func TestDescriptorCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := reflection.NewDescriptorCache(dir, []string{"b:9090", "a:9090"}, "manifest/1", "v1.0.0")
+	assert.Equal(t, dir, filepath.Dir(cache.Path()))
+	assert.Contains(t, filepath.Base(cache.Path()), "manifest_1-")
+
+	// No cache file yet
+	cached, err := cache.Load()
+	require.NoError(t, err)
+	assert.Empty(t, cached)
+
+	require.NoError(t, cache.Add(testutil.MockFileDescriptor, testutil.MockDependencyFileDescriptor))
+
+	// The descriptors are loaded by the next run, whatever the order of the endpoints
+	cached, err = reflection.NewDescriptorCache(dir, []string{"a:9090", "b:9090"}, "manifest/1", "v1.0.0").Load()
+	require.NoError(t, err)
+	require.Len(t, cached, 2)
+	assert.True(t, proto.Equal(testutil.MockDependencyFileDescriptor, cached[0]))
+	assert.True(t, proto.Equal(testutil.MockFileDescriptor, cached[1]))
+
+	// An upgraded node uses another cache file
+	upgraded := reflection.NewDescriptorCache(dir, []string{"a:9090", "b:9090"}, "manifest/1", "v2.0.0")
+	assert.NotEqual(t, cache.Path(), upgraded.Path())
+	cached, err = upgraded.Load()
+	require.NoError(t, err)
+	assert.Empty(t, cached)
+
+	// A corrupted cache file is reported
+	require.NoError(t, os.WriteFile(cache.Path(), []byte("corrupted"), 0o600))
+	_, err = cache.Load()
+	assert.ErrorContains(t, err, "failed to unmarshal descriptor cache")
+}
+
+func TestDescriptorCacheAdd(t *testing.T) {
+	cache := reflection.NewDescriptorCache(t.TempDir(), []string{"a:9090"}, "manifest-1", "v1.0.0")
+	require.NoError(t, cache.Add(testutil.MockDependencyFileDescriptor))
+
+	// Known descriptors do not rewrite the file
+	require.NoError(t, os.Remove(cache.Path()))
+	require.NoError(t, cache.Add(testutil.MockDependencyFileDescriptor))
+	assert.NoFileExists(t, cache.Path())
+
+	// New descriptors are added to the cached ones
+	require.NoError(t, cache.Add(&descriptorpb.FileDescriptorProto{Name: proto.String("new.proto")}))
+	cached, err := reflection.NewDescriptorCache(filepath.Dir(cache.Path()), []string{"a:9090"}, "manifest-1", "v1.0.0").Load()
+	require.NoError(t, err)
+	assert.Len(t, cached, 2)
+}
@@ -0,0 +1,71 @@
+package reflection
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// LoadDescriptorSets reads the file descriptors of FileDescriptorSet files, e.g., generated by protoc --descriptor_set_out,
+// or of Buf images, e.g., generated by buf build. Buf images are wire-compatible with FileDescriptorSet.
+// The files may be gzip-compressed, and are decoded as JSON when their extension is .json.
+// A file descriptor found in several files is only returned once, from the first file.
+func LoadDescriptorSets(paths []string) ([]*descriptorpb.FileDescriptorProto, error) {
+	var descriptors []*descriptorpb.FileDescriptorProto
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		set, err := loadDescriptorSet(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load descriptor set %s: %w", path, err)
+		}
+		for _, fdProto := range set.GetFile() {
+			if !seen[fdProto.GetName()] {
+				seen[fdProto.GetName()] = true
+				descriptors = append(descriptors, fdProto)
+			}
+		}
+	}
+	return descriptors, nil
+}
+
+func loadDescriptorSet(path string) (*descriptorpb.FileDescriptorSet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// gzip magic number
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		content, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if strings.EqualFold(filepath.Ext(strings.TrimSuffix(path, ".gz")), ".json") {
+		// Buf images have fields unknown to FileDescriptorSet
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(content, set)
+	} else {
+		err = proto.Unmarshal(content, set)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	if len(set.GetFile()) == 0 {
+		return nil, fmt.Errorf("no file descriptor found")
+	}
+	return set, nil
+}
@@ -0,0 +1,72 @@
+package reflection_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/testutil"
+)
+
+func writeDescriptorSet(t *testing.T, name string, content []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	return path
+}
+
+func TestLoadDescriptorSets(t *testing.T) {
+	binary, err := proto.Marshal(testutil.MockFileDescriptorSet)
+	require.NoError(t, err)
+	json, err := protojson.Marshal(testutil.MockFileDescriptorSet)
+	require.NoError(t, err)
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err = writer.Write(binary)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	for name, content := range map[string][]byte{
+		"descriptors.binpb": binary,
+		"descriptors.json":  json,
+		"image.binpb.gz":    compressed.Bytes(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			descriptors, err := reflection.LoadDescriptorSets([]string{writeDescriptorSet(t, name, content)})
+			require.NoError(t, err)
+			require.Len(t, descriptors, 2)
+			assert.True(t, proto.Equal(testutil.MockDependencyFileDescriptor, descriptors[0]))
+			assert.True(t, proto.Equal(testutil.MockFileDescriptor, descriptors[1]))
+		})
+	}
+}
+
+func TestLoadDescriptorSetsMerge(t *testing.T) {
+	binary, err := proto.Marshal(testutil.MockFileDescriptorSet)
+	require.NoError(t, err)
+	other, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		{Name: proto.String(testutil.DependencyProtoName), Package: proto.String("other")},
+		{Name: proto.String("other.proto")},
+	}})
+	require.NoError(t, err)
+
+	// The file descriptors found in several files are taken from the first file
+	descriptors, err := reflection.LoadDescriptorSets([]string{writeDescriptorSet(t, "a.binpb", binary), writeDescriptorSet(t, "b.binpb", other)})
+	require.NoError(t, err)
+	require.Len(t, descriptors, 3)
+	assert.Empty(t, descriptors[0].GetPackage())
+	assert.Equal(t, "other.proto", descriptors[2].GetName())
+
+	_, err = reflection.LoadDescriptorSets([]string{writeDescriptorSet(t, "empty.binpb", nil)})
+	assert.ErrorContains(t, err, "no file descriptor found")
+	_, err = reflection.LoadDescriptorSets([]string{writeDescriptorSet(t, "invalid.binpb", []byte("invalid"))})
+	assert.ErrorContains(t, err, "failed to unmarshal")
+}
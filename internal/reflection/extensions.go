@@ -0,0 +1,77 @@
+package reflection
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// extensionsContainer is implemented by the descriptors declaring extensions, i.e., files and messages.
+type extensionsContainer interface {
+	Extensions() protoreflect.ExtensionDescriptors
+	Messages() protoreflect.MessageDescriptors
+}
+
+// registerExtensions registers the extension types declared by the file, including the nested declarations.
+func registerExtensions(types *protoregistry.Types, container extensionsContainer) {
+	extensions := container.Extensions()
+	for i := 0; i < extensions.Len(); i++ {
+		xd := extensions.Get(i)
+		if err := types.RegisterExtension(dynamicpb.NewExtensionType(xd)); err != nil {
+			slog.Warn("Failed to register extension", "extension", xd.FullName(), "error", err)
+		}
+	}
+
+	messages := container.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		registerExtensions(types, messages.Get(i))
+	}
+}
+
+// Options returns the options of the descriptor, with the extensions known to the resolver decoded as extension
+// fields instead of unknown fields, e.g., the cosmos.msg.v1.signer option of a message.
+func (r *CustomResolver) Options(desc protoreflect.Descriptor) (proto.Message, error) {
+	options := desc.Options()
+	b, err := proto.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal options of %s: %w", desc.FullName(), err)
+	}
+
+	resolved := options.ProtoReflect().New().Interface()
+	if err := (proto.UnmarshalOptions{Resolver: r}).Unmarshal(b, resolved); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal options of %s: %w", desc.FullName(), err)
+	}
+	return resolved, nil
+}
+
+// Option returns the value of an option of the descriptor, given the name of its extension, and whether it is set.
+// The extension is not fetched: a file setting an option imports the file declaring its extension, so that the
+// extension is registered with the descriptor. An option whose extension is not registered is not set.
+func (r *CustomResolver) Option(desc protoreflect.Descriptor, name protoreflect.FullName) (protoreflect.Value, bool, error) {
+	r.mu.RLock()
+	xt, err := r.types.FindExtensionByName(name)
+	r.mu.RUnlock()
+	if errors.Is(err, protoregistry.NotFound) {
+		return protoreflect.Value{}, false, nil
+	}
+	if err != nil {
+		return protoreflect.Value{}, false, err
+	}
+
+	options, err := r.Options(desc)
+	if err != nil {
+		return protoreflect.Value{}, false, err
+	}
+	// Unlike proto.HasExtension, the containing messages are compared by name, as the options are the generated
+	// messages while the extensions extend the fetched descriptors
+	m := options.ProtoReflect()
+	if !m.Has(xt.TypeDescriptor()) {
+		return protoreflect.Value{}, false, nil
+	}
+	return m.Get(xt.TypeDescriptor()), true, nil
+}
@@ -0,0 +1,90 @@
+package reflection_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/retry"
+	"github.com/manifest-network/yaci/internal/testutil"
+)
+
+func newMsgResolver(t *testing.T) *reflection.CustomResolver {
+	files, err := reflection.BuildFileDescriptorSet(testutil.MockMsgFileDescriptorSet.GetFile())
+	require.NoError(t, err)
+	return reflection.NewCustomResolver(context.Background(), files, nil, retry.DefaultPolicy(), 3, nil)
+}
+
+func TestCustomResolverFindExtension(t *testing.T) {
+	resolver := newMsgResolver(t)
+
+	xt, err := resolver.FindExtensionByName(testutil.SignerExtensionName)
+	require.NoError(t, err)
+	assert.Equal(t, protoreflect.FullName("google.protobuf.MessageOptions"), xt.TypeDescriptor().ContainingMessage().FullName())
+
+	xt, err = resolver.FindExtensionByNumber("google.protobuf.MessageOptions", testutil.SignerExtensionNumber)
+	require.NoError(t, err)
+	assert.Equal(t, protoreflect.FullName(testutil.SignerExtensionName), xt.TypeDescriptor().FullName())
+
+	_, err = resolver.FindExtensionByNumber("google.protobuf.MessageOptions", 1)
+	assert.ErrorIs(t, err, protoregistry.NotFound)
+}
+
+func TestCustomResolverOption(t *testing.T) {
+	resolver := newMsgResolver(t)
+
+	signers := func(name protoreflect.FullName) []string {
+		t.Helper()
+		msgType, err := resolver.FindMessageByName(name)
+		require.NoError(t, err)
+		value, ok, err := resolver.Option(msgType.Descriptor(), testutil.SignerExtensionName)
+		require.NoError(t, err)
+		if !ok {
+			return nil
+		}
+		var fields []string
+		for i := 0; i < value.List().Len(); i++ {
+			fields = append(fields, value.List().Get(i).String())
+		}
+		return fields
+	}
+
+	assert.Equal(t, []string{"from_address"}, signers(testutil.MsgSendName))
+	assert.Equal(t, []string{"inputs"}, signers(testutil.MsgMultiSendName))
+	assert.Nil(t, signers(testutil.MsgNoSignerName))
+
+	// An unknown extension is not set
+	msgType, err := resolver.FindMessageByName(testutil.MsgSendName)
+	require.NoError(t, err)
+	_, ok, err := resolver.Option(msgType.Descriptor(), "amino.name")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCustomResolverSignerFields(t *testing.T) {
+	resolver := newMsgResolver(t)
+
+	signerFields := func(name protoreflect.FullName) []protoreflect.Name {
+		t.Helper()
+		msgType, err := resolver.FindMessageByName(name)
+		require.NoError(t, err)
+		fields, err := resolver.SignerFields(msgType.Descriptor())
+		require.NoError(t, err)
+		var names []protoreflect.Name
+		for _, fd := range fields {
+			names = append(names, fd.Name())
+		}
+		return names
+	}
+
+	assert.Equal(t, []protoreflect.Name{"from_address"}, signerFields(testutil.MsgSendName))
+	assert.Equal(t, []protoreflect.Name{"inputs"}, signerFields(testutil.MsgMultiSendName))
+	assert.Nil(t, signerFields(testutil.MsgNoSignerName))
+	// Cached
+	assert.Equal(t, []protoreflect.Name{"from_address"}, signerFields(testutil.MsgSendName))
+}
@@ -3,110 +3,200 @@ package reflection
 import (
 	"context"
 	"fmt"
-	"time"
+	"sync"
 
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
-	reflection "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	reflection "google.golang.org/grpc/reflection/grpc_reflection_v1"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/manifest-network/yaci/internal/retry"
 )
 
 // FetchAllDescriptors retrieves all file descriptors supported by the server.
-func FetchAllDescriptors(ctx context.Context, grpcClient *grpc.ClientConn, maxRetries uint) ([]*descriptorpb.FileDescriptorProto, error) {
-	seenFiles := make(map[string]*descriptorpb.FileDescriptorProto)
+func FetchAllDescriptors(ctx context.Context, grpcClient grpc.ClientConnInterface, policy retry.Policy, maxRetries uint) ([]*descriptorpb.FileDescriptorProto, error) {
+	return FetchDescriptors(ctx, grpcClient, nil, policy, maxRetries)
+}
+
+// FetchDescriptors retrieves the file descriptors supported by the server, in addition to the known descriptors.
+// Only the services missing from the known descriptors and their dependencies are fetched, concurrently over a pool
+// of reflection streams. The known descriptors are returned as well.
+func FetchDescriptors(ctx context.Context, conn grpc.ClientConnInterface, known []*descriptorpb.FileDescriptorProto, policy retry.Policy, maxRetries uint) ([]*descriptorpb.FileDescriptorProto, error) {
+	grpcClient := newReflectionClient(ctx, conn)
+	defer grpcClient.close()
+
+	knownServices := make(map[string]bool)
+	for _, fd := range known {
+		for _, service := range fd.GetService() {
+			knownServices[qualifiedName(fd.GetPackage(), service.GetName())] = true
+		}
+	}
 
 	// List all services
-	services, err := listServices(ctx, grpcClient, maxRetries)
+	services, err := listServices(ctx, grpcClient, policy, maxRetries)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list services: %w", err)
 	}
 
 	// For each service, fetch its file descriptors
+	fetcher := newDescriptorFetcher(ctx, grpcClient, known, policy, maxRetries)
 	for _, service := range services {
-		err := fetchFileDescriptors(ctx, grpcClient, service, seenFiles, maxRetries)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch file descriptors for service %s: %w", service, err)
+		if !knownServices[service] {
+			fetcher.fetchSymbol(service)
 		}
 	}
+	return fetcher.wait()
+}
 
-	// Collect all descriptors
-	result := make([]*descriptorpb.FileDescriptorProto, 0, len(seenFiles))
-	for _, fd := range seenFiles {
-		result = append(result, fd)
-	}
+// descriptorFetcher fetches file descriptors and their dependencies concurrently.
+type descriptorFetcher struct {
+	ctx        context.Context
+	grpcClient *reflectionClient
+	policy     retry.Policy
+	maxRetries uint
+	group      *errgroup.Group
+
+	mu sync.Mutex
+	// files holds the received file descriptors by name
+	files map[string]*descriptorpb.FileDescriptorProto
+	// requested holds the names of the files requested by name
+	requested map[string]bool
+}
 
-	return result, nil
+func newDescriptorFetcher(ctx context.Context, grpcClient *reflectionClient, known []*descriptorpb.FileDescriptorProto, policy retry.Policy, maxRetries uint) *descriptorFetcher {
+	// The concurrency is bounded by the reflection client, the group is not limited so that the fetches may start
+	// the fetches of their dependencies without blocking
+	group, ctx := errgroup.WithContext(ctx)
+	f := &descriptorFetcher{
+		ctx:        ctx,
+		grpcClient: grpcClient,
+		policy:     policy,
+		maxRetries: maxRetries,
+		group:      group,
+		files:      make(map[string]*descriptorpb.FileDescriptorProto, len(known)),
+		requested:  make(map[string]bool),
+	}
+	for _, fd := range known {
+		f.files[fd.GetName()] = fd
+	}
+	return f
 }
 
-// listServices lists all services provided by the server via reflection.
-func listServices(ctx context.Context, grpcClient *grpc.ClientConn, maxRetries uint) ([]string, error) {
+// fetchSymbol starts fetching the file descriptors containing the given symbol and their dependencies.
+func (f *descriptorFetcher) fetchSymbol(symbol string) {
 	req := &reflection.ServerReflectionRequest{
-		MessageRequest: &reflection.ServerReflectionRequest_ListServices{
-			ListServices: "*",
+		MessageRequest: &reflection.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: symbol,
 		},
 	}
+	f.fetch(req, func(err error) error {
+		return fmt.Errorf("failed to fetch file descriptors for service %s: %w", symbol, err)
+	})
+}
 
-	resp, err := sendReflectionRequestWithRetry(ctx, grpcClient, req, maxRetries)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list services via reflection: %w", err)
-	}
-
-	listServicesResp, ok := resp.MessageResponse.(*reflection.ServerReflectionResponse_ListServicesResponse)
-	if !ok {
-		return nil, fmt.Errorf("unexpected response type: %T", resp.MessageResponse)
-	}
-
-	services := make([]string, 0, len(listServicesResp.ListServicesResponse.Service))
-	for _, service := range listServicesResp.ListServicesResponse.Service {
-		services = append(services, service.Name)
+// fetchFile starts fetching the file descriptor by filename and its dependencies.
+func (f *descriptorFetcher) fetchFile(name string) {
+	req := &reflection.ServerReflectionRequest{
+		MessageRequest: &reflection.ServerReflectionRequest_FileByFilename{
+			FileByFilename: name,
+		},
 	}
-
-	return services, nil
+	f.fetch(req, func(err error) error {
+		return fmt.Errorf("failed to fetch dependency %s: %w", name, err)
+	})
 }
 
-// fetchFileDescriptors fetches the file descriptors containing the given symbol and their dependencies.
-func fetchFileDescriptors(ctx context.Context, grpcClient *grpc.ClientConn, symbol string, seen map[string]*descriptorpb.FileDescriptorProto, maxRetries uint) error {
-	if _, exists := seen[symbol]; exists {
+func (f *descriptorFetcher) fetch(req *reflection.ServerReflectionRequest, wrap func(error) error) {
+	f.group.Go(func() error {
+		fdProtos, err := fetchFileDescriptorsFromRequest(f.ctx, f.grpcClient, req, f.policy, f.maxRetries)
+		if err != nil {
+			return wrap(err)
+		}
+		for _, dep := range f.add(fdProtos) {
+			f.fetchFile(dep)
+		}
 		return nil
+	})
+}
+
+// add adds the received file descriptors, and returns their dependencies to fetch.
+// The dependencies already sent on a reflection stream are not sent again on the same stream, so they are only
+// known from the earlier responses, or fetched by name otherwise.
+func (f *descriptorFetcher) add(fdProtos []*descriptorpb.FileDescriptorProto) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var added []*descriptorpb.FileDescriptorProto
+	for _, fdProto := range fdProtos {
+		if _, exists := f.files[fdProto.GetName()]; !exists {
+			f.files[fdProto.GetName()] = fdProto
+			added = append(added, fdProto)
+		}
 	}
 
-	req := &reflection.ServerReflectionRequest{
-		MessageRequest: &reflection.ServerReflectionRequest_FileContainingSymbol{
-			FileContainingSymbol: symbol,
-		},
+	var missing []string
+	for _, fdProto := range added {
+		for _, dep := range fdProto.GetDependency() {
+			if _, exists := f.files[dep]; !exists && !f.requested[dep] {
+				f.requested[dep] = true
+				missing = append(missing, dep)
+			}
+		}
 	}
+	return missing
+}
 
-	fdProtos, err := fetchFileDescriptorsFromRequest(ctx, grpcClient, req, maxRetries)
-	if err != nil {
-		return fmt.Errorf("failed to fetch file descriptors containing symbol %s: %w", symbol, err)
+// wait waits for the fetches, and returns all the file descriptors.
+func (f *descriptorFetcher) wait() ([]*descriptorpb.FileDescriptorProto, error) {
+	if err := f.group.Wait(); err != nil {
+		return nil, err
 	}
 
-	return processFileDescriptors(ctx, grpcClient, fdProtos, seen, maxRetries)
+	result := make([]*descriptorpb.FileDescriptorProto, 0, len(f.files))
+	for _, fd := range f.files {
+		result = append(result, fd)
+	}
+	return result, nil
 }
 
-// fetchFileByName fetches the file descriptor by filename and its dependencies.
-func fetchFileByName(ctx context.Context, grpcClient *grpc.ClientConn, name string, seen map[string]*descriptorpb.FileDescriptorProto, maxRetries uint) error {
-	if _, exists := seen[name]; exists {
-		return nil
+// qualifiedName returns the full name of a symbol declared in a package.
+func qualifiedName(pkg, name string) string {
+	if pkg == "" {
+		return name
 	}
+	return pkg + "." + name
+}
 
+// listServices lists all services provided by the server via reflection.
+func listServices(ctx context.Context, grpcClient *reflectionClient, policy retry.Policy, maxRetries uint) ([]string, error) {
 	req := &reflection.ServerReflectionRequest{
-		MessageRequest: &reflection.ServerReflectionRequest_FileByFilename{
-			FileByFilename: name,
+		MessageRequest: &reflection.ServerReflectionRequest_ListServices{
+			ListServices: "*",
 		},
 	}
 
-	fdProtos, err := fetchFileDescriptorsFromRequest(ctx, grpcClient, req, maxRetries)
+	resp, err := sendReflectionRequestWithRetry(ctx, grpcClient, req, policy, maxRetries)
 	if err != nil {
-		return fmt.Errorf("failed to fetch file descriptors for file %s: %w", name, err)
+		return nil, fmt.Errorf("failed to list services via reflection: %w", err)
+	}
+
+	listServicesResp, ok := resp.MessageResponse.(*reflection.ServerReflectionResponse_ListServicesResponse)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response type: %T", resp.MessageResponse)
 	}
 
-	return processFileDescriptors(ctx, grpcClient, fdProtos, seen, maxRetries)
+	services := make([]string, 0, len(listServicesResp.ListServicesResponse.Service))
+	for _, service := range listServicesResp.ListServicesResponse.Service {
+		services = append(services, service.Name)
+	}
+
+	return services, nil
 }
 
 // fetchFileDescriptorsFromRequest sends a reflection request and returns the file descriptors.
-func fetchFileDescriptorsFromRequest(ctx context.Context, grpcClient *grpc.ClientConn, req *reflection.ServerReflectionRequest, maxRetries uint) ([]*descriptorpb.FileDescriptorProto, error) {
-	resp, err := sendReflectionRequestWithRetry(ctx, grpcClient, req, maxRetries)
+func fetchFileDescriptorsFromRequest(ctx context.Context, grpcClient *reflectionClient, req *reflection.ServerReflectionRequest, policy retry.Policy, maxRetries uint) ([]*descriptorpb.FileDescriptorProto, error) {
+	resp, err := sendReflectionRequestWithRetry(ctx, grpcClient, req, policy, maxRetries)
 	if err != nil {
 		return nil, err
 	}
@@ -128,63 +218,13 @@ func fetchFileDescriptorsFromRequest(ctx context.Context, grpcClient *grpc.Clien
 	return fdProtos, nil
 }
 
-// processFileDescriptors processes the fetched file descriptors and recursively fetches their dependencies.
-func processFileDescriptors(ctx context.Context, grpcClient *grpc.ClientConn, fdProtos []*descriptorpb.FileDescriptorProto, seen map[string]*descriptorpb.FileDescriptorProto, maxRetries uint) error {
-	for _, fdProto := range fdProtos {
-		name := fdProto.GetName()
-		if _, exists := seen[name]; exists {
-			continue
-		}
-		seen[name] = fdProto
-
-		// Recursively fetch dependencies
-		for _, dep := range fdProto.Dependency {
-			if _, exists := seen[dep]; !exists {
-				err := fetchFileByName(ctx, grpcClient, dep, seen, maxRetries)
-				if err != nil {
-					return fmt.Errorf("failed to fetch dependency %s: %w", dep, err)
-				}
-			}
-		}
-	}
-	return nil
-}
-
-func sendReflectionRequestWithRetry(ctx context.Context, grpcClient *grpc.ClientConn, req *reflection.ServerReflectionRequest, maxRetries uint) (*reflection.ServerReflectionResponse, error) {
-	var resp *reflection.ServerReflectionResponse
-	var err error
-	for attempt := uint(1); attempt <= maxRetries; attempt++ {
-		resp, err = sendReflectionRequest(ctx, grpcClient, req)
-		if err == nil {
-			return resp, nil
-		}
-		time.Sleep(time.Duration(2*attempt) * time.Second)
-	}
-	return nil, fmt.Errorf("failed to send reflection request after %d attempts: %w", maxRetries, err)
-}
-
-// sendReflectionRequest sends a reflection request and returns the response.
-func sendReflectionRequest(ctx context.Context, grpcClient *grpc.ClientConn, req *reflection.ServerReflectionRequest) (*reflection.ServerReflectionResponse, error) {
-	refClient := reflection.NewServerReflectionClient(grpcClient)
-	stream, err := refClient.ServerReflectionInfo(ctx)
+func sendReflectionRequestWithRetry(ctx context.Context, grpcClient *reflectionClient, req *reflection.ServerReflectionRequest, policy retry.Policy, maxRetries uint) (*reflection.ServerReflectionResponse, error) {
+	resp, err := retry.Do(ctx, policy, maxRetries, func() (*reflection.ServerReflectionResponse, error) {
+		return grpcClient.send(ctx, req)
+	}, "method", "ServerReflectionInfo")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create reflection stream: %w", err)
-	}
-	defer stream.CloseSend()
-
-	if err := stream.Send(req); err != nil {
 		return nil, fmt.Errorf("failed to send reflection request: %w", err)
 	}
-
-	resp, err := stream.Recv()
-	if err != nil {
-		return nil, fmt.Errorf("failed to receive reflection response: %w", err)
-	}
-
-	if err := checkErrorResponse(resp); err != nil {
-		return nil, err
-	}
-
 	return resp, nil
 }
 
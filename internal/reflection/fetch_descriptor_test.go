@@ -2,23 +2,81 @@ package reflection_test
 
 import (
 	"context"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/retry"
 	"github.com/manifest-network/yaci/internal/testutil"
 )
 
 func TestFetchAllDescriptors(t *testing.T) {
+	dialers := map[string]func(context.Context, string) (net.Conn, error){
+		"v1 and v1alpha": testutil.MockDialer,
+		"v1":             testutil.MockV1Dialer,
+		"v1alpha":        testutil.MockV1AlphaDialer,
+	}
+	for name, dialer := range dialers {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			conn, err := grpc.DialContext(ctx, "", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			descriptors, err := reflection.FetchAllDescriptors(ctx, conn, retry.DefaultPolicy(), 3)
+			assert.NoError(t, err)
+			assert.Len(t, descriptors, 2)
+		})
+	}
+}
+
+func TestCustomResolverReflectionVersions(t *testing.T) {
+	dialers := map[string]func(context.Context, string) (net.Conn, error){
+		"v1":      testutil.MockV1Dialer,
+		"v1alpha": testutil.MockV1AlphaDialer,
+	}
+	for name, dialer := range dialers {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			conn, err := grpc.DialContext(ctx, "", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			// The unknown message is fetched using reflection, with its dependencies
+			resolver := reflection.NewCustomResolver(ctx, &protoregistry.Files{}, conn, retry.DefaultPolicy(), 3, nil)
+			messageType, err := resolver.FindMessageByName(testutil.TestInputName)
+			assert.NoError(t, err)
+			if assert.NotNil(t, messageType) {
+				assert.Equal(t, protoreflect.FullName(testutil.TestInputName), messageType.Descriptor().FullName())
+			}
+		})
+	}
+}
+
+func TestFetchDescriptorsKnown(t *testing.T) {
 	ctx := context.Background()
 	conn, err := grpc.DialContext(ctx, "", grpc.WithContextDialer(testutil.MockDialer), grpc.WithInsecure())
 	assert.NoError(t, err)
 	defer conn.Close()
 
-	descriptors, err := reflection.FetchAllDescriptors(ctx, conn, 3)
+	// The known service is not fetched again
+	known := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("cached.proto"),
+		Service: []*descriptorpb.ServiceDescriptorProto{{Name: proto.String(testutil.TestServiceName)}},
+	}
+	descriptors, err := reflection.FetchDescriptors(ctx, conn, []*descriptorpb.FileDescriptorProto{known}, retry.DefaultPolicy(), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []*descriptorpb.FileDescriptorProto{known}, descriptors)
+
+	// The missing services are fetched
+	descriptors, err = reflection.FetchDescriptors(ctx, conn, []*descriptorpb.FileDescriptorProto{testutil.MockDependencyFileDescriptor}, retry.DefaultPolicy(), 3)
 	assert.NoError(t, err)
-	assert.NotNil(t, descriptors)
-	assert.NotEmpty(t, descriptors)
+	assert.Len(t, descriptors, 2)
 }
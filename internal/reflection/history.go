@@ -0,0 +1,121 @@
+package reflection
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// ResolverHistory holds the resolvers of the successive schemas of a chain, by the height from which they apply,
+// so that the blocks produced before a chain upgrade keep decoding with the schema active at the time.
+// It is safe for concurrent use.
+type ResolverHistory struct {
+	mu      sync.RWMutex
+	entries []historyEntry
+}
+
+type historyEntry struct {
+	fromHeight uint64
+	resolver   *CustomResolver
+}
+
+// NewResolverHistory returns a history starting with the resolver, applying to all heights.
+func NewResolverHistory(resolver *CustomResolver) *ResolverHistory {
+	return &ResolverHistory{entries: []historyEntry{{fromHeight: 0, resolver: resolver}}}
+}
+
+// Add adds the resolver of a new schema, applying from the given height.
+// It replaces the resolvers applying from the same or later heights.
+func (h *ResolverHistory) Add(fromHeight uint64, resolver *CustomResolver) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := sort.Search(len(h.entries), func(i int) bool { return h.entries[i].fromHeight >= fromHeight })
+	h.entries = append(h.entries[:i], historyEntry{fromHeight: fromHeight, resolver: resolver})
+}
+
+// At returns the resolver of the schema active at the given height, or the latest resolver if the height is 0.
+func (h *ResolverHistory) At(height uint64) *CustomResolver {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if height == 0 {
+		return h.entries[len(h.entries)-1].resolver
+	}
+	i := sort.Search(len(h.entries), func(i int) bool { return h.entries[i].fromHeight > height })
+	return h.entries[max(i-1, 0)].resolver
+}
+
+// Latest returns the resolver of the latest schema.
+func (h *ResolverHistory) Latest() *CustomResolver {
+	return h.At(0)
+}
+
+// SchemaBoundary is the height from which a schema of a chain applies, and the application version serving it.
+type SchemaBoundary struct {
+	FromHeight uint64 `json:"from_height"`
+	AppVersion string `json:"app_version"`
+}
+
+// SchemaHistoryFile persists the boundaries of the successive schemas of a chain next to the descriptor cache files,
+// so that the resolvers of the previous schemas are rebuilt from their cache files on restart.
+// It is safe for concurrent use.
+type SchemaHistoryFile struct {
+	path string
+
+	mu         sync.Mutex
+	boundaries []SchemaBoundary
+}
+
+// NewSchemaHistoryFile returns the schema history of the nodes with the given endpoints and chain ID,
+// stored in the given directory.
+func NewSchemaHistoryFile(dir string, endpoints []string, chainID string) *SchemaHistoryFile {
+	return &SchemaHistoryFile{path: filepath.Join(dir, cacheFileName(endpoints, chainID)+".history.json")}
+}
+
+// Path returns the path of the history file.
+func (f *SchemaHistoryFile) Path() string {
+	return f.path
+}
+
+// Load reads the schema boundaries, sorted by height. It returns no boundary if the history file does not exist yet.
+func (f *SchemaHistoryFile) Load() ([]SchemaBoundary, error) {
+	content, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema history: %w", err)
+	}
+
+	var boundaries []SchemaBoundary
+	if err := json.Unmarshal(content, &boundaries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schema history: %w", err)
+	}
+	sort.SliceStable(boundaries, func(i, j int) bool { return boundaries[i].FromHeight < boundaries[j].FromHeight })
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.boundaries = boundaries
+	return slices.Clone(boundaries), nil
+}
+
+// Add adds the boundary of a new schema and writes the history file.
+// Like ResolverHistory.Add, it replaces the boundaries from the same or later heights.
+func (f *SchemaHistoryFile) Add(boundary SchemaBoundary) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := sort.Search(len(f.boundaries), func(i int) bool { return f.boundaries[i].FromHeight >= boundary.FromHeight })
+	f.boundaries = append(f.boundaries[:i], boundary)
+
+	content, err := json.MarshalIndent(f.boundaries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema history: %w", err)
+	}
+	return writeFileAtomically(f.path, content)
+}
@@ -0,0 +1,75 @@
+package reflection_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/retry"
+)
+
+func TestResolverHistory(t *testing.T) {
+	newResolver := func() *reflection.CustomResolver {
+		return reflection.NewCustomResolver(context.Background(), &protoregistry.Files{}, nil, retry.Policy{}, 1, nil)
+	}
+	v1, v2, v3 := newResolver(), newResolver(), newResolver()
+
+	history := reflection.NewResolverHistory(v1)
+	assert.Same(t, v1, history.At(1))
+	assert.Same(t, v1, history.Latest())
+
+	history.Add(100, v2)
+	assert.Same(t, v1, history.At(99))
+	assert.Same(t, v2, history.At(100))
+	assert.Same(t, v2, history.At(1000))
+	assert.Same(t, v2, history.Latest())
+
+	history.Add(200, v3)
+	assert.Same(t, v2, history.At(199))
+	assert.Same(t, v3, history.At(200))
+
+	// A resolver added at an earlier height replaces the later ones
+	history.Add(150, v1)
+	assert.Same(t, v2, history.At(149))
+	assert.Same(t, v1, history.At(150))
+	assert.Same(t, v1, history.At(300))
+}
+
+func TestSchemaHistoryFile(t *testing.T) {
+	dir := t.TempDir()
+	endpoints := []string{"node-1:9090", "node-2:9090"}
+
+	history := reflection.NewSchemaHistoryFile(dir, endpoints, "manifest-1")
+	boundaries, err := history.Load()
+	require.NoError(t, err)
+	assert.Empty(t, boundaries)
+
+	require.NoError(t, history.Add(reflection.SchemaBoundary{FromHeight: 0, AppVersion: "v1.0.0"}))
+	require.NoError(t, history.Add(reflection.SchemaBoundary{FromHeight: 100, AppVersion: "v2.0.0"}))
+	require.NoError(t, history.Add(reflection.SchemaBoundary{FromHeight: 200, AppVersion: "v3.0.0"}))
+	// A boundary added at an earlier height replaces the later ones
+	require.NoError(t, history.Add(reflection.SchemaBoundary{FromHeight: 150, AppVersion: "v2.1.0"}))
+
+	// The file is shared by the endpoints in any order, and reloaded on restart
+	reloaded := reflection.NewSchemaHistoryFile(dir, []string{"node-2:9090", "node-1:9090"}, "manifest-1")
+	assert.Equal(t, history.Path(), reloaded.Path())
+	boundaries, err = reloaded.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []reflection.SchemaBoundary{
+		{FromHeight: 0, AppVersion: "v1.0.0"},
+		{FromHeight: 100, AppVersion: "v2.0.0"},
+		{FromHeight: 150, AppVersion: "v2.1.0"},
+	}, boundaries)
+
+	// Another chain has its own history
+	assert.NotEqual(t, history.Path(), reflection.NewSchemaHistoryFile(dir, endpoints, "manifest-2").Path())
+
+	require.NoError(t, os.WriteFile(history.Path(), []byte("not json"), 0o600))
+	_, err = history.Load()
+	assert.ErrorContains(t, err, "failed to unmarshal schema history")
+}
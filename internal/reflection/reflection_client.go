@@ -0,0 +1,171 @@
+package reflection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	reflection "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+)
+
+// The gRPC reflection services. Their messages are wire-compatible, so the v1 messages are sent to both.
+const (
+	reflectionV1Method      = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+	reflectionV1AlphaMethod = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+)
+
+// maxReflectionStreams is the maximum number of reflection streams opened by a client, i.e., of concurrent requests.
+const maxReflectionStreams = 4
+
+var reflectionStreamDesc = &grpc.StreamDesc{
+	StreamName:    "ServerReflectionInfo",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// errStreamAborted is returned when the context of a request is done while it waits for its response.
+var errStreamAborted = errors.New("reflection request aborted")
+
+// reflectionClient sends reflection requests over a small pool of long-lived reflection streams, instead of opening
+// a stream per request. It uses gRPC reflection v1, falling back to v1alpha for the servers not serving v1.
+// It is safe for concurrent use.
+type reflectionClient struct {
+	conn grpc.ClientConnInterface
+	// ctx is the context of the streams, outliving the requests
+	ctx    context.Context
+	cancel context.CancelFunc
+	// v1alpha is set once the server is known not to serve v1
+	v1alpha atomic.Bool
+	// slots bounds the number of streams in use
+	slots chan struct{}
+
+	mu   sync.Mutex
+	idle []*reflectionStream
+}
+
+// reflectionStream is a reflection stream used by one request at a time. Reflection servers answer the requests
+// of a stream in order, so that a response always answers the last request sent.
+type reflectionStream struct {
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+	method string
+}
+
+// newReflectionClient returns a client whose streams are closed when the context is done, or when closed.
+func newReflectionClient(ctx context.Context, conn grpc.ClientConnInterface) *reflectionClient {
+	ctx, cancel := context.WithCancel(ctx)
+	return &reflectionClient{
+		conn:   conn,
+		ctx:    ctx,
+		cancel: cancel,
+		slots:  make(chan struct{}, maxReflectionStreams),
+	}
+}
+
+// close closes the streams of the client.
+func (c *reflectionClient) close() {
+	c.cancel()
+}
+
+// send sends a reflection request on an idle stream, or on a new stream if none is idle, and returns the response.
+func (c *reflectionClient) send(ctx context.Context, req *reflection.ServerReflectionRequest) (*reflection.ServerReflectionResponse, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.slots }()
+
+	for {
+		stream, err := c.stream()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := stream.roundTrip(ctx, req)
+		if err == nil {
+			c.release(stream)
+			return resp, checkErrorResponse(resp)
+		}
+		stream.cancel()
+
+		if stream.method == reflectionV1Method && status.Code(err) == codes.Unimplemented {
+			slog.Debug("gRPC reflection v1 not served, falling back to v1alpha", "error", err)
+			c.v1alpha.Store(true)
+			continue
+		}
+		return nil, err
+	}
+}
+
+// stream returns an idle stream, or opens a new one.
+func (c *reflectionClient) stream() (*reflectionStream, error) {
+	method := reflectionV1Method
+	if c.v1alpha.Load() {
+		method = reflectionV1AlphaMethod
+	}
+
+	c.mu.Lock()
+	for len(c.idle) > 0 {
+		stream := c.idle[len(c.idle)-1]
+		c.idle = c.idle[:len(c.idle)-1]
+		if stream.method == method {
+			c.mu.Unlock()
+			return stream, nil
+		}
+		stream.cancel()
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	stream, err := c.conn.NewStream(ctx, reflectionStreamDesc, method)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create reflection stream: %w", err)
+	}
+	return &reflectionStream{stream: stream, cancel: cancel, method: method}, nil
+}
+
+// release returns the stream to the idle streams.
+func (c *reflectionClient) release(stream *reflectionStream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.idle = append(c.idle, stream)
+}
+
+// roundTrip sends a request and receives its response. The stream is aborted if the context is done first,
+// and must not be reused after an error.
+func (s *reflectionStream) roundTrip(ctx context.Context, req *reflection.ServerReflectionRequest) (*reflection.ServerReflectionResponse, error) {
+	stop := context.AfterFunc(ctx, s.cancel)
+	resp, err := s.exchange(req)
+	if !stop() {
+		if err == nil {
+			err = errStreamAborted
+		}
+		return nil, errors.Join(ctx.Err(), err)
+	}
+	return resp, err
+}
+
+func (s *reflectionStream) exchange(req *reflection.ServerReflectionRequest) (*reflection.ServerReflectionResponse, error) {
+	if err := s.stream.SendMsg(req); err != nil {
+		if errors.Is(err, io.EOF) {
+			// The server closed the stream, its status is returned by RecvMsg
+			err = s.stream.RecvMsg(&reflection.ServerReflectionResponse{})
+		}
+		return nil, fmt.Errorf("failed to send reflection request: %w", err)
+	}
+
+	resp := &reflection.ServerReflectionResponse{}
+	if err := s.stream.RecvMsg(resp); err != nil {
+		return nil, fmt.Errorf("failed to receive reflection response: %w", err)
+	}
+	return resp, nil
+}
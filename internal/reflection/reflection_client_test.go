@@ -0,0 +1,80 @@
+package reflection_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	testgrpc "google.golang.org/grpc/interop/grpc_testing"
+	grpcreflection "google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/retry"
+)
+
+// startReflectionServer starts a server using the gRPC reflection service of grpc-go, serving services with
+// shared dependencies, and returns a connection to it with the number of streams opened.
+func startReflectionServer(t *testing.T) (*grpc.ClientConn, *atomic.Int32) {
+	streams := &atomic.Int32{}
+	s := grpc.NewServer(grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		streams.Add(1)
+		return handler(srv, ss)
+	}))
+	testgrpc.RegisterTestServiceServer(s, testgrpc.UnimplementedTestServiceServer{})
+	testgrpc.RegisterBenchmarkServiceServer(s, testgrpc.UnimplementedBenchmarkServiceServer{})
+	testgrpc.RegisterWorkerServiceServer(s, testgrpc.UnimplementedWorkerServiceServer{})
+	testgrpc.RegisterReconnectServiceServer(s, testgrpc.UnimplementedReconnectServiceServer{})
+	testgrpc.RegisterLoadBalancerStatsServiceServer(s, testgrpc.UnimplementedLoadBalancerStatsServiceServer{})
+	grpcreflection.Register(s)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, streams
+}
+
+func TestFetchAllDescriptorsStreamReuse(t *testing.T) {
+	conn, streams := startReflectionServer(t)
+
+	descriptors, err := reflection.FetchAllDescriptors(context.Background(), conn, retry.DefaultPolicy(), 3)
+	require.NoError(t, err)
+
+	// The dependencies omitted by the server on reused streams are fetched, so that the descriptors are complete
+	files, err := reflection.BuildFileDescriptorSet(descriptors)
+	require.NoError(t, err)
+	for _, name := range []string{"grpc.testing.TestService", "grpc.testing.WorkerService", "grpc.testing.Empty", "grpc.testing.ClientConfig"} {
+		_, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		assert.NoError(t, err, name)
+	}
+
+	// The requests share a few streams, instead of opening one stream per request
+	assert.LessOrEqual(t, streams.Load(), int32(4))
+}
+
+func TestCustomResolverStreamReuse(t *testing.T) {
+	conn, streams := startReflectionServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resolver := reflection.NewCustomResolver(ctx, &protoregistry.Files{}, conn, retry.DefaultPolicy(), 3, nil)
+	for _, name := range []string{"grpc.testing.SimpleRequest", "grpc.testing.ClientArgs", "grpc.testing.ReconnectInfo"} {
+		messageType, err := resolver.FindMessageByName(protoreflect.FullName(name))
+		require.NoError(t, err, name)
+		assert.Equal(t, protoreflect.FullName(name), messageType.Descriptor().FullName())
+	}
+	assert.Equal(t, int32(1), streams.Load())
+}
@@ -3,37 +3,60 @@ package reflection
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"sync"
 
 	"google.golang.org/grpc"
-	reflection "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	reflection "google.golang.org/grpc/reflection/grpc_reflection_v1"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/manifest-network/yaci/internal/retry"
 )
 
 // CustomResolver implements the Resolver interface required by protojson.
 // It fetches file descriptors from a gRPC server using the reflection API and registers them in a protoregistry.Files.
-// It also correctly resolves message types by fetching dependencies recursively.
+// It also correctly resolves message types by fetching dependencies recursively, and the extensions declared by the
+// registered files, e.g., the cosmos_proto, amino and gogoproto options.
 type CustomResolver struct {
-	files       *protoregistry.Files
-	grpcConn    *grpc.ClientConn
+	files *protoregistry.Files
+	// types holds the extension types of the registered files
+	types       *protoregistry.Types
+	grpcClient  *reflectionClient
 	ctx         context.Context
 	seenSymbols map[string]bool
+	policy      retry.Policy
 	maxRetries  uint
-	mu          sync.RWMutex
+	// signerFields caches the signer fields of the messages, see SignerFields
+	signerFields map[protoreflect.FullName][]protoreflect.FieldDescriptor
+	// cache persists the descriptors fetched while resolving, if not nil
+	cache *DescriptorCache
+	mu    sync.RWMutex
 }
 
 // NewCustomResolver creates a new instance of CustomResolver.
-func NewCustomResolver(ctx context.Context, files *protoregistry.Files, grpcConn *grpc.ClientConn, maxRetries uint) *CustomResolver {
+// The descriptors fetched while resolving are added to the cache, which may be nil.
+// Its reflection streams are kept open until the context is done.
+func NewCustomResolver(ctx context.Context, files *protoregistry.Files, grpcConn grpc.ClientConnInterface, policy retry.Policy, maxRetries uint, cache *DescriptorCache) *CustomResolver {
+	types := &protoregistry.Types{}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		registerExtensions(types, fd)
+		return true
+	})
+
 	return &CustomResolver{
-		files:       files, // Note: The protoregistry.Files type is safe for concurrent use by multiple goroutines, but it is not safe to concurrently mutate the registry while also being used.
-		grpcConn:    grpcConn,
-		ctx:         ctx,
-		seenSymbols: make(map[string]bool),
-		maxRetries:  maxRetries,
+		files:        files, // Note: The protoregistry.Files type is safe for concurrent use by multiple goroutines, but it is not safe to concurrently mutate the registry while also being used.
+		types:        types,
+		grpcClient:   newReflectionClient(ctx, grpcConn),
+		ctx:          ctx,
+		seenSymbols:  make(map[string]bool),
+		signerFields: make(map[protoreflect.FullName][]protoreflect.FieldDescriptor),
+		policy:       policy,
+		maxRetries:   maxRetries,
+		cache:        cache,
 	}
 }
 
@@ -114,14 +137,32 @@ func (r *CustomResolver) FindMessageByURL(url string) (protoreflect.MessageType,
 	return r.FindMessageByName(protoreflect.FullName(url[1:]))
 }
 
-// FindExtensionByName is not implemented.
-func (r *CustomResolver) FindExtensionByName(_ protoreflect.FullName) (protoreflect.ExtensionType, error) {
-	return nil, protoregistry.NotFound
+// FindExtensionByName finds an extension type by its name, fetching its descriptor via reflection if not registered.
+func (r *CustomResolver) FindExtensionByName(name protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	r.mu.RLock()
+	xt, err := r.types.FindExtensionByName(name)
+	r.mu.RUnlock()
+
+	if err == nil {
+		return xt, nil
+	}
+
+	if err := r.fetchDescriptorBySymbol(string(name)); err != nil {
+		return nil, fmt.Errorf("failed to fetch descriptor for symbol %s: %w", name, err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.types.FindExtensionByName(name)
 }
 
-// FindExtensionByNumber is not implemented.
-func (r *CustomResolver) FindExtensionByNumber(_ protoreflect.FullName, _ protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
-	return nil, protoregistry.NotFound
+// FindExtensionByNumber finds an extension type of a message by its field number, among the registered files.
+// Unlike FindExtensionByName, it does not fetch descriptors, as it is called for every unknown field when decoding
+// the extendable messages, e.g., the descriptor options.
+func (r *CustomResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.types.FindExtensionByNumber(message, field)
 }
 
 func (r *CustomResolver) fetchDescriptorBySymbol(symbol string) error {
@@ -144,12 +185,19 @@ func (r *CustomResolver) fetchDescriptorBySymbol(symbol string) error {
 		},
 	}
 
-	fdProtos, err := fetchFileDescriptorsFromRequest(r.ctx, r.grpcConn, req, r.maxRetries)
+	fdProtos, err := fetchFileDescriptorsFromRequest(r.ctx, r.grpcClient, req, r.policy, r.maxRetries)
+	if err == nil {
+		err = r.processFileDescriptors(fdProtos, r.maxRetries)
+	}
 	if err != nil {
+		// Forget the symbol, so that it is fetched again, e.g., once the node serves it after an upgrade
+		r.mu.Lock()
+		delete(r.seenSymbols, symbol)
+		r.mu.Unlock()
 		return fmt.Errorf("failed to fetch file descriptors containing symbol %s: %w", symbol, err)
 	}
 
-	return r.processFileDescriptors(fdProtos, r.maxRetries)
+	return nil
 }
 
 func (r *CustomResolver) fetchDescriptorByName(name string, maxRetries uint) error {
@@ -160,7 +208,7 @@ func (r *CustomResolver) fetchDescriptorByName(name string, maxRetries uint) err
 		},
 	}
 
-	fdProtos, err := fetchFileDescriptorsFromRequest(r.ctx, r.grpcConn, req, maxRetries)
+	fdProtos, err := fetchFileDescriptorsFromRequest(r.ctx, r.grpcClient, req, r.policy, maxRetries)
 	if err != nil {
 		return fmt.Errorf("failed to fetch file descriptors for file %s: %w", name, err)
 	}
@@ -223,6 +271,13 @@ func (r *CustomResolver) registerFileDescriptor(fdProto *descriptorpb.FileDescri
 	if err := r.files.RegisterFile(fd); err != nil {
 		return fmt.Errorf("failed to register file %s: %w", name, err)
 	}
+	registerExtensions(r.types, fd)
+
+	if r.cache != nil {
+		if err := r.cache.Add(fdProto); err != nil {
+			slog.Warn("Failed to cache file descriptor", "file", name, "error", err)
+		}
+	}
 
 	return nil
 }
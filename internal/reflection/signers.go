@@ -0,0 +1,46 @@
+package reflection
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// SignerOption is the message option of the Cosmos SDK listing the fields holding the signers of a message.
+const SignerOption protoreflect.FullName = "cosmos.msg.v1.signer"
+
+// SignerFields returns the fields holding the signers of a message, as listed by its cosmos.msg.v1.signer option,
+// or nil if the message has no signer option. A signer field is either a string holding the address of the signer,
+// or a message whose own signer fields hold the addresses, and may be repeated.
+func (r *CustomResolver) SignerFields(desc protoreflect.MessageDescriptor) ([]protoreflect.FieldDescriptor, error) {
+	r.mu.RLock()
+	fields, ok := r.signerFields[desc.FullName()]
+	r.mu.RUnlock()
+	if ok {
+		return fields, nil
+	}
+
+	value, ok, err := r.Option(desc, SignerOption)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		names := value.List()
+		for i := 0; i < names.Len(); i++ {
+			name := names.Get(i).String()
+			fd := desc.Fields().ByName(protoreflect.Name(name))
+			if fd == nil {
+				return nil, fmt.Errorf("signer field %s not found in message %s", name, desc.FullName())
+			}
+			if fd.Kind() != protoreflect.StringKind && fd.Kind() != protoreflect.MessageKind {
+				return nil, fmt.Errorf("unsupported kind %s of signer field %s of message %s", fd.Kind(), name, desc.FullName())
+			}
+			fields = append(fields, fd)
+		}
+	}
+
+	r.mu.Lock()
+	r.signerFields[desc.FullName()] = fields
+	r.mu.Unlock()
+	return fields, nil
+}
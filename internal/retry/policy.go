@@ -0,0 +1,180 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Action is what to do when a call fails.
+type Action string
+
+const (
+	// ActionRetry retries the call after a backoff delay.
+	ActionRetry Action = "retry"
+	// ActionFailFast returns the error without retrying, for errors that retrying cannot fix.
+	ActionFailFast Action = "fail-fast"
+)
+
+// Rule configures the retries of the calls failing with a given status code.
+type Rule struct {
+	Action Action
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+	// Multiplier is the factor applied to the delay after every retry.
+	Multiplier float64
+	// MaxDelay caps the delay between two attempts, before jitter.
+	MaxDelay time.Duration
+	// Jitter is the ratio of the delay randomly added or removed, to spread the retries of concurrent calls.
+	Jitter float64
+}
+
+// Delay returns the delay before the given retry, starting at 1, jitter included.
+func (r Rule) Delay(retry uint) time.Duration {
+	delay := float64(r.InitialDelay) * math.Pow(max(r.Multiplier, 1), float64(retry-1))
+	if r.MaxDelay > 0 {
+		delay = min(delay, float64(r.MaxDelay))
+	}
+	if r.Jitter > 0 {
+		delay *= 1 + r.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// Validate checks the values of the rule.
+func (r Rule) Validate() error {
+	if r.Action != ActionRetry && r.Action != ActionFailFast {
+		return fmt.Errorf("invalid action: %s, expected %s or %s", r.Action, ActionRetry, ActionFailFast)
+	}
+	if r.InitialDelay < 0 || r.MaxDelay < 0 {
+		return fmt.Errorf("delays must not be negative")
+	}
+	if r.Multiplier < 1 {
+		return fmt.Errorf("multiplier must be greater than or equal to 1")
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// Policy is the retry policy of the calls to the gRPC server: a default rule, overridden per gRPC status code.
+// The zero value retries every error immediately.
+type Policy struct {
+	Default Rule
+	Codes   map[codes.Code]Rule
+}
+
+// DefaultPolicy returns the policy retrying with exponential backoff, except for the errors caused by the request,
+// e.g., InvalidArgument or NotFound. ResourceExhausted is retried, as the nodes throttle the clients with it.
+func DefaultPolicy() Policy {
+	rule := Rule{
+		Action:       ActionRetry,
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		MaxDelay:     30 * time.Second,
+		Jitter:       0.2,
+	}
+
+	failFast := rule
+	failFast.Action = ActionFailFast
+
+	policy := Policy{Default: rule, Codes: make(map[codes.Code]Rule)}
+	for _, code := range []codes.Code{
+		codes.Canceled,
+		codes.InvalidArgument,
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.PermissionDenied,
+		codes.FailedPrecondition,
+		codes.OutOfRange,
+		codes.Unimplemented,
+		codes.Unauthenticated,
+	} {
+		policy.Codes[code] = failFast
+	}
+	return policy
+}
+
+// Rule returns the rule applying to the error. A message exceeding the maximum size always fails fast, as retrying
+// cannot fix it, whatever the rule of ResourceExhausted.
+func (p Policy) Rule(err error) Rule {
+	rule, ok := p.Codes[status.Code(err)]
+	if !ok {
+		rule = p.Default
+	}
+	if IsMessageTooLarge(err) {
+		rule.Action = ActionFailFast
+	}
+	return rule
+}
+
+// IsMessageTooLarge returns true if the call failed because a request or response message exceeds the maximum
+// size of the client or the server. gRPC reports it with ResourceExhausted, the code used for throttling as well.
+func IsMessageTooLarge(err error) bool {
+	return status.Code(err) == codes.ResourceExhausted && strings.Contains(err.Error(), "larger than max")
+}
+
+// Validate checks the rules of the policy.
+func (p Policy) Validate() error {
+	if err := p.Default.Validate(); err != nil {
+		return fmt.Errorf("invalid default retry rule: %w", err)
+	}
+	for code, rule := range p.Codes {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("invalid retry rule for %s: %w", code, err)
+		}
+	}
+	return nil
+}
+
+// Do calls fn until it succeeds, fails with an error that must not be retried, or fails maxAttempts times.
+// It waits for the delay of the rule of the error between two attempts, and stops when the context is done.
+// The attributes are logged with every retry.
+func Do[T any](ctx context.Context, p Policy, maxAttempts uint, fn func() (T, error), attrs ...any) (T, error) {
+	var zero T
+	var err error
+	for attempt := uint(1); attempt <= maxAttempts; attempt++ {
+		var result T
+		result, err = fn()
+		if err == nil {
+			return result, nil
+		}
+
+		rule := p.Rule(err)
+		if rule.Action == ActionFailFast {
+			return zero, err
+		}
+		if attempt == maxAttempts {
+			break
+		}
+
+		delay := rule.Delay(attempt)
+		slog.Debug("Retrying call", append(attrs, "attempt", attempt, "delay", delay, "code", status.Code(err), "error", err)...)
+		if err := Sleep(ctx, delay); err != nil {
+			return zero, err
+		}
+	}
+
+	return zero, fmt.Errorf("failed after %d attempts: %w", maxAttempts, err)
+}
+
+// Sleep waits for the delay, or returns the error of the context if it is done first.
+func Sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,99 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRuleDelay(t *testing.T) {
+	rule := Rule{Action: ActionRetry, InitialDelay: time.Second, Multiplier: 2, MaxDelay: 5 * time.Second}
+
+	assert.Equal(t, time.Second, rule.Delay(1))
+	assert.Equal(t, 2*time.Second, rule.Delay(2))
+	assert.Equal(t, 4*time.Second, rule.Delay(3))
+	assert.Equal(t, 5*time.Second, rule.Delay(4))
+
+	rule.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := rule.Delay(2)
+		assert.GreaterOrEqual(t, delay, time.Second)
+		assert.LessOrEqual(t, delay, 3*time.Second)
+	}
+}
+
+func TestPolicyRule(t *testing.T) {
+	policy := DefaultPolicy()
+
+	assert.Equal(t, ActionFailFast, policy.Rule(status.Error(codes.InvalidArgument, "invalid")).Action)
+	assert.Equal(t, ActionFailFast, policy.Rule(status.Error(codes.ResourceExhausted, "grpc: received message larger than max (5000 vs. 4096)")).Action)
+	assert.Equal(t, ActionRetry, policy.Rule(status.Error(codes.ResourceExhausted, "rate limit exceeded")).Action)
+	assert.Equal(t, ActionRetry, policy.Rule(status.Error(codes.Unavailable, "unavailable")).Action)
+	assert.Equal(t, ActionRetry, policy.Rule(errors.New("not a gRPC error")).Action)
+	require.NoError(t, policy.Validate())
+
+	// The oversized messages fail fast even when ResourceExhausted is configured to be retried
+	policy.Codes[codes.ResourceExhausted] = policy.Default
+	assert.Equal(t, ActionFailFast, policy.Rule(status.Error(codes.ResourceExhausted, "grpc: received message larger than max (5000 vs. 4096)")).Action)
+
+	policy.Codes[codes.Unavailable] = Rule{Action: "later"}
+	assert.ErrorContains(t, policy.Validate(), "invalid retry rule for Unavailable")
+}
+
+func TestDo(t *testing.T) {
+	policy := Policy{Default: Rule{Action: ActionRetry, InitialDelay: time.Millisecond, Multiplier: 2}}
+	policy.Codes = map[codes.Code]Rule{codes.NotFound: {Action: ActionFailFast}}
+
+	// Retried until success
+	calls := 0
+	result, err := Do(context.Background(), policy, 3, func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, status.Error(codes.Unavailable, "unavailable")
+		}
+		return 42, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 42, result)
+	assert.Equal(t, 3, calls)
+
+	// Not retried
+	calls = 0
+	_, err = Do(context.Background(), policy, 3, func() (int, error) {
+		calls++
+		return 0, status.Error(codes.NotFound, "not found")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, 1, calls)
+
+	// Retried until the maximum number of attempts
+	calls = 0
+	_, err = Do(context.Background(), policy, 3, func() (int, error) {
+		calls++
+		return 0, status.Error(codes.Unavailable, "unavailable")
+	})
+	assert.ErrorContains(t, err, "failed after 3 attempts")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 3, calls)
+}
+
+func TestDoContextCanceled(t *testing.T) {
+	policy := Policy{Default: Rule{Action: ActionRetry, InitialDelay: time.Hour}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := Do(ctx, policy, 3, func() (int, error) {
+		return 0, status.Error(codes.Unavailable, "unavailable")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,108 @@
+package testutil
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	SignerProtoName       = "cosmos/msg/v1/msg.proto"
+	SignerExtensionName   = "cosmos.msg.v1.signer"
+	SignerExtensionNumber = 11110000
+	MsgProtoName          = "test/v1/tx.proto"
+	MsgSendName           = "test.v1.MsgSend"
+	MsgMultiSendName      = "test.v1.MsgMultiSend"
+	MsgNoSignerName       = "test.v1.MsgNoSigner"
+)
+
+var (
+	// SignerFileDescriptor declares the cosmos.msg.v1.signer message option, like the Cosmos SDK.
+	SignerFileDescriptor = &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(SignerProtoName),
+		Package:    proto.String("cosmos.msg.v1"),
+		Dependency: []string{"google/protobuf/descriptor.proto"},
+		Extension: []*descriptorpb.FieldDescriptorProto{
+			{
+				Name:     proto.String("signer"),
+				Number:   proto.Int32(SignerExtensionNumber),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				Extendee: proto.String(".google.protobuf.MessageOptions"),
+			},
+		},
+		Syntax: proto.String("proto3"),
+	}
+
+	// MsgFileDescriptor declares messages annotated with the cosmos.msg.v1.signer option: MsgSend signed by
+	// from_address, MsgMultiSend signed by the addresses of its inputs, and MsgNoSigner without the option.
+	MsgFileDescriptor = &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(MsgProtoName),
+		Package:    proto.String("test.v1"),
+		Dependency: []string{SignerProtoName},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:    proto.String("MsgSend"),
+				Field:   []*descriptorpb.FieldDescriptorProto{stringField("from_address", 1), stringField("to_address", 2)},
+				Options: signerOptions("from_address"),
+			},
+			{
+				Name: proto.String("Input"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					stringField("address", 1),
+				},
+				Options: signerOptions("address"),
+			},
+			{
+				Name: proto.String("MsgMultiSend"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("inputs"),
+						Number:   proto.Int32(1),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						TypeName: proto.String(".test.v1.Input"),
+					},
+				},
+				Options: signerOptions("inputs"),
+			},
+			{
+				Name:  proto.String("MsgNoSigner"),
+				Field: []*descriptorpb.FieldDescriptorProto{stringField("creator", 1)},
+			},
+		},
+		Syntax: proto.String("proto3"),
+	}
+
+	// MockMsgFileDescriptorSet holds the annotated messages with their dependencies.
+	MockMsgFileDescriptorSet = &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto),
+			SignerFileDescriptor,
+			MsgFileDescriptor,
+		},
+	}
+)
+
+func stringField(name string, number int32) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+	}
+}
+
+// signerOptions returns message options setting the cosmos.msg.v1.signer option, encoded as unknown fields like the
+// options of the descriptors fetched using reflection.
+func signerOptions(fields ...string) *descriptorpb.MessageOptions {
+	var b []byte
+	for _, field := range fields {
+		b = protowire.AppendTag(b, SignerExtensionNumber, protowire.BytesType)
+		b = protowire.AppendString(b, field)
+	}
+	options := &descriptorpb.MessageOptions{}
+	options.ProtoReflect().SetUnknown(b)
+	return options
+}
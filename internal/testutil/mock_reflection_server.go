@@ -5,7 +5,8 @@ import (
 	"net"
 
 	"google.golang.org/grpc"
-	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
@@ -13,42 +14,98 @@ import (
 
 const bufSize = 1024 * 1024
 
-var lis *bufconn.Listener
+var (
+	// lis serves both reflection versions, lisV1 only v1, and lisV1Alpha only v1alpha
+	lis        = startMockServer(true, true)
+	lisV1      = startMockServer(true, false)
+	lisV1Alpha = startMockServer(false, true)
+)
 
-func init() {
-	lis = bufconn.Listen(bufSize)
+func startMockServer(v1, v1alpha bool) *bufconn.Listener {
+	l := bufconn.Listen(bufSize)
 	s := grpc.NewServer()
-	reflectionpb.RegisterServerReflectionServer(s, &mockServerReflection{})
+	if v1 {
+		reflectionv1.RegisterServerReflectionServer(s, &mockServerReflection{})
+	}
+	if v1alpha {
+		reflectionv1alpha.RegisterServerReflectionServer(s, &mockServerReflectionV1Alpha{})
+	}
 	go func() {
-		if err := s.Serve(lis); err != nil {
+		if err := s.Serve(l); err != nil {
 			panic(err)
 		}
 	}()
+	return l
 }
 
+// MockDialer connects to a mock server serving both gRPC reflection v1 and v1alpha.
 func MockDialer(_ context.Context, _ string) (net.Conn, error) {
 	return lis.Dial()
 }
 
+// MockV1Dialer connects to a mock server only serving gRPC reflection v1.
+func MockV1Dialer(_ context.Context, _ string) (net.Conn, error) {
+	return lisV1.Dial()
+}
+
+// MockV1AlphaDialer connects to a mock server only serving gRPC reflection v1alpha, like older servers.
+func MockV1AlphaDialer(_ context.Context, _ string) (net.Conn, error) {
+	return lisV1Alpha.Dial()
+}
+
 type mockServerReflection struct {
-	reflectionpb.UnimplementedServerReflectionServer
+	reflectionv1.UnimplementedServerReflectionServer
 }
 
-func (s *mockServerReflection) ServerReflectionInfo(stream reflectionpb.ServerReflection_ServerReflectionInfoServer) error {
+func (s *mockServerReflection) ServerReflectionInfo(stream reflectionv1.ServerReflection_ServerReflectionInfoServer) error {
 	for {
 		req, err := stream.Recv()
 		if err != nil {
 			return err
 		}
+		if err := stream.Send(mockResponse(req)); err != nil {
+			return err
+		}
+	}
+}
+
+// mockServerReflectionV1Alpha serves the same responses as mockServerReflection, the messages of both versions
+// being wire-compatible.
+type mockServerReflectionV1Alpha struct {
+	reflectionv1alpha.UnimplementedServerReflectionServer
+}
+
+func (s *mockServerReflectionV1Alpha) ServerReflectionInfo(stream reflectionv1alpha.ServerReflection_ServerReflectionInfoServer) error {
+	for {
+		alphaReq, err := stream.Recv()
+		if err != nil {
+			return err
+		}
 
-		switch req.MessageRequest.(type) {
-		case *reflectionpb.ServerReflectionRequest_ListServices:
-			stream.Send(createListServicesResponse(TestServiceName))
-		case *reflectionpb.ServerReflectionRequest_FileByFilename:
-			stream.Send(createFileDescriptorResponse(MockDependencyFileDescriptor))
-		case *reflectionpb.ServerReflectionRequest_FileContainingSymbol:
-			stream.Send(createFileContainingSymbolResponse(MockFileDescriptor))
+		req := &reflectionv1.ServerReflectionRequest{}
+		if err := proto.Unmarshal(mustMarshal(alphaReq), req); err != nil {
+			return err
 		}
+		resp := &reflectionv1alpha.ServerReflectionResponse{}
+		if err := proto.Unmarshal(mustMarshal(mockResponse(req)), resp); err != nil {
+			return err
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func mockResponse(req *reflectionv1.ServerReflectionRequest) *reflectionv1.ServerReflectionResponse {
+	switch req.MessageRequest.(type) {
+	case *reflectionv1.ServerReflectionRequest_ListServices:
+		return createListServicesResponse(TestServiceName)
+	case *reflectionv1.ServerReflectionRequest_FileByFilename:
+		return createFileDescriptorResponse(MockDependencyFileDescriptor)
+	case *reflectionv1.ServerReflectionRequest_FileContainingSymbol:
+		return createFileContainingSymbolResponse(MockFileDescriptor)
+	default:
+		return &reflectionv1.ServerReflectionResponse{}
 	}
 }
 
@@ -60,11 +117,11 @@ func mustMarshal(pb proto.Message) []byte {
 	return data
 }
 
-func createListServicesResponse(serviceName string) *reflectionpb.ServerReflectionResponse {
-	return &reflectionpb.ServerReflectionResponse{
-		MessageResponse: &reflectionpb.ServerReflectionResponse_ListServicesResponse{
-			ListServicesResponse: &reflectionpb.ListServiceResponse{
-				Service: []*reflectionpb.ServiceResponse{
+func createListServicesResponse(serviceName string) *reflectionv1.ServerReflectionResponse {
+	return &reflectionv1.ServerReflectionResponse{
+		MessageResponse: &reflectionv1.ServerReflectionResponse_ListServicesResponse{
+			ListServicesResponse: &reflectionv1.ListServiceResponse{
+				Service: []*reflectionv1.ServiceResponse{
 					{Name: serviceName},
 				},
 			},
@@ -72,10 +129,10 @@ func createListServicesResponse(serviceName string) *reflectionpb.ServerReflecti
 	}
 }
 
-func createFileDescriptorResponse(fd *descriptorpb.FileDescriptorProto) *reflectionpb.ServerReflectionResponse {
-	return &reflectionpb.ServerReflectionResponse{
-		MessageResponse: &reflectionpb.ServerReflectionResponse_FileDescriptorResponse{
-			FileDescriptorResponse: &reflectionpb.FileDescriptorResponse{
+func createFileDescriptorResponse(fd *descriptorpb.FileDescriptorProto) *reflectionv1.ServerReflectionResponse {
+	return &reflectionv1.ServerReflectionResponse{
+		MessageResponse: &reflectionv1.ServerReflectionResponse_FileDescriptorResponse{
+			FileDescriptorResponse: &reflectionv1.FileDescriptorResponse{
 				FileDescriptorProto: [][]byte{
 					mustMarshal(fd),
 				},
@@ -84,10 +141,10 @@ func createFileDescriptorResponse(fd *descriptorpb.FileDescriptorProto) *reflect
 	}
 }
 
-func createFileContainingSymbolResponse(fd *descriptorpb.FileDescriptorProto) *reflectionpb.ServerReflectionResponse {
-	return &reflectionpb.ServerReflectionResponse{
-		MessageResponse: &reflectionpb.ServerReflectionResponse_FileDescriptorResponse{
-			FileDescriptorResponse: &reflectionpb.FileDescriptorResponse{
+func createFileContainingSymbolResponse(fd *descriptorpb.FileDescriptorProto) *reflectionv1.ServerReflectionResponse {
+	return &reflectionv1.ServerReflectionResponse{
+		MessageResponse: &reflectionv1.ServerReflectionResponse_FileDescriptorResponse{
+			FileDescriptorResponse: &reflectionv1.FileDescriptorResponse{
 				FileDescriptorProto: [][]byte{
 					mustMarshal(fd),
 				},
@@ -1,17 +1,23 @@
 package utils
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"regexp"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/manifest-network/yaci/internal/client"
+	"github.com/manifest-network/yaci/internal/retry"
 	"github.com/pkg/errors"
 )
 
 const statusMethod = "cosmos.base.node.v1beta1.Service.Status"
 const getBlockByHeightMethod = "cosmos.base.tendermint.v1beta1.Service.GetBlockByHeight"
+const blockResultsMethod = "block_results"
 
 // GetLatestBlockHeightWithRetry retrieves the latest block height from the gRPC server with retry logic.
 func GetLatestBlockHeightWithRetry(gRPCClient *client.GRPCClient, maxRetries uint) (uint64, error) {
@@ -35,6 +41,13 @@ func GetLatestBlockHeightWithRetry(gRPCClient *client.GRPCClient, maxRetries uin
 // For archive nodes, returns 1. For pruned nodes, parses the error message
 // to extract the lowest available height.
 func GetEarliestBlockHeight(gRPCClient *client.GRPCClient, maxRetries uint) (uint64, error) {
+	// The endpoint pool already knows the earliest height available on its endpoints
+	if pool, ok := gRPCClient.Conn.(*client.EndpointPool); ok {
+		if earliest, ok := pool.EarliestHeight(); ok {
+			return earliest, nil
+		}
+	}
+
 	inputParams := []byte(`{"height":"1"}`)
 
 	// Fast path: single attempt to check if block 1 exists
@@ -44,7 +57,7 @@ func GetEarliestBlockHeight(gRPCClient *client.GRPCClient, maxRetries uint) (uin
 	}
 
 	// Check if error reveals the pruning boundary
-	if lowestHeight := parseLowestHeightFromError(err.Error()); lowestHeight > 0 {
+	if lowestHeight := client.ParseLowestHeight(err.Error()); lowestHeight > 0 {
 		return lowestHeight, nil
 	}
 
@@ -57,18 +70,58 @@ func GetEarliestBlockHeight(gRPCClient *client.GRPCClient, maxRetries uint) (uin
 	return 0, fmt.Errorf("failed to determine earliest block height: %w", err)
 }
 
-// parseLowestHeightFromError extracts lowest height from pruned node errors.
-// CosmosSDK nodes return errors like "height 1 is not available, lowest height is 28566001".
-func parseLowestHeightFromError(errMsg string) uint64 {
-	re := regexp.MustCompile(`lowest height is (\d+)`)
-	matches := re.FindStringSubmatch(strings.ToLower(errMsg))
+// GetBlockIdentityWithRetry retrieves the chain-id of the block at the given height and its uppercase hex-encoded hash.
+func GetBlockIdentityWithRetry(gRPCClient *client.GRPCClient, height uint64, maxRetries uint) (chainID string, hash string, err error) {
+	inputParams := []byte(fmt.Sprintf(`{"height":"%d"}`, height))
+	response, err := GetGRPCResponse(gRPCClient, getBlockByHeightMethod, maxRetries, inputParams)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get block %d: %w", height, err)
+	}
+
+	return parseBlockIdentity(response)
+}
 
-	if len(matches) >= 2 {
-		height, err := strconv.ParseUint(matches[1], 10, 64)
-		if err == nil {
-			return height
-		}
+// parseBlockIdentity returns the chain-id and the uppercase hex-encoded hash of a GetBlockByHeight response.
+// The chain-id is read from the deprecated block field, or from the SDK block of the newer Cosmos SDK versions.
+func parseBlockIdentity(response []byte) (chainID string, hash string, err error) {
+	type header struct {
+		ChainID string `json:"chainId"`
+	}
+	var block struct {
+		BlockID struct {
+			Hash string `json:"hash"`
+		} `json:"blockId"`
+		Block struct {
+			Header header `json:"header"`
+		} `json:"block"`
+		SdkBlock struct {
+			Header header `json:"header"`
+		} `json:"sdkBlock"`
 	}
+	if err := json.Unmarshal(response, &block); err != nil {
+		return "", "", fmt.Errorf("failed to unmarshal block: %w", err)
+	}
+
+	chainID = block.Block.Header.ChainID
+	if chainID == "" {
+		chainID = block.SdkBlock.Header.ChainID
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(block.BlockID.Hash)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode block hash: %w", err)
+	}
+
+	return chainID, strings.ToUpper(hex.EncodeToString(decoded)), nil
+}
+
+// GetBlockResultsWithRetry retrieves the CometBFT block results at the given height, retrying according to the policy.
+// The block results contain the FinalizeBlock (or BeginBlock/EndBlock) events emitted by the modules,
+// which are not part of the transaction responses.
+func GetBlockResultsWithRetry(ctx context.Context, rpcClient *client.RPCClient, policy retry.Policy, height uint64, maxRetries uint) ([]byte, error) {
+	params := url.Values{"height": []string{strconv.FormatUint(height, 10)}}
 
-	return 0
+	return retry.Do(ctx, policy, maxRetries, func() ([]byte, error) {
+		return rpcClient.Call(ctx, blockResultsMethod, params)
+	}, "method", blockResultsMethod, "height", height)
 }
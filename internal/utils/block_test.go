@@ -2,40 +2,24 @@ package utils
 
 import "testing"
 
-func TestParseLowestHeightFromError(t *testing.T) {
-	tests := []struct {
-		name   string
-		errMsg string
-		want   uint64
-	}{
-		{
-			name:   "standard pruned node error",
-			errMsg: "height 1 is not available, lowest height is 28566001",
-			want:   28566001,
-		},
-		{
-			name:   "wrapped error",
-			errMsg: "rpc error: code = Unknown desc = height 1 is not available, lowest height is 12345",
-			want:   12345,
-		},
-		{
-			name:   "unrelated error",
-			errMsg: "connection refused",
-			want:   0,
-		},
-		{
-			name:   "empty string",
-			errMsg: "",
-			want:   0,
-		},
+func TestParseBlockIdentity(t *testing.T) {
+	chainID, hash, err := parseBlockIdentity([]byte(`{"blockId":{"hash":"q80="},"block":{"header":{"chainId":"devnet-1","height":"5"}}}`))
+	if err != nil {
+		t.Fatalf("parseBlockIdentity() error = %v", err)
+	}
+	if chainID != "devnet-1" || hash != "ABCD" {
+		t.Errorf("parseBlockIdentity() = %q, %q, want %q, %q", chainID, hash, "devnet-1", "ABCD")
+	}
+
+	chainID, _, err = parseBlockIdentity([]byte(`{"blockId":{"hash":"q80="},"sdkBlock":{"header":{"chainId":"devnet-2"}}}`))
+	if err != nil {
+		t.Fatalf("parseBlockIdentity() error = %v", err)
+	}
+	if chainID != "devnet-2" {
+		t.Errorf("parseBlockIdentity() chainID = %q, want %q", chainID, "devnet-2")
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := parseLowestHeightFromError(tt.errMsg)
-			if got != tt.want {
-				t.Errorf("parseLowestHeightFromError() = %d, want %d", got, tt.want)
-			}
-		})
+	if _, _, err = parseBlockIdentity([]byte(`not json`)); err == nil {
+		t.Error("parseBlockIdentity() expected an error for invalid JSON")
 	}
 }
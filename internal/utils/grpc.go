@@ -2,12 +2,10 @@ package utils
 
 import (
 	"fmt"
-	"log/slog"
 	"strings"
-	"time"
 
 	"github.com/manifest-network/yaci/internal/client"
-	"github.com/pkg/errors"
+	"github.com/manifest-network/yaci/internal/retry"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
@@ -56,7 +54,7 @@ func invokeGRPC(
 
 	// Unmarshal input parameters if provided
 	if len(inputParams) > 0 {
-		uo := protojson.UnmarshalOptions{Resolver: gRPCClient.Resolver}
+		uo := protojson.UnmarshalOptions{Resolver: gRPCClient.Resolvers.Latest()}
 		if err := uo.Unmarshal(inputParams, inputMsg); err != nil {
 			return nil, fmt.Errorf("failed to parse input parameters: %w", err)
 		}
@@ -71,7 +69,7 @@ func invokeGRPC(
 	return outputMsg, nil
 }
 
-// RetryGRPCCall retries a gRPC call with exponential backoff
+// RetryGRPCCall retries a gRPC call according to the retry policy of the client
 func RetryGRPCCall[T any](
 	gRPCClient *client.GRPCClient,
 	methodFullName string,
@@ -84,25 +82,17 @@ func RetryGRPCCall[T any](
 		return zero, err
 	}
 
-	methodDescriptor, err := gRPCClient.Resolver.FindMethodDescriptor(serviceName, methodNameOnly)
+	// The nodes serve every height with their current binary, hence with the methods of the latest schema
+	methodDescriptor, err := gRPCClient.Resolvers.Latest().FindMethodDescriptor(serviceName, methodNameOnly)
 	if err != nil {
 		var zero T
 		return zero, fmt.Errorf("failed to find method descriptor: %v", err)
 	}
 	fullMethodName := BuildFullMethodName(methodDescriptor)
 
-	var result T
-	for attempt := uint(1); attempt <= maxRetries; attempt++ {
-		result, err = callFunc(fullMethodName, methodDescriptor)
-		if err == nil {
-			return result, nil
-		}
-		slog.Debug("Retrying gRPC call", "method", methodFullName, "attempt", attempt, "error", err)
-		time.Sleep(time.Duration(2*attempt) * time.Second)
-	}
-
-	var zero T
-	return zero, errors.WithMessage(err, fmt.Sprintf("Failed after %d retries", maxRetries))
+	return retry.Do(gRPCClient.Ctx, gRPCClient.RetryPolicy, maxRetries, func() (T, error) {
+		return callFunc(fullMethodName, methodDescriptor)
+	}, "method", methodFullName)
 }
 
 // getNestedField navigates through nested protobuf message fields using dot notation.
@@ -190,8 +180,8 @@ func GetGRPCResponse(
 				return nil, fmt.Errorf("error invoking method: %w", err)
 			}
 
-			// Marshal the response to JSON
-			mo := protojson.MarshalOptions{Resolver: gRPCClient.Resolver}
+			// Marshal the response to JSON, decoding the Any fields with the schema of the queried height
+			mo := protojson.MarshalOptions{Resolver: gRPCClient.Resolver()}
 			responseBytes, err := mo.Marshal(outputMsg)
 			if err != nil {
 				return nil, fmt.Errorf("failed to marshal response: %w", err)
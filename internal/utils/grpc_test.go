@@ -1,14 +1,21 @@
 package utils
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/manifest-network/yaci/internal/client"
+	"github.com/manifest-network/yaci/internal/reflection"
+	"github.com/manifest-network/yaci/internal/retry"
 )
 
 // createTestMessage creates a test protobuf message with nested structure
@@ -228,3 +235,62 @@ func TestParseMethodFullName(t *testing.T) {
 		})
 	}
 }
+
+// recordingConn records the requests of the calls, and answers them with empty responses.
+type recordingConn struct {
+	grpc.ClientConnInterface
+	requests []proto.Message
+}
+
+func (c *recordingConn) Invoke(_ context.Context, _ string, args, _ any, _ ...grpc.CallOption) error {
+	c.requests = append(c.requests, args.(proto.Message))
+	return nil
+}
+
+// searchResolver returns the resolver of a schema whose Search method takes a request with the given field.
+func searchResolver(t *testing.T, field string) *reflection.CustomResolver {
+	t.Helper()
+
+	files, err := reflection.BuildFileDescriptorSet([]*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("test/search.proto"),
+		Package: proto.String("test"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("SearchRequest"), Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:   proto.String(field),
+				Number: proto.Int32(1),
+				Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}}},
+			{Name: proto.String("SearchResponse")},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Service"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Search"),
+				InputType:  proto.String(".test.SearchRequest"),
+				OutputType: proto.String(".test.SearchResponse"),
+			}},
+		}},
+	}})
+	require.NoError(t, err)
+	return reflection.NewCustomResolver(context.Background(), files, nil, retry.Policy{}, 1, nil)
+}
+
+func TestGetGRPCResponseLatestSchema(t *testing.T) {
+	// The request of the schema upgraded at height 100 replaces the events field with the query field
+	resolvers := reflection.NewResolverHistory(searchResolver(t, "events"))
+	resolvers.Add(100, searchResolver(t, "query"))
+	conn := &recordingConn{}
+	gRPCClient := &client.GRPCClient{Ctx: context.Background(), Conn: conn, Resolvers: resolvers, RetryPolicy: retry.Policy{}}
+
+	// The calls querying a height before the upgrade are served by the current binary of the nodes,
+	// so their requests have the shape of the latest schema
+	old := gRPCClient.WithContext(client.WithHeight(context.Background(), 50))
+	_, err := GetGRPCResponse(old, "test.Service.Search", 1, []byte(`{"query": "tx.height=50"}`))
+	require.NoError(t, err)
+	_, err = GetGRPCResponse(old, "test.Service.Search", 1, []byte(`{"events": ["tx.height=50"]}`))
+	assert.ErrorContains(t, err, "failed to parse input parameters")
+
+	require.Len(t, conn.requests, 1)
+	request := conn.requests[0].ProtoReflect()
+	assert.Equal(t, "tx.height=50", request.Get(request.Descriptor().Fields().ByName("query")).String())
+}